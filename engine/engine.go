@@ -2,10 +2,15 @@
 package engine
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
+	"time"
 
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
@@ -14,6 +19,7 @@ import (
 	"github.com/janderland/fdbq/engine/stream"
 	"github.com/janderland/fdbq/keyval"
 	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/keyval/compare"
 	"github.com/janderland/fdbq/keyval/convert"
 	"github.com/janderland/fdbq/keyval/values"
 )
@@ -21,6 +27,14 @@ import (
 // SingleOpts configures how an [Engine.ReadSingle] call is executed.
 type SingleOpts struct {
 	Filter bool
+
+	// ReadVersion, when non-zero, is the version at which
+	// the read is performed. See [Engine.SetReadVersion].
+	ReadVersion int64
+
+	// Snapshot enables snapshot reads, which don't
+	// cause the transaction to conflict.
+	Snapshot bool
 }
 
 // RangeOpts configures how an [Engine.ReadRange] call is executed.
@@ -28,15 +42,161 @@ type RangeOpts struct {
 	Reverse bool
 	Filter  bool
 	Limit   int
+
+	// ReadVersion, when non-zero, is the version at which
+	// the read is performed. See [Engine.SetReadVersion].
+	ReadVersion int64
+
+	// Snapshot enables snapshot reads, which don't
+	// cause the transaction to conflict.
+	Snapshot bool
+
+	// Mode is the streaming mode used by the range read. Small
+	// modes favor latency while large modes favor throughput.
+	Mode fdb.StreamingMode
+
+	// BatchSize, when non-zero, is the number of key-values
+	// requested from FDB at a time.
+	BatchSize int
+
+	// Resume allows the range read to span multiple transactions,
+	// avoiding FDB's 5 second transaction limit. The key-values are
+	// NOT read from a consistent snapshot of the DB. See [ResumeWarning].
+	Resume bool
+
+	// Cursor, when non-empty, causes the range read to continue after
+	// the key-value from which the cursor was created. See [Cursor].
+	// Paginate is implied when Cursor is set.
+	Cursor string
+
+	// Paginate causes Limit to bound the total number of key-values
+	// read across all directories, instead of the number read from
+	// each directory. The first page of a paginated range read
+	// should set Paginate, while the following pages set Cursor.
+	Paginate bool
+
+	// Distinct, when non-zero, only reads the first key-value of each
+	// group of keys sharing their first Distinct tuple elements. After
+	// each key-value is read, the rest of its group is skipped without
+	// being read. If the key-value doesn't match the query, it's handled
+	// according to Filter, so its group may be omitted entirely.
+	Distinct int
+}
+
+// ResumeWarning describes the consistency caveat of [RangeOpts.Resume].
+const ResumeWarning = "range-reads may span multiple transactions, so the results aren't guaranteed to be consistent"
+
+// Group summarizes the key-values sharing a key prefix. See [Engine.GroupBy].
+type Group struct {
+	// Key holds the directory & leading tuple
+	// elements shared by the group's keys.
+	Key keyval.Key
+
+	// Count is the number of key-values in the group.
+	Count int
+
+	// Bytes is the total size of the group's
+	// values, as they are stored in the DB.
+	Bytes int
 }
 
-func (x RangeOpts) forStream() stream.RangeOpts {
-	return stream.RangeOpts{
-		Reverse: x.Reverse,
-		Limit:   x.Limit,
+// Versions holds the versions used by a transaction.
+type Versions struct {
+	// Read is the version at which the transaction read.
+	Read int64
+
+	// Commit is the version at which the transaction
+	// committed. Read-only transactions have a commit
+	// version of -1.
+	Commit int64
+}
+
+func (x RangeOpts) forStream() (stream.RangeOpts, error) {
+	opts := stream.RangeOpts{
+		Reverse:   x.Reverse,
+		Limit:     x.Limit,
+		Mode:      x.Mode,
+		BatchSize: x.BatchSize,
+		Resume:    x.Resume,
+		Distinct:  x.Distinct,
+
+		TotalLimit: x.Paginate || x.Cursor != "",
+	}
+	if x.Cursor != "" {
+		pos, err := parseCursor(x.Cursor)
+		if err != nil {
+			return stream.RangeOpts{}, err
+		}
+		opts.After = &pos
 	}
+	return opts, nil
 }
 
+// Cursor creates an opaque token identifying the position of the given
+// key-value, which must have been read by [Engine.ReadRange]. When the
+// token is passed via [RangeOpts.Cursor], the range read continues
+// after this key-value. This allows range reads to be paginated
+// using [RangeOpts.Limit] & [RangeOpts.Paginate].
+func Cursor(kv keyval.KeyValue) (string, error) {
+	path, err := convert.ToStringArray(kv.Key.Directory)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert directory to string array")
+	}
+	key, err := convert.ToFDBTuple(kv.Key.Tuple)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert key tuple to FDB tuple")
+	}
+
+	var dir tuple.Tuple
+	for _, part := range path {
+		dir = append(dir, part)
+	}
+	token := tuple.Tuple{dir, key.Pack()}.Pack()
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// parseCursor decodes a token created by [Cursor].
+func parseCursor(cursor string) (stream.Position, error) {
+	invalid := errors.Errorf("invalid cursor '%s'", cursor)
+
+	token, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return stream.Position{}, invalid
+	}
+	tup, err := tuple.Unpack(token)
+	if err != nil || len(tup) != 2 {
+		return stream.Position{}, invalid
+	}
+	dir, ok := tup[0].(tuple.Tuple)
+	if !ok {
+		return stream.Position{}, invalid
+	}
+	key, ok := tup[1].([]byte)
+	if !ok {
+		return stream.Position{}, invalid
+	}
+
+	pos := stream.Position{Key: key}
+	for _, part := range dir {
+		str, ok := part.(string)
+		if !ok {
+			return stream.Position{}, invalid
+		}
+		pos.Dir = append(pos.Dir, str)
+	}
+	return pos, nil
+}
+
+const (
+	// clearBatchKeys is the max number of keys read by
+	// each transaction during [Engine.ClearRange].
+	clearBatchKeys = 1000
+
+	// clearBatchBytes is the max number of key bytes
+	// cleared by each transaction during [Engine.ClearRange].
+	clearBatchBytes = 1 << 20
+)
+
 // Option can be passed as a trailing argument to the New function
 // to modify properties of the created Engine.
 type Option func(*Engine)
@@ -46,9 +206,27 @@ type Option func(*Engine)
 // will fail if a query of the wrong class in provided. Unless [Engine.Transact]
 // is used, each query is executed in its own transaction.
 type Engine struct {
-	tr    facade.Transactor
-	log   zerolog.Logger
-	order binary.ByteOrder
+	tr      facade.Transactor
+	log     zerolog.Logger
+	order   binary.ByteOrder
+	txOpts  facade.TransactionOptions
+	journal func(JournalEntry) error
+	indexes []Index
+}
+
+// JournalEntry records the value of a key before it was
+// changed by [Engine.Set] or [Engine.Clear]. See [Journal].
+type JournalEntry struct {
+	// Dir is the path of the directory containing the key.
+	Dir []string
+
+	// Key is the packed tuple of the key,
+	// without the directory's prefix.
+	Key []byte
+
+	// Value is the key's prior value. If the
+	// key didn't exist, Value is nil.
+	Value []byte
 }
 
 func New(tr facade.Transactor, opts ...Option) Engine {
@@ -79,17 +257,174 @@ func ByteOrder(order binary.ByteOrder) Option {
 	}
 }
 
+// Timeout sets the max duration of each transaction, including retries.
+// Watches created by [Engine.Watch] are also canceled after the timeout.
+// This method must not be called concurrently with other methods.
+func Timeout(timeout time.Duration) Option {
+	return func(eg *Engine) {
+		eg.txOpts.Timeout = timeout
+	}
+}
+
+// RetryLimit sets the max number of retries for each transaction. This
+// method must not be called concurrently with other methods.
+func RetryLimit(limit int) Option {
+	return func(eg *Engine) {
+		eg.txOpts.RetryLimit = limit
+	}
+}
+
+// MaxRetryDelay sets the max backoff between retries of each transaction.
+// This method must not be called concurrently with other methods.
+func MaxRetryDelay(delay time.Duration) Option {
+	return func(eg *Engine) {
+		eg.txOpts.MaxRetryDelay = delay
+	}
+}
+
+// Priority sets the scheduling priority of each transaction. This method
+// must not be called concurrently with other methods.
+func Priority(priority facade.Priority) Option {
+	return func(eg *Engine) {
+		eg.txOpts.Priority = priority
+	}
+}
+
+// SizeLimit sets the max number of bytes each transaction may write. This
+// method must not be called concurrently with other methods.
+func SizeLimit(bytes int) Option {
+	return func(eg *Engine) {
+		eg.txOpts.SizeLimit = bytes
+	}
+}
+
+// Journal causes [Engine.Set] & [Engine.Clear] to read the prior value of the key
+// within the same transaction and pass it to the given function before the key is
+// changed. If the function returns an error, the transaction fails. The function is
+// called before the transaction commits, so an entry may describe a change which
+// was never committed. If the transaction is retried, the function may be called
+// again for the same change. This method must not be called concurrently with
+// other methods.
+func Journal(record func(JournalEntry) error) Option {
+	return func(eg *Engine) {
+		eg.journal = record
+	}
+}
+
 // Transact wraps a group of Engine method calls under a single transaction. The newly
 // created Engine inherits the logger & byte order of the parent engine. Any changes to
 // the logger or byte order of the new Engine has no effect on the parent Engine.
 func (x *Engine) Transact(f func(Engine) (interface{}, error)) (interface{}, error) {
-	return x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	return x.transact(func(tr facade.Transaction) (interface{}, error) {
 		return f(Engine{
-			tr:    tr,
-			log:   x.log,
-			order: x.order,
+			tr:      tr,
+			log:     x.log,
+			order:   x.order,
+			txOpts:  x.txOpts,
+			journal: x.journal,
+			indexes: x.indexes,
+		})
+	})
+}
+
+// DryRun returns a copy of this Engine whose transactions are aborted instead of
+// committed. Reads are performed as usual. The writes performed by each transaction
+// are passed to the given function before the transaction is aborted. Because the
+// writes are never committed, writes spanning multiple transactions, such as those
+// of [Engine.ClearRange] or a [Loader], don't observe each other. This method must
+// not be called on an Engine created by [Engine.Transact]. See
+// [facade.NewDryRunTransactor].
+func (x *Engine) DryRun(report func(facade.Write)) Engine {
+	eg := *x
+	eg.tr = facade.NewDryRunTransactor(x.tr, report)
+	return eg
+}
+
+// transact runs the given function in a transaction
+// configured with the Engine's transaction options.
+func (x *Engine) transact(f func(facade.Transaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+		if err := tr.SetOptions(x.txOpts); err != nil {
+			return nil, errors.Wrap(err, "failed to set transaction options")
+		}
+		return f(tr)
+	})
+}
+
+// readTransact runs the given function in a read transaction
+// configured with the Engine's transaction options.
+func (x *Engine) readTransact(f func(facade.ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		if err := tr.SetOptions(x.txOpts); err != nil {
+			return nil, errors.Wrap(err, "failed to set transaction options")
+		}
+		return f(tr)
+	})
+}
+
+// TransactVersions behaves like [Engine.Transact] and also returns the
+// read & commit versions of the transaction. If this Engine was created
+// by [Engine.Transact], the transaction is reused and won't have been
+// committed yet, so the returned commit version is invalid.
+func (x *Engine) TransactVersions(f func(Engine) (interface{}, error)) (interface{}, Versions, error) {
+	var (
+		txn      facade.Transaction
+		versions Versions
+	)
+	out, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		txn = tr
+		out, err := f(Engine{
+			tr:      tr,
+			log:     x.log,
+			order:   x.order,
+			txOpts:  x.txOpts,
+			journal: x.journal,
+			indexes: x.indexes,
 		})
+		if err != nil {
+			return nil, err
+		}
+		versions.Read, err = tr.GetReadVersion().Get()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get read version")
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, Versions{}, err
+	}
+
+	versions.Commit, err = txn.GetCommittedVersion()
+	if err != nil {
+		return nil, Versions{}, errors.Wrap(err, "failed to get commit version")
+	}
+	return out, versions, nil
+}
+
+// ReadVersion returns the version at which the transaction reads. If this Engine
+// wasn't created by [Engine.Transact], the version is obtained from a new transaction
+// and is therefore the latest version. The returned version may be passed to
+// [SingleOpts] or [RangeOpts] to read multiple queries from a consistent snapshot.
+func (x *Engine) ReadVersion() (int64, error) {
+	version, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		return tr.GetReadVersion().Get()
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "transaction failed")
+	}
+	return version.(int64), nil
+}
+
+// SetReadVersion sets the version at which the transaction reads. This is only
+// useful if this Engine was created by [Engine.Transact] and must be called before
+// any other methods. Otherwise, the read version should be set via [SingleOpts]
+// or [RangeOpts].
+func (x *Engine) SetReadVersion(version int64) error {
+	_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		tr.SetReadVersion(version)
+		return nil, nil
 	})
+	return errors.Wrap(err, "transaction failed")
 }
 
 // Set preforms a write operation for a single key-value. The given query must
@@ -109,7 +444,7 @@ func (x *Engine) Set(query keyval.KeyValue) error {
 		return errors.Wrap(err, "failed to pack value")
 	}
 
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("setting")
 
 		dir, err := tr.DirCreateOrOpen(path)
@@ -122,6 +457,10 @@ func (x *Engine) Set(query keyval.KeyValue) error {
 			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
 		}
 
+		if err := x.record(tr, path, dir, query.Key.Tuple, tup, valueBytes); err != nil {
+			return nil, err
+		}
+
 		tr.Set(dir.Pack(tup), valueBytes)
 		return nil, nil
 	})
@@ -140,7 +479,7 @@ func (x *Engine) Clear(query keyval.KeyValue) error {
 		return errors.Wrap(err, "failed to convert directory to string array")
 	}
 
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("clearing")
 
 		dir, err := tr.DirOpen(path)
@@ -156,12 +495,260 @@ func (x *Engine) Clear(query keyval.KeyValue) error {
 			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
 		}
 
+		if err := x.record(tr, path, dir, query.Key.Tuple, tup, nil); err != nil {
+			return nil, err
+		}
+
 		tr.Clear(dir.Pack(tup))
 		return nil, nil
 	})
 	return errors.Wrap(err, "transaction failed")
 }
 
+// record is called before the given key is written. The value is
+// the key's new value, or nil if the key is being cleared. The key's
+// prior value is passed to the journal configured via [Journal] and
+// the entries of the indexes configured via [Indexes] are updated.
+// If neither are configured, this method does nothing.
+func (x *Engine) record(tr facade.Transaction, path []string, dir directory.DirectorySubspace, key keyval.Tuple, tup tuple.Tuple, value []byte) error {
+	if x.journal == nil && len(x.indexes) == 0 {
+		return nil
+	}
+
+	prior, err := tr.Get(dir.Pack(tup)).Get()
+	if err != nil {
+		return errors.Wrap(err, "failed to read prior value")
+	}
+	return x.recordPrior(tr, path, key, tup.Pack(), prior, value)
+}
+
+// recordPrior is like record, except the key's prior value has already
+// been read by the caller. The key is given both as a keyval.Tuple & as
+// packed bytes without the directory's prefix. If the key isn't a tuple,
+// the keyval.Tuple is nil and the indexes aren't updated.
+func (x *Engine) recordPrior(tr facade.Transaction, path []string, key keyval.Tuple, packed []byte, prior []byte, value []byte) error {
+	if x.journal != nil {
+		entry := JournalEntry{Dir: path, Key: packed, Value: prior}
+		if err := x.journal(entry); err != nil {
+			return errors.Wrap(err, "failed to record journal entry")
+		}
+	}
+
+	if key == nil {
+		return nil
+	}
+	for _, index := range x.indexes {
+		if err := x.updateIndex(tr, index, path, key, prior, value); err != nil {
+			return errors.Wrapf(err, "failed to update index '%s'", index.name)
+		}
+	}
+	return nil
+}
+
+// ClearRange clears every key-value matching the given schema. The given query must belong
+// to [class.VariableClear]. If the key's tuple is a constant prefix followed by a MaybeMore,
+// then each matching directory is cleared with a single range-clear, unless a [Journal] or
+// [Indexes] are configured. Otherwise, the matching keys are read and cleared in batches, each batch in its
+// own transaction. Between batches, the provided context is checked for cancellation.
+func (x *Engine) ClearRange(ctx context.Context, query keyval.KeyValue) error {
+	if class.Classify(query) != class.VariableClear {
+		return errors.New("query not variable-clear class")
+	}
+
+	dirs, err := x.openDirectories(ctx, query.Key.Directory)
+	if err != nil {
+		return err
+	}
+
+	// Single range-clears can't record the keys they clear, so
+	// journals & indexes require the keys to be read & cleared.
+	prefix, isPrefix := rangeClearPrefix(query.Key.Tuple)
+	if x.journal != nil || len(x.indexes) > 0 {
+		isPrefix = false
+	}
+	for _, dir := range dirs {
+		if isPrefix {
+			err = x.clearPrefix(dir, prefix)
+		} else {
+			// The path is made relative to the root
+			// directory, like the paths of queries.
+			path := dir.GetPath()
+			err = x.clearBatches(ctx, dir, path[len(path)-len(query.Key.Directory):], query.Key.Tuple)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to clear directory %v", dir.GetPath())
+		}
+	}
+	return nil
+}
+
+// openDirectories opens every directory matching the given
+// query within a single transaction.
+func (x *Engine) openDirectories(ctx context.Context, query keyval.Directory) ([]directory.DirectorySubspace, error) {
+	var dirs []directory.DirectorySubspace
+	_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		dirs = nil
+		s := stream.New(ctx, stream.Logger(x.log))
+		for msg := range s.OpenDirectories(tr, query) {
+			if msg.Err != nil {
+				return nil, msg.Err
+			}
+			dirs = append(dirs, msg.Dir)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open directories")
+	}
+	return dirs, nil
+}
+
+// clearPrefix clears every key within the given
+// directory which begins with the given prefix.
+func (x *Engine) clearPrefix(dir directory.DirectorySubspace, prefix tuple.Tuple) error {
+	rng, err := fdb.PrefixRange(dir.Pack(prefix))
+	if err != nil {
+		return errors.Wrap(err, "failed to create prefix range")
+	}
+
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Strs("dir", dir.GetPath()).Interface("prefix", prefix).Msg("range clearing")
+		tr.ClearRange(rng)
+		return nil, nil
+	})
+	return errors.Wrap(err, "transaction failed")
+}
+
+// clearBatches reads the keys within the given directory and clears the ones
+// matching the schema. Each transaction reads at most clearBatchKeys keys and
+// clears at most clearBatchBytes bytes worth of keys. The cleared keys are
+// recorded like [Engine.Clear], using the given path for the directory.
+func (x *Engine) clearBatches(ctx context.Context, dir directory.DirectorySubspace, path []string, schema keyval.Tuple) error {
+	prefix, err := convert.ToFDBTuple(constantTuplePrefix(schema))
+	if err != nil {
+		return errors.Wrap(err, "failed to convert prefix to FDB tuple")
+	}
+
+	rng, err := fdb.PrefixRange(dir.Pack(prefix))
+	if err != nil {
+		return errors.Wrap(err, "failed to create prefix range")
+	}
+	begin, end := rng.FDBRangeKeys()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var (
+			next fdb.Key
+			done bool
+		)
+		_, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+			x.log.Log().Strs("dir", dir.GetPath()).Interface("begin", begin).Msg("batch clearing")
+
+			kvs, err := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{
+				Limit: clearBatchKeys,
+			}).GetSliceWithError()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read keys")
+			}
+			done = len(kvs) < clearBatchKeys
+
+			var size int
+			for i, kv := range kvs {
+				tup, err := dir.Unpack(kv.Key)
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to unpack key")
+				}
+				if key := convert.FromFDBTuple(tup); compare.Tuples(schema, key) == nil {
+					if err := x.recordPrior(tr, path, key, kv.Key[len(dir.Bytes()):], kv.Value, nil); err != nil {
+						return nil, err
+					}
+					tr.Clear(kv.Key)
+					size += len(kv.Key)
+				}
+
+				next = append(fdb.Key{}, kv.Key...)
+				if size >= clearBatchBytes && i < len(kvs)-1 {
+					done = false
+					break
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "transaction failed")
+		}
+		if done {
+			return nil
+		}
+
+		// Resume from the first key after
+		// the last key read by the batch.
+		begin = append(next, 0x00)
+	}
+}
+
+// Atomic performs an atomic mutation on a single key-value. The given query must
+// belong to [class.Atomic]. The operand is packed using the Engine's byte order.
+// FDB interprets the operands of [keyval.AddOp], [keyval.MinOp], and [keyval.MaxOp]
+// as little-endian integers, so an error is returned if these operations are
+// performed by an Engine which isn't little-endian. The key's prior & new values
+// aren't read, so an error is returned if a [Journal] or [Indexes] are configured.
+func (x *Engine) Atomic(query keyval.KeyValue) error {
+	if class.Classify(query) != class.Atomic {
+		return errors.New("query not atomic class")
+	}
+	if x.journal != nil {
+		return errors.New("atomic mutations can't be journaled")
+	}
+	if len(x.indexes) > 0 {
+		return errors.New("atomic mutations can't maintain indexes")
+	}
+
+	atomic := query.Value.(keyval.Atomic)
+	switch atomic.Op {
+	case keyval.AddOp, keyval.MinOp, keyval.MaxOp:
+		if x.order != binary.LittleEndian {
+			return errors.Errorf("atomic '%s' requires a little-endian byte order", atomic.Op)
+		}
+	}
+
+	path, err := convert.ToStringArray(query.Key.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	operand, err := values.Pack(atomic.Operand, x.order)
+	if err != nil {
+		return errors.Wrap(err, "failed to pack operand")
+	}
+
+	_, err = x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Interface("query", query).Msg("mutating")
+
+		mutate, err := atomicMutation(tr, atomic.Op)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := tr.DirCreateOrOpen(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open directory")
+		}
+
+		tup, err := convert.ToFDBTuple(query.Key.Tuple)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+		}
+
+		mutate(dir.Pack(tup), operand)
+		return nil, nil
+	})
+	return errors.Wrap(err, "transaction failed")
+}
+
 // ReadSingle performs a read operation for a single key-value. The given query must
 // belong to [class.ReadSingle].
 func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.KeyValue, error) {
@@ -180,9 +767,11 @@ func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.Key
 	}
 
 	var valBytes []byte
-	_, err = x.tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+	_, err = x.transact(func(tx facade.Transaction) (interface{}, error) {
 		x.log.Log().Interface("query", query).Msg("single reading")
 
+		tr := readTransaction(tx, opts.ReadVersion, opts.Snapshot)
+
 		dir, err := tr.DirOpen(path)
 		if err != nil {
 			if errors.Is(err, directory.ErrDirNotExists) {
@@ -220,6 +809,98 @@ func (x *Engine) ReadSingle(query keyval.KeyValue, opts SingleOpts) (*keyval.Key
 // After an error occurs or the entire range is read, the returned channel is closed. If the provided context
 // is canceled, then the read operation will be stopped after the latest FDB call finishes.
 func (x *Engine) ReadRange(ctx context.Context, query keyval.KeyValue, opts RangeOpts) chan stream.KeyValErr {
+	return x.readRange(ctx, query, opts, true)
+}
+
+// Count returns the number of key-values matched by the given query, which must belong to [class.ReadRange].
+// Unless the query's value constrains the type of the values, the values are not deserialized. All the options
+// of [RangeOpts] are honored, so [RangeOpts.Limit] bounds the count.
+func (x *Engine) Count(ctx context.Context, query keyval.KeyValue, opts RangeOpts) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	decode := true
+	if v, ok := query.Value.(keyval.Variable); ok && len(v) == 0 {
+		decode = false
+	}
+
+	count := 0
+	for kve := range x.readRange(ctx, query, opts, decode) {
+		if kve.Err != nil {
+			return 0, kve.Err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// GroupBy groups the key-values matched by the given query by their directory & first n tuple elements,
+// returning the number of key-values & total value bytes of each group. Keys with fewer than n tuple
+// elements are grouped by their entire tuple. The groups are returned in the order they are read. Like
+// [Engine.Count], the values are only deserialized if the query's value constrains their type. The
+// query must belong to [class.ReadRange]. [RangeOpts.Distinct] is ignored. Indexes aren't used.
+func (x *Engine) GroupBy(ctx context.Context, query keyval.KeyValue, n int, opts RangeOpts) ([]Group, error) {
+	if n < 1 {
+		return nil, errors.Errorf("group size %d must be positive", n)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	decode := true
+	if v, ok := query.Value.(keyval.Variable); ok && len(v) == 0 {
+		decode = false
+	}
+	opts.Distinct = 0
+
+	// Keys sharing a prefix are read contiguously, so
+	// each group is complete once a new prefix is read.
+	// The range is always scanned to guarantee this.
+	scan := *x
+	scan.indexes = nil
+
+	var groups []Group
+	for kve := range scan.readRange(ctx, query, opts, decode) {
+		if kve.Err != nil {
+			return nil, kve.Err
+		}
+
+		size, err := valueSize(kve.KV.Value, x.order)
+		if err != nil {
+			return nil, err
+		}
+
+		key := kve.KV.Key
+		if len(key.Tuple) > n {
+			key.Tuple = key.Tuple[:n]
+		}
+		if last := len(groups) - 1; last >= 0 && groups[last].Key.Eq(key) {
+			groups[last].Count++
+			groups[last].Bytes += size
+			continue
+		}
+		groups = append(groups, Group{Key: key, Count: 1, Bytes: size})
+	}
+	return groups, nil
+}
+
+// valueSize returns the number of bytes the given value occupies in the DB.
+// Values which weren't deserialized are [keyval.Bytes] and are measured as
+// is. Otherwise, the value is packed to recover its size.
+func valueSize(value keyval.Value, order binary.ByteOrder) (int, error) {
+	if b, ok := value.(keyval.Bytes); ok {
+		return len(b), nil
+	}
+	packed, err := values.Pack(value, order)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to pack value")
+	}
+	return len(packed), nil
+}
+
+// readRange implements [Engine.ReadRange]. When decode is false, the values
+// are left as [keyval.Bytes] and aren't checked against the query's value.
+func (x *Engine) readRange(ctx context.Context, query keyval.KeyValue, opts RangeOpts, decode bool) chan stream.KeyValErr {
 	out := make(chan stream.KeyValErr)
 
 	go func() {
@@ -230,28 +911,317 @@ func (x *Engine) ReadRange(ctx context.Context, query keyval.KeyValue, opts Rang
 
 		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order))
 
-		if class.Classify(query) != class.ReadRange {
-			s.SendKV(out, stream.KeyValErr{Err: errors.New("query not range-read class")})
-			return
+		if class.Classify(query) == class.ReadRange {
+			if plan := x.plan(query, opts); plan.Index != "" {
+				x.log.Log().Str("index", plan.Index).Interface("lookup", plan.Lookup).Msg("reading via index")
+				if err := x.readIndex(ctx, s, out, plan, query, opts); err != nil {
+					s.SendKV(out, stream.KeyValErr{Err: err})
+				}
+				return
+			}
+			x.log.Log().Interface("query", query).Msg("reading via scan")
 		}
 
-		_, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
-			stage1 := s.OpenDirectories(tr, query.Key.Directory)
-			stage2 := s.ReadRange(tr, query.Key.Tuple, opts.forStream(), stage1)
-			stage3 := s.UnpackKeys(query.Key.Tuple, opts.Filter, stage2)
-			for kve := range s.UnpackValues(query.Value, opts.Filter, stage3) {
+		err := x.scanRange(ctx, s, query, opts, func(in chan stream.DirKVErr) {
+			kvs := s.UnpackKeys(query.Key.Tuple, opts.Filter, in)
+			if decode {
+				kvs = s.UnpackValues(query.Value, opts.Filter, kvs)
+			}
+			for kve := range kvs {
 				s.SendKV(out, kve)
 			}
-			return nil, nil
 		})
 		if err != nil {
-			s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "transaction failed")})
+			s.SendKV(out, stream.KeyValErr{Err: err})
 		}
 	}()
 
 	return out
 }
 
+// Audit performs a range-read, streaming each key-value which doesn't conform to the given query along with
+// the reason why. The given query must belong to [class.ReadRange]. [RangeOpts.Filter] is ignored. After an
+// error occurs or the entire range is read, the returned channel is closed. If the provided context is
+// canceled, then the read operation will be stopped after the latest FDB call finishes.
+func (x *Engine) Audit(ctx context.Context, query keyval.KeyValue, opts RangeOpts) chan stream.ViolationErr {
+	out := make(chan stream.ViolationErr)
+
+	go func() {
+		defer close(out)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order))
+
+		err := x.scanRange(ctx, s, query, opts, func(in chan stream.DirKVErr) {
+			for v := range s.Audit(query, in) {
+				s.SendViolation(out, v)
+			}
+		})
+		if err != nil {
+			s.SendViolation(out, stream.ViolationErr{Err: err})
+		}
+	}()
+
+	return out
+}
+
+// scanRange opens the directories matching the given query and reads the key-values
+// within them, passing the stream of raw key-values to the given function. The function
+// must drain the channel before returning. Errors which occur before the stream is
+// created are returned, while errors which occur during the stream are sent on it.
+func (x *Engine) scanRange(ctx context.Context, s stream.Stream, query keyval.KeyValue, opts RangeOpts, f func(chan stream.DirKVErr)) error {
+	if class.Classify(query) != class.ReadRange {
+		return errors.New("query not range-read class")
+	}
+
+	streamOpts, err := opts.forStream()
+	if err != nil {
+		return err
+	}
+
+	pipeline := func(tr facade.ReadTransactor, stage1 chan stream.DirErr) {
+		f(s.ReadRange(tr, query.Key.Tuple, streamOpts, stage1))
+	}
+
+	if opts.Resume {
+		if opts.ReadVersion != 0 {
+			return errors.New("resumable range-reads can't use a read version")
+		}
+
+		// The directories are opened up front so only the
+		// range-reads span multiple transactions.
+		dirs, err := x.openDirectories(ctx, query.Key.Directory)
+		if err != nil {
+			return err
+		}
+
+		pipeline(&readTransactor{eg: x, snapshot: opts.Snapshot}, sendDirectories(s, dirs))
+		return nil
+	}
+
+	_, err = x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		tr = readTransaction(tr, opts.ReadVersion, opts.Snapshot)
+		pipeline(tr, s.OpenDirectories(tr, query.Key.Directory))
+		return nil, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "transaction failed")
+	}
+	return nil
+}
+
+// readTransactor is a [facade.ReadTransactor] which applies the Engine's
+// transaction options to every transaction it creates. This allows stream
+// stages to create their own transactions.
+type readTransactor struct {
+	eg       *Engine
+	snapshot bool
+}
+
+var _ facade.ReadTransactor = &readTransactor{}
+
+func (x *readTransactor) ReadTransact(f func(facade.ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.eg.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		return f(readTransaction(tr, 0, x.snapshot))
+	})
+}
+
+func (x *readTransactor) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	return x.eg.tr.DirOpen(path)
+}
+
+func (x *readTransactor) DirList(path []string) ([]string, error) {
+	return x.eg.tr.DirList(path)
+}
+
+// Watch observes a single key-value over time. The given query must belong to [class.ReadSingle].
+// The current key-value is sent immediately and then again each time the value changes. If the
+// key doesn't exist or is cleared, a key-value with a [keyval.Clear] value is sent. If the key's
+// directory doesn't exist, it's polled until it's created. After an error occurs or the provided
+// context is canceled, the returned channel is closed.
+func (x *Engine) Watch(ctx context.Context, query keyval.KeyValue, opts SingleOpts) chan stream.KeyValErr {
+	out := make(chan stream.KeyValErr)
+
+	go func() {
+		defer close(out)
+
+		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order))
+
+		if class.Classify(query) != class.ReadSingle {
+			s.SendKV(out, stream.KeyValErr{Err: errors.New("query not single-read class")})
+			return
+		}
+
+		path, err := convert.ToStringArray(query.Key.Directory)
+		if err != nil {
+			s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "failed to convert directory to string array")})
+			return
+		}
+
+		tup, err := convert.ToFDBTuple(query.Key.Tuple)
+		if err != nil {
+			s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "failed to convert to FDB tuple")})
+			return
+		}
+
+		valHandler, err := internal.NewValueHandler(query.Value, x.order, opts.Filter)
+		if err != nil {
+			s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "failed to init value handler")})
+			return
+		}
+
+		var prev []byte
+		first := true
+
+		for {
+			var valBytes []byte
+			watch, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+				x.log.Log().Interface("query", query).Msg("watching")
+
+				dir, err := tr.DirOpen(path)
+				if err != nil {
+					// Without the directory, the key can't be watched,
+					// so the directory is polled until it's created.
+					if errors.Is(err, directory.ErrDirNotExists) {
+						return nil, nil
+					}
+					return nil, errors.Wrap(err, "failed to open directory")
+				}
+
+				key := dir.Pack(tup)
+				valBytes = tr.Get(key).MustGet()
+				return tr.Watch(key), nil
+			})
+			if err != nil {
+				s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "transaction failed")})
+				return
+			}
+
+			// A watch may fire even though the value
+			// ends up the same, so only changes are sent.
+			if first || !bytes.Equal(prev, valBytes) || (prev == nil) != (valBytes == nil) {
+				first = false
+				prev = valBytes
+
+				var value keyval.Value = keyval.Clear{}
+				if valBytes != nil {
+					value, err = valHandler.Handle(valBytes)
+					if err != nil {
+						s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "failed to unpack value")})
+						return
+					}
+				}
+				if value != nil && !s.SendKV(out, stream.KeyValErr{KV: keyval.KeyValue{Key: query.Key, Value: value}}) {
+					return
+				}
+			}
+
+			if watch == nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(dirPollInterval):
+				}
+				continue
+			}
+
+			if err := waitForWatch(ctx, watch.(fdb.FutureNil)); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.SendKV(out, stream.KeyValErr{Err: errors.Wrap(err, "failed to wait for watch")})
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// dirPollInterval is how often [Engine.Watch] checks
+// if the directory of the watched key has been created.
+const dirPollInterval = time.Second
+
+// waitForWatch blocks until the given watch becomes ready
+// or the given context is canceled. When the context is
+// canceled, the watch is also canceled.
+func waitForWatch(ctx context.Context, watch fdb.FutureNil) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			watch.Cancel()
+		case <-done:
+		}
+	}()
+
+	return watch.Get()
+}
+
+// CreateDirectory creates a directory tagged with the given layer. The given query must not
+// contain a [keyval.Variable]. If the directory already exists, an error is returned.
+func (x *Engine) CreateDirectory(query keyval.Directory, layer []byte) (directory.DirectorySubspace, error) {
+	path, err := convert.ToStringArray(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	dir, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Interface("query", query).Bytes("layer", layer).Msg("creating directory")
+		return tr.DirCreate(path, layer)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+// MoveDirectory moves a directory, and all of its subdirectories, to a new path. Neither of
+// the given queries may contain a [keyval.Variable].
+func (x *Engine) MoveDirectory(oldQuery keyval.Directory, newQuery keyval.Directory) (directory.DirectorySubspace, error) {
+	oldPath, err := convert.ToStringArray(oldQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert old directory to string array")
+	}
+
+	newPath, err := convert.ToStringArray(newQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert new directory to string array")
+	}
+
+	dir, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Interface("old", oldQuery).Interface("new", newQuery).Msg("moving directory")
+		return tr.DirMove(oldPath, newPath)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+// RemoveDirectory removes a directory, all of its subdirectories, and all of their contents.
+// The given query must not contain a [keyval.Variable]. If the directory doesn't exist, false
+// is returned.
+func (x *Engine) RemoveDirectory(query keyval.Directory) (bool, error) {
+	path, err := convert.ToStringArray(query)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	removed, err := x.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.log.Log().Interface("query", query).Msg("removing directory")
+		return tr.DirRemove(path)
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "transaction failed")
+	}
+	return removed.(bool), nil
+}
+
 // Directories reads directories from the directory layer. If the query contains a [keyval.Variable],
 // multiple directories may be returned. If the query doesn't contain a [keyval.Variable], at most a
 // single directory will be returned. After an error occurs or all directories have been read, the
@@ -268,7 +1238,7 @@ func (x *Engine) Directories(ctx context.Context, query keyval.Directory) chan s
 
 		s := stream.New(ctx, stream.Logger(x.log))
 
-		_, err := x.tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		_, err := x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
 			for dir := range s.OpenDirectories(tr, query) {
 				s.SendDir(out, dir)
 			}
@@ -281,3 +1251,191 @@ func (x *Engine) Directories(ctx context.Context, query keyval.Directory) chan s
 
 	return out
 }
+
+// Subtree opens the directories matching the given query along with all of their
+// subdirectories. The directories are returned in depth-first order, with each
+// directory preceding its subdirectories. All the directories are opened within
+// a single transaction.
+func (x *Engine) Subtree(ctx context.Context, query keyval.Directory) ([]directory.DirectorySubspace, error) {
+	roots, err := x.openDirectories(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transactor's paths are relative to its root directory, while the
+	// opened directories report absolute paths. Each element of the query
+	// matches a single element of the path, so the relative path consists
+	// of the last len(query) elements of the absolute path.
+	var dirs []directory.DirectorySubspace
+	var walk func(tr facade.ReadTransaction, dir directory.DirectorySubspace, path []string) error
+	walk = func(tr facade.ReadTransaction, dir directory.DirectorySubspace, path []string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+
+		names, err := tr.DirList(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list directory %v", path)
+		}
+		for _, name := range names {
+			subPath := append(append([]string{}, path...), name)
+			sub, err := tr.DirOpen(subPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to open directory %v", subPath)
+			}
+			if err := walk(tr, sub, subPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err = x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+		dirs = nil
+		for _, root := range roots {
+			path := root.GetPath()
+			if err := walk(tr, root, path[len(path)-len(query):]); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction failed")
+	}
+	return dirs, nil
+}
+
+// ReadDirectories reads every key-value within the given directories, without unpacking the keys or values. The
+// directories are read in the given order. [RangeOpts.Filter] is ignored. After an error occurs or the directories
+// are read, the returned channel is closed. If the provided context is canceled, then the read operation will be
+// stopped after the latest FDB call finishes.
+func (x *Engine) ReadDirectories(ctx context.Context, dirs []directory.DirectorySubspace, opts RangeOpts) chan stream.DirKVErr {
+	out := make(chan stream.DirKVErr)
+
+	go func() {
+		defer close(out)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		s := stream.New(ctx, stream.Logger(x.log), stream.ByteOrder(x.order))
+
+		streamOpts, err := opts.forStream()
+		if err != nil {
+			s.SendDirKV(out, stream.DirKVErr{Err: err})
+			return
+		}
+
+		read := func(tr facade.ReadTransactor) {
+			for msg := range s.ReadRange(tr, keyval.Tuple{}, streamOpts, sendDirectories(s, dirs)) {
+				s.SendDirKV(out, msg)
+			}
+		}
+
+		if opts.Resume {
+			if opts.ReadVersion != 0 {
+				s.SendDirKV(out, stream.DirKVErr{Err: errors.New("resumable range-reads can't use a read version")})
+				return
+			}
+			read(&readTransactor{eg: x, snapshot: opts.Snapshot})
+			return
+		}
+
+		_, err = x.readTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			read(readTransaction(tr, opts.ReadVersion, opts.Snapshot))
+			return nil, nil
+		})
+		if err != nil {
+			s.SendDirKV(out, stream.DirKVErr{Err: errors.Wrap(err, "transaction failed")})
+		}
+	}()
+
+	return out
+}
+
+// sendDirectories streams the given directories in a separate
+// goroutine, allowing already opened directories to be used
+// as the input of [stream.Stream.ReadRange].
+func sendDirectories(s stream.Stream, dirs []directory.DirectorySubspace) chan stream.DirErr {
+	out := make(chan stream.DirErr)
+	go func() {
+		defer close(out)
+		for _, dir := range dirs {
+			if !s.SendDir(out, stream.DirErr{Dir: dir}) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// readTransaction applies the given read version and snapshot
+// mode to the transaction. A version of zero is ignored.
+func readTransaction(tr facade.ReadTransaction, version int64, snapshot bool) facade.ReadTransaction {
+	if version != 0 {
+		tr.SetReadVersion(version)
+	}
+	if snapshot {
+		return tr.Snapshot()
+	}
+	return tr
+}
+
+// rangeClearPrefix returns the constant prefix of the given tuple if
+// the tuple is made up of constant elements followed by a MaybeMore.
+// In this case, every key with the prefix matches the tuple.
+func rangeClearPrefix(tup keyval.Tuple) (tuple.Tuple, bool) {
+	if len(tup) == 0 {
+		return nil, false
+	}
+	if _, ok := tup[len(tup)-1].(keyval.MaybeMore); !ok {
+		return nil, false
+	}
+	prefix, err := convert.ToFDBTuple(tup[:len(tup)-1])
+	if err != nil {
+		return nil, false
+	}
+	return prefix, true
+}
+
+// constantTuplePrefix returns the elements of the
+// given tuple preceding the first Variable,
+// Predicate, or MaybeMore.
+func constantTuplePrefix(tup keyval.Tuple) keyval.Tuple {
+	for i, element := range tup {
+		switch element.(type) {
+		case keyval.Variable, keyval.Predicate, keyval.MaybeMore:
+			return tup[:i]
+		}
+	}
+	return tup
+}
+
+func atomicMutation(tr facade.Transaction, op keyval.AtomicOp) (func(fdb.KeyConvertible, []byte), error) {
+	switch op {
+	case keyval.AddOp:
+		return tr.Add, nil
+	case keyval.BitAndOp:
+		return tr.BitAnd, nil
+	case keyval.BitOrOp:
+		return tr.BitOr, nil
+	case keyval.BitXorOp:
+		return tr.BitXor, nil
+	case keyval.MinOp:
+		return tr.Min, nil
+	case keyval.MaxOp:
+		return tr.Max, nil
+	case keyval.ByteMinOp:
+		return tr.ByteMin, nil
+	case keyval.ByteMaxOp:
+		return tr.ByteMax, nil
+	case keyval.CompareAndClearOp:
+		return tr.CompareAndClear, nil
+	case keyval.AppendIfFitsOp:
+		return tr.AppendIfFits, nil
+	default:
+		return nil, errors.Errorf("unexpected atomic op '%v'", op)
+	}
+}
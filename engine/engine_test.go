@@ -2,11 +2,15 @@ package engine
 
 import (
 	"context"
+	"encoding/binary"
 	"flag"
 	"testing"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 
@@ -94,6 +98,85 @@ func TestEngine_SetReadSingle(t *testing.T) {
 	})
 }
 
+func TestEngine_SetMany(t *testing.T) {
+	t.Run("batches", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var expected []q.KeyValue
+			for i := 0; i < 10; i++ {
+				dir := q.Directory{q.String("many"), q.String("even")}
+				if i%2 == 1 {
+					dir = q.Directory{q.String("many"), q.String("odd")}
+				}
+				expected = append(expected, q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Int(i)}}, Value: q.Int(i)})
+			}
+
+			var progress []LoadProgress
+			err := e.SetMany(expected, LoadOpts{
+				BatchKeys: 3,
+				Progress:  func(p LoadProgress) { progress = append(progress, p) },
+			})
+			require.NoError(t, err)
+			require.Len(t, progress, 4)
+			require.Equal(t, 10, progress[3].Keys)
+			require.Equal(t, 4, progress[3].Batches)
+
+			for _, kv := range expected {
+				query := kv
+				query.Value = q.Variable{q.IntType}
+				out, err := e.ReadSingle(query, SingleOpts{})
+				require.NoError(t, err)
+				require.NotNil(t, out)
+				require.Equal(t, kv.Value, out.Value)
+			}
+		})
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var queries []q.KeyValue
+			for i := 0; i < 4; i++ {
+				queries = append(queries, q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("big")}, Tuple: q.Tuple{q.Int(i)}}, Value: make(q.Bytes, 100)})
+			}
+
+			loader := e.NewLoader(LoadOpts{BatchBytes: 250})
+			for _, query := range queries {
+				require.NoError(t, loader.Set(query))
+			}
+			require.NoError(t, loader.Flush())
+			require.Equal(t, 2, loader.Progress().Batches)
+			require.Equal(t, 4, loader.Progress().Keys)
+		})
+	})
+
+	t.Run("clears before sets", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			key := q.Key{Directory: q.Directory{q.String("swap")}, Tuple: q.Tuple{q.Int(1)}}
+			require.NoError(t, e.Set(q.KeyValue{Key: key, Value: q.Int(1)}))
+
+			loader := e.NewLoader(LoadOpts{})
+			require.NoError(t, loader.Set(q.KeyValue{Key: key, Value: q.Int(2)}))
+			require.NoError(t, loader.Clear(q.KeyValue{Key: key, Value: q.Clear{}}))
+			require.NoError(t, loader.Flush())
+
+			out, err := e.ReadSingle(q.KeyValue{Key: key, Value: q.Variable{q.IntType}}, SingleOpts{})
+			require.NoError(t, err)
+			require.NotNil(t, out)
+			require.Equal(t, q.Int(2), out.Value)
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Int(1)}
+			err := e.SetMany([]q.KeyValue{query}, LoadOpts{})
+			require.Error(t, err)
+
+			err = e.NewLoader(LoadOpts{}).Clear(q.KeyValue{Key: query.Key, Value: q.Clear{}})
+			require.Error(t, err)
+		})
+	})
+}
+
 func TestEngine_Clear(t *testing.T) {
 	t.Run("set clear get", func(t *testing.T) {
 		testEnv(t, func(e Engine) {
@@ -131,6 +214,114 @@ func TestEngine_Clear(t *testing.T) {
 	})
 }
 
+func TestEngine_ClearRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    q.Tuple
+		initial  []q.Tuple
+		expected []q.Tuple
+	}{
+		{
+			name:  "prefix",
+			query: q.Tuple{q.String("a"), q.MaybeMore{}},
+			initial: []q.Tuple{
+				{q.String("a"), q.Int(1)},
+				{q.String("a"), q.Int(2), q.Int(3)},
+				{q.String("b"), q.Int(1)},
+			},
+			expected: []q.Tuple{
+				{q.String("b"), q.Int(1)},
+			},
+		},
+		{
+			name:  "batches",
+			query: q.Tuple{q.Variable{}, q.String("expired"), q.MaybeMore{}},
+			initial: []q.Tuple{
+				{q.Int(1), q.String("expired")},
+				{q.Int(1), q.String("valid")},
+				{q.Int(2), q.String("expired"), q.Int(7)},
+				{q.Int(3), q.String("valid")},
+			},
+			expected: []q.Tuple{
+				{q.Int(1), q.String("valid")},
+				{q.Int(3), q.String("valid")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testEnv(t, func(e Engine) {
+				dir := q.Directory{q.String("sessions")}
+				for _, tup := range test.initial {
+					err := e.Set(q.KeyValue{Key: q.Key{Directory: dir, Tuple: tup}, Value: q.Nil{}})
+					require.NoError(t, err)
+				}
+
+				query := q.KeyValue{Key: q.Key{Directory: dir, Tuple: test.query}, Value: q.Clear{}}
+				err := e.ClearRange(context.Background(), query)
+				require.NoError(t, err)
+
+				var results []q.Tuple
+				query = q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.MaybeMore{}}}, Value: q.Variable{}}
+				for kve := range e.ReadRange(context.Background(), query, RangeOpts{}) {
+					require.NoError(t, kve.Err)
+					results = append(results, kve.KV.Key.Tuple)
+				}
+				require.Equal(t, test.expected, results)
+			})
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Clear{}}
+			err := e.ClearRange(context.Background(), query)
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestEngine_Atomic(t *testing.T) {
+	t.Run("add and get", func(t *testing.T) {
+		internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+			e := New(tr, Logger(log), ByteOrder(binary.LittleEndian))
+			key := q.Key{Directory: q.Directory{q.String("counter")}, Tuple: q.Tuple{q.String("hits")}}
+
+			err := e.Set(q.KeyValue{Key: key, Value: q.Int(5)})
+			require.NoError(t, err)
+
+			err = e.Atomic(q.KeyValue{Key: key, Value: q.Atomic{Op: q.AddOp, Operand: q.Int(3)}})
+			require.NoError(t, err)
+
+			result, err := e.ReadSingle(q.KeyValue{Key: key, Value: q.Variable{q.IntType}}, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, &q.KeyValue{Key: key, Value: q.Int(8)}, result)
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)}}
+			err := e.Atomic(query)
+			require.Error(t, err)
+
+			query = q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Int(1)}
+			err = e.Atomic(query)
+			require.Error(t, err)
+
+			query = q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Atomic{Op: q.AddOp, Operand: q.Variable{}}}
+			err = e.Atomic(query)
+			require.Error(t, err)
+
+			// The engine is big-endian by default.
+			query = q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)}}
+			err = e.Atomic(query)
+			require.Error(t, err)
+		})
+	})
+}
+
 func TestEngine_ReadRange(t *testing.T) {
 	t.Run("set and get", func(t *testing.T) {
 		testEnv(t, func(e Engine) {
@@ -166,6 +357,99 @@ func TestEngine_ReadRange(t *testing.T) {
 		})
 	})
 
+	t.Run("resume", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var expected []q.KeyValue
+			for i := 0; i < 10; i++ {
+				kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("scan")}, Tuple: q.Tuple{q.Int(i)}}, Value: q.Bytes{}}
+				require.NoError(t, e.Set(kv))
+				expected = append(expected, kv)
+			}
+
+			var results []q.KeyValue
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("scan")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			for kve := range e.ReadRange(context.Background(), query, RangeOpts{Resume: true, BatchSize: 3}) {
+				require.NoError(t, kve.Err)
+				kve.KV.Key.Directory = kve.KV.Key.Directory[1:]
+				results = append(results, kve.KV)
+			}
+			require.Equal(t, expected, results)
+
+			msg := <-e.ReadRange(context.Background(), query, RangeOpts{Resume: true, ReadVersion: 1})
+			require.Error(t, msg.Err)
+		})
+	})
+
+	t.Run("distinct", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var expected []q.KeyValue
+			for _, tenant := range []string{"a", "b", "c"} {
+				for i := 0; i < 3; i++ {
+					kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("events")}, Tuple: q.Tuple{q.String(tenant), q.Int(i)}}, Value: q.Bytes{}}
+					require.NoError(t, e.Set(kv))
+					if i == 0 {
+						expected = append(expected, kv)
+					}
+				}
+			}
+
+			var results []q.KeyValue
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("events")}, Tuple: q.Tuple{q.Variable{q.StringType}, q.MaybeMore{}}}, Value: q.Variable{}}
+			for kve := range e.ReadRange(context.Background(), query, RangeOpts{Distinct: 1}) {
+				require.NoError(t, kve.Err)
+				kve.KV.Key.Directory = kve.KV.Key.Directory[1:]
+				results = append(results, kve.KV)
+			}
+			require.Equal(t, expected, results)
+		})
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			var expected []q.KeyValue
+			for _, dir := range []string{"a", "b", "c"} {
+				for i := 0; i < 3; i++ {
+					kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("pages"), q.String(dir)}, Tuple: q.Tuple{q.Int(i)}}, Value: q.Bytes{}}
+					require.NoError(t, e.Set(kv))
+					expected = append(expected, kv)
+				}
+			}
+
+			var (
+				results []q.KeyValue
+				pages   int
+				opts    = RangeOpts{Limit: 2, Paginate: true}
+			)
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("pages"), q.Variable{}}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			for {
+				var page []q.KeyValue
+				for kve := range e.ReadRange(context.Background(), query, opts) {
+					require.NoError(t, kve.Err)
+					page = append(page, kve.KV)
+				}
+				if len(page) == 0 {
+					break
+				}
+				pages++
+				require.LessOrEqual(t, len(page), opts.Limit)
+
+				var err error
+				opts.Cursor, err = Cursor(page[len(page)-1])
+				require.NoError(t, err)
+
+				for _, kv := range page {
+					kv.Key.Directory = kv.Key.Directory[1:]
+					results = append(results, kv)
+				}
+			}
+			require.Equal(t, expected, results)
+			require.Equal(t, 5, pages)
+
+			msg := <-e.ReadRange(context.Background(), query, RangeOpts{Cursor: "invalid"})
+			require.Error(t, msg.Err)
+		})
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		testEnv(t, func(e Engine) {
 			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Clear{}}
@@ -179,6 +463,154 @@ func TestEngine_ReadRange(t *testing.T) {
 	})
 }
 
+func TestEngine_Count(t *testing.T) {
+	t.Run("count", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			for i := 0; i < 5; i++ {
+				kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("count")}, Tuple: q.Tuple{q.Int(i)}}, Value: q.Int(i)}
+				require.NoError(t, e.Set(kv))
+			}
+			kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("count")}, Tuple: q.Tuple{q.String("str")}}, Value: q.String("str")}
+			require.NoError(t, e.Set(kv))
+
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("count")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			count, err := e.Count(context.Background(), query, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			require.Equal(t, 6, count)
+
+			query.Key.Tuple = q.Tuple{q.Variable{q.IntType}}
+			count, err = e.Count(context.Background(), query, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			require.Equal(t, 5, count)
+
+			query.Key.Tuple = q.Tuple{q.Variable{}}
+			query.Value = q.Variable{q.IntType}
+			count, err = e.Count(context.Background(), query, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			require.Equal(t, 5, count)
+
+			query.Value = q.Variable{}
+			count, err = e.Count(context.Background(), query, RangeOpts{Limit: 2})
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Float(32.33)}}, Value: q.Clear{}}
+			_, err := e.Count(context.Background(), query, RangeOpts{})
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestEngine_GroupBy(t *testing.T) {
+	t.Run("group", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			dir := q.Directory{q.String("group")}
+			for i, tenant := range []string{"a", "b"} {
+				for j := 0; j <= i; j++ {
+					kv := q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String(tenant), q.Int(j)}}, Value: q.Bytes("hello")}
+					require.NoError(t, e.Set(kv))
+				}
+			}
+			kv := q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("c")}}, Value: q.Int(1)}
+			require.NoError(t, e.Set(kv))
+
+			query := q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Variable{}, q.MaybeMore{}}}, Value: q.Variable{}}
+			groups, err := e.GroupBy(context.Background(), query, 1, RangeOpts{})
+			require.NoError(t, err)
+			for i := range groups {
+				groups[i].Key.Directory = groups[i].Key.Directory[1:]
+			}
+			require.Equal(t, []Group{
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("a")}}, Count: 1, Bytes: 5},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("b")}}, Count: 2, Bytes: 10},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("c")}}, Count: 1, Bytes: 8},
+			}, groups)
+
+			groups, err = e.GroupBy(context.Background(), query, 2, RangeOpts{Reverse: true})
+			require.NoError(t, err)
+			for i := range groups {
+				groups[i].Key.Directory = groups[i].Key.Directory[1:]
+			}
+			require.Equal(t, []Group{
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("c")}}, Count: 1, Bytes: 8},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("b"), q.Int(1)}}, Count: 1, Bytes: 5},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("b"), q.Int(0)}}, Count: 1, Bytes: 5},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("a"), q.Int(0)}}, Count: 1, Bytes: 5},
+			}, groups)
+
+			query.Value = q.Variable{q.IntType}
+			groups, err = e.GroupBy(context.Background(), query, 1, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			for i := range groups {
+				groups[i].Key.Directory = groups[i].Key.Directory[1:]
+			}
+			require.Equal(t, []Group{
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("c")}}, Count: 1, Bytes: 8},
+			}, groups)
+		})
+	})
+
+	t.Run("index", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			dir := q.Directory{q.String("group")}
+			source := q.KeyValue{
+				Key:   q.Key{Directory: dir, Tuple: q.Tuple{q.Variable{q.StringType}, q.Variable{q.IntType}}},
+				Value: q.Variable{q.BytesType},
+			}
+			template := q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("by_id")}, Tuple: q.Tuple{q.Reference("id"), q.Reference("tenant")}},
+				Value: q.Nil{},
+			}
+			index, err := NewIndex("by_id", source, []string{"tenant", "id", ""}, template)
+			require.NoError(t, err)
+			Indexes(index)(&e)
+
+			for _, tenant := range []string{"b", "a"} {
+				for j := 0; j < 2; j++ {
+					kv := q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String(tenant), q.Int(j)}}, Value: q.Bytes("hello")}
+					require.NoError(t, e.Set(kv))
+				}
+			}
+
+			// A range-read of this query would be answered
+			// via the index, but groups are always scanned.
+			query := q.KeyValue{
+				Key:   q.Key{Directory: dir, Tuple: q.Tuple{q.Variable{q.StringType}, q.Int(0)}},
+				Value: q.Variable{q.BytesType},
+			}
+			plan, err := e.Explain(query, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			require.Equal(t, "by_id", plan.Index)
+
+			groups, err := e.GroupBy(context.Background(), query, 1, RangeOpts{Filter: true})
+			require.NoError(t, err)
+			for i := range groups {
+				groups[i].Key.Directory = groups[i].Key.Directory[1:]
+			}
+			require.Equal(t, []Group{
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("a")}}, Count: 1, Bytes: 5},
+				{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("b")}}, Count: 1, Bytes: 5},
+			}, groups)
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			_, err := e.GroupBy(context.Background(), query, 0, RangeOpts{})
+			require.Error(t, err)
+
+			query.Value = q.Clear{}
+			_, err = e.GroupBy(context.Background(), query, 1, RangeOpts{})
+			require.Error(t, err)
+		})
+	})
+}
+
 func TestEngine_Directories(t *testing.T) {
 	t.Run("created and open", func(t *testing.T) {
 		internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
@@ -207,6 +639,510 @@ func TestEngine_Directories(t *testing.T) {
 	})
 }
 
+func TestEngine_Subtree(t *testing.T) {
+	t.Run("read subtree", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			for _, path := range []q.Directory{
+				{q.String("tree"), q.String("a")},
+				{q.String("tree"), q.String("a"), q.String("x")},
+				{q.String("tree"), q.String("b")},
+				{q.String("other")},
+			} {
+				kv := q.KeyValue{Key: q.Key{Directory: path, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(1)}
+				require.NoError(t, e.Set(kv))
+			}
+
+			dirs, err := e.Subtree(context.Background(), q.Directory{q.String("tree"), q.Variable{}})
+			require.NoError(t, err)
+
+			var paths [][]string
+			for _, dir := range dirs {
+				paths = append(paths, dir.GetPath()[1:])
+			}
+			require.Equal(t, [][]string{{"tree", "a"}, {"tree", "a", "x"}, {"tree", "b"}}, paths)
+
+			var read [][]string
+			for msg := range e.ReadDirectories(context.Background(), dirs, RangeOpts{}) {
+				require.NoError(t, msg.Err)
+				read = append(read, msg.Dir.GetPath()[1:])
+			}
+			require.Equal(t, paths, read)
+		})
+	})
+}
+
+func TestEngine_Watch(t *testing.T) {
+	t.Run("changes", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			key := q.Key{Directory: q.Directory{q.String("flags")}, Tuple: q.Tuple{q.String("enabled")}}
+
+			err := e.Set(q.KeyValue{Key: key, Value: q.Int(1)})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			out := e.Watch(ctx, q.KeyValue{Key: key, Value: q.Variable{q.IntType}}, SingleOpts{})
+
+			msg := <-out
+			require.NoError(t, msg.Err)
+			require.Equal(t, q.KeyValue{Key: key, Value: q.Int(1)}, msg.KV)
+
+			err = e.Set(q.KeyValue{Key: key, Value: q.Int(2)})
+			require.NoError(t, err)
+
+			msg = <-out
+			require.NoError(t, msg.Err)
+			require.Equal(t, q.KeyValue{Key: key, Value: q.Int(2)}, msg.KV)
+
+			err = e.Clear(q.KeyValue{Key: key, Value: q.Clear{}})
+			require.NoError(t, err)
+
+			msg = <-out
+			require.NoError(t, msg.Err)
+			require.Equal(t, q.KeyValue{Key: key, Value: q.Clear{}}, msg.KV)
+
+			cancel()
+			for range out {
+			}
+		})
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			key := q.Key{Directory: q.Directory{q.String("missing")}, Tuple: q.Tuple{q.String("enabled")}}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			out := e.Watch(ctx, q.KeyValue{Key: key, Value: q.Variable{q.IntType}}, SingleOpts{})
+
+			msg := <-out
+			require.NoError(t, msg.Err)
+			require.Equal(t, q.KeyValue{Key: key, Value: q.Clear{}}, msg.KV)
+
+			err := e.Set(q.KeyValue{Key: key, Value: q.Int(1)})
+			require.NoError(t, err)
+
+			msg = <-out
+			require.NoError(t, msg.Err)
+			require.Equal(t, q.KeyValue{Key: key, Value: q.Int(1)}, msg.KV)
+
+			cancel()
+			for range out {
+			}
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testEnv(t, func(e Engine) {
+			query := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("hi")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Variable{}}
+			msg := <-e.Watch(context.Background(), query, SingleOpts{})
+			require.Error(t, msg.Err)
+		})
+	})
+}
+
+func TestEngine_ReadVersion(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		key := q.Key{Directory: q.Directory{q.String("versioned")}, Tuple: q.Tuple{q.String("key")}}
+
+		_, versions, err := e.TransactVersions(func(e Engine) (interface{}, error) {
+			return nil, e.Set(q.KeyValue{Key: key, Value: q.Int(1)})
+		})
+		require.NoError(t, err)
+		require.Greater(t, versions.Commit, versions.Read)
+
+		version, err := e.ReadVersion()
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, version, versions.Commit)
+
+		err = e.Set(q.KeyValue{Key: key, Value: q.Int(2)})
+		require.NoError(t, err)
+
+		query := q.KeyValue{Key: key, Value: q.Variable{q.IntType}}
+
+		result, err := e.ReadSingle(query, SingleOpts{ReadVersion: version, Snapshot: true})
+		require.NoError(t, err)
+		require.Equal(t, &q.KeyValue{Key: key, Value: q.Int(1)}, result)
+
+		result, err = e.ReadSingle(query, SingleOpts{})
+		require.NoError(t, err)
+		require.Equal(t, &q.KeyValue{Key: key, Value: q.Int(2)}, result)
+
+		_, versions, err = e.TransactVersions(func(e Engine) (interface{}, error) {
+			return e.ReadSingle(query, SingleOpts{})
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), versions.Commit)
+	})
+}
+
+func TestEngine_TransactionOptions(t *testing.T) {
+	t.Run("applied", func(t *testing.T) {
+		internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+			e := New(tr, Logger(log),
+				Timeout(5*time.Second),
+				RetryLimit(3),
+				MaxRetryDelay(100*time.Millisecond),
+				Priority(facade.BatchPriority))
+
+			kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("opts")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(2)}
+			require.NoError(t, e.Set(kv))
+
+			result, err := e.ReadSingle(q.KeyValue{Key: kv.Key, Value: q.Variable{q.IntType}}, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, &kv, result)
+		})
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
+			e := New(tr, Logger(log), SizeLimit(32))
+
+			kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("opts")}, Tuple: q.Tuple{q.Int(1)}}, Value: make(q.Bytes, 1000)}
+			require.Error(t, e.Set(kv))
+		})
+	})
+}
+
+func TestEngine_CreateMoveRemoveDirectory(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		dir, err := e.CreateDirectory(q.Directory{q.String("old"), q.String("path")}, []byte("layer"))
+		require.NoError(t, err)
+		require.Equal(t, []string{"old", "path"}, dir.GetPath())
+		require.Equal(t, []byte("layer"), dir.GetLayer())
+
+		_, err = e.CreateDirectory(q.Directory{q.String("old"), q.String("path")}, nil)
+		require.Error(t, err)
+
+		_, err = e.CreateDirectory(q.Directory{q.String("old"), q.Variable{}}, nil)
+		require.Error(t, err)
+
+		moved, err := e.MoveDirectory(q.Directory{q.String("old"), q.String("path")}, q.Directory{q.String("new")})
+		require.NoError(t, err)
+		require.Equal(t, []string{"new"}, moved.GetPath())
+		require.Equal(t, dir.Bytes(), moved.Bytes())
+
+		removed, err := e.RemoveDirectory(q.Directory{q.String("new")})
+		require.NoError(t, err)
+		require.True(t, removed)
+
+		removed, err = e.RemoveDirectory(q.Directory{q.String("new")})
+		require.NoError(t, err)
+		require.False(t, removed)
+	})
+}
+
+func TestEngine_Journal(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		var entries []JournalEntry
+		Journal(func(entry JournalEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})(&e)
+
+		key := q.Key{Directory: q.Directory{q.String("journal")}, Tuple: q.Tuple{q.Int(1)}}
+		require.NoError(t, e.Set(q.KeyValue{Key: key, Value: q.Bytes{0x01}}))
+		require.NoError(t, e.Set(q.KeyValue{Key: key, Value: q.Bytes{0x02}}))
+		require.NoError(t, e.Clear(q.KeyValue{Key: key, Value: q.Clear{}}))
+
+		packed := tuple.Tuple{int64(1)}.Pack()
+		require.Equal(t, []JournalEntry{
+			{Dir: []string{"journal"}, Key: packed, Value: nil},
+			{Dir: []string{"journal"}, Key: packed, Value: []byte{0x01}},
+			{Dir: []string{"journal"}, Key: packed, Value: []byte{0x02}},
+		}, entries)
+
+		entries = nil
+		others := []q.KeyValue{
+			{Key: q.Key{Directory: key.Directory, Tuple: q.Tuple{q.Int(2)}}, Value: q.Bytes{0x04}},
+			{Key: q.Key{Directory: key.Directory, Tuple: q.Tuple{q.Int(3)}}, Value: q.Bytes{0x05}},
+		}
+		require.NoError(t, e.SetMany(others, LoadOpts{}))
+		require.NoError(t, e.ClearRange(context.Background(), q.KeyValue{Key: q.Key{Directory: key.Directory, Tuple: q.Tuple{q.MaybeMore{}}}, Value: q.Clear{}}))
+		require.Error(t, e.Atomic(q.KeyValue{Key: key, Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)}}))
+
+		packed2, packed3 := tuple.Tuple{int64(2)}.Pack(), tuple.Tuple{int64(3)}.Pack()
+		require.Equal(t, []JournalEntry{
+			{Dir: []string{"journal"}, Key: packed2, Value: nil},
+			{Dir: []string{"journal"}, Key: packed3, Value: nil},
+			{Dir: []string{"journal"}, Key: packed2, Value: []byte{0x04}},
+			{Dir: []string{"journal"}, Key: packed3, Value: []byte{0x05}},
+		}, entries)
+
+		Journal(func(JournalEntry) error {
+			return errors.New("journal failed")
+		})(&e)
+		require.Error(t, e.Set(q.KeyValue{Key: key, Value: q.Bytes{0x03}}))
+
+		result, err := e.ReadSingle(q.KeyValue{Key: key, Value: q.Variable{}}, SingleOpts{})
+		require.NoError(t, err)
+		require.Nil(t, result)
+	})
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		var writes []facade.Write
+		dry := e.DryRun(func(w facade.Write) {
+			writes = append(writes, w)
+		})
+
+		kv := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("dry")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Bytes{0xff}}
+		_, err := dry.Transact(func(e Engine) (interface{}, error) {
+			if err := e.Set(kv); err != nil {
+				return nil, err
+			}
+
+			// Reads observe the writes of the transaction.
+			get := kv
+			get.Value = q.Variable{}
+			result, err := e.ReadSingle(get, SingleOpts{})
+			require.NoError(t, err)
+			require.Equal(t, &kv, result)
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		require.Len(t, writes, 2)
+		require.Equal(t, facade.CreateDirOp, writes[0].Op)
+		require.Equal(t, facade.SetOp, writes[1].Op)
+		require.Equal(t, writes[0].Dir, writes[1].Dir)
+		require.Equal(t, writes[0].Prefix, writes[1].Prefix)
+		require.Equal(t, []byte{0xff}, writes[1].Param)
+
+		// Nothing was committed.
+		get := kv
+		get.Value = q.Variable{}
+		result, err := e.ReadSingle(get, SingleOpts{})
+		require.NoError(t, err)
+		require.Nil(t, result)
+	})
+}
+
+func TestEngine_Index(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		source := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{q.IntType}, q.Variable{q.StringType}}},
+			Value: q.Variable{q.IntType},
+		}
+		template := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.Reference("last"), q.Reference("id")}},
+			Value: q.Nil{},
+		}
+		index, err := NewIndex("last_name", source, []string{"id", "last", "age"}, template)
+		require.NoError(t, err)
+		Indexes(index)(&e)
+
+		person := func(id int64, last string) q.KeyValue {
+			return q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(id), q.String(last)}},
+				Value: q.Int(30),
+			}
+		}
+		entries := func() []q.KeyValue {
+			query := q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.Variable{}, q.Variable{}}},
+				Value: q.Variable{},
+			}
+			var out []q.KeyValue
+			for msg := range e.ReadRange(context.Background(), query, RangeOpts{}) {
+				require.NoError(t, msg.Err)
+				out = append(out, msg.KV)
+			}
+			return out
+		}
+		entry := func(id int64, last string) q.KeyValue {
+			return q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.String(last), q.Int(id)}},
+				Value: q.Bytes{},
+			}
+		}
+
+		require.NoError(t, e.Set(person(1, "smith")))
+		require.NoError(t, e.Set(person(2, "jones")))
+		require.Equal(t, []q.KeyValue{entry(2, "jones"), entry(1, "smith")}, entries())
+
+		clear := person(1, "smith")
+		clear.Value = q.Clear{}
+		require.NoError(t, e.Clear(clear))
+		require.Equal(t, []q.KeyValue{entry(2, "jones")}, entries())
+
+		// Values which don't match the schema aren't indexed.
+		invalid := person(3, "brown")
+		invalid.Value = q.String("thirty")
+		require.NoError(t, e.Set(invalid))
+		require.Equal(t, []q.KeyValue{entry(2, "jones")}, entries())
+
+		require.NoError(t, e.ClearIndex(context.Background(), index))
+		require.Empty(t, entries())
+
+		require.NoError(t, e.Reindex(context.Background(), index, RangeOpts{}, LoadOpts{}))
+		require.Equal(t, []q.KeyValue{entry(2, "jones")}, entries())
+
+		// Writes via a Loader & range clears also maintain the entries.
+		require.NoError(t, e.SetMany([]q.KeyValue{person(4, "adams"), person(5, "baker")}, LoadOpts{}))
+		require.Equal(t, []q.KeyValue{entry(4, "adams"), entry(5, "baker"), entry(2, "jones")}, entries())
+
+		rangeClear := q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{}, q.String("adams")}}, Value: q.Clear{}}
+		require.NoError(t, e.ClearRange(context.Background(), rangeClear))
+		require.Equal(t, []q.KeyValue{entry(5, "baker"), entry(2, "jones")}, entries())
+
+		rangeClear.Key.Tuple = q.Tuple{q.Int(5), q.MaybeMore{}}
+		require.NoError(t, e.ClearRange(context.Background(), rangeClear))
+		require.Equal(t, []q.KeyValue{entry(2, "jones")}, entries())
+
+		require.Error(t, e.Atomic(q.KeyValue{Key: person(2, "jones").Key, Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)}}))
+	})
+}
+
+func TestEngine_Plan(t *testing.T) {
+	testEnv(t, func(e Engine) {
+		source := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{q.IntType}, q.Variable{q.StringType}}},
+			Value: q.Variable{q.IntType},
+		}
+		template := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.Reference("last"), q.Reference("id")}},
+			Value: q.Nil{},
+		}
+		index, err := NewIndex("last_name", source, []string{"id", "last", ""}, template)
+		require.NoError(t, err)
+		Indexes(index)(&e)
+
+		people := []q.KeyValue{
+			{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(1), q.String("smith")}}, Value: q.Int(30)},
+			{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(2), q.String("jones")}}, Value: q.Int(40)},
+			{Key: q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(3), q.String("jones")}}, Value: q.Int(50)},
+		}
+		for _, kv := range people {
+			require.NoError(t, e.Set(kv))
+		}
+
+		// This key doesn't conform to the source schema,
+		// so it has no index entry.
+		other := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.String("x"), q.String("jones")}},
+			Value: q.Int(60),
+		}
+		require.NoError(t, e.Set(other))
+
+		byLast := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{q.IntType}, q.String("jones")}},
+			Value: q.Variable{q.IntType},
+		}
+		plan, err := e.Explain(byLast, RangeOpts{Filter: true})
+		require.NoError(t, err)
+		require.Equal(t, "last_name", plan.Index)
+		require.Equal(t, q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.String("jones"), q.Variable{}}},
+			Value: q.Variable{},
+		}, plan.Lookup)
+
+		read := func(query q.KeyValue, opts RangeOpts) []q.KeyValue {
+			var actual []q.KeyValue
+			for msg := range e.ReadRange(context.Background(), query, opts) {
+				require.NoError(t, msg.Err)
+				msg.KV.Key.Directory = msg.KV.Key.Directory[1:]
+				actual = append(actual, msg.KV)
+			}
+			return actual
+		}
+		require.Equal(t, people[1:], read(byLast, RangeOpts{Filter: true}))
+		require.Equal(t, people[1:2], read(byLast, RangeOpts{Filter: true, Limit: 1}))
+
+		// Queries which may match keys outside the source
+		// schema are answered by scanning, so keys without
+		// an index entry are still returned.
+		anyID := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{}, q.String("jones")}},
+			Value: q.Variable{q.IntType},
+		}
+		plan, err = e.Explain(anyID, RangeOpts{Filter: true})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+		// Strings are ordered before integers.
+		require.Equal(t, []q.KeyValue{other, people[1], people[2]}, read(anyID, RangeOpts{Filter: true}))
+
+		anyValue := q.KeyValue{Key: byLast.Key, Value: q.Variable{}}
+		plan, err = e.Explain(anyValue, RangeOpts{Filter: true})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+
+		moreKeys := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{q.IntType}, q.String("jones"), q.MaybeMore{}}},
+			Value: q.Variable{q.IntType},
+		}
+		plan, err = e.Explain(moreKeys, RangeOpts{Filter: true})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+
+		// Queries which constrain the leading element
+		// of the key are answered by scanning.
+		byID := q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Int(1), q.Variable{q.StringType}}},
+			Value: q.Variable{q.IntType},
+		}
+		plan, err = e.Explain(byID, RangeOpts{Filter: true})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+
+		// Strict & reverse reads aren't answered by indexes.
+		plan, err = e.Explain(byLast, RangeOpts{})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+
+		plan, err = e.Explain(byLast, RangeOpts{Filter: true, Reverse: true})
+		require.NoError(t, err)
+		require.Empty(t, plan.Index)
+	})
+}
+
+func TestNewIndex(t *testing.T) {
+	source := q.KeyValue{
+		Key:   q.Key{Directory: q.Directory{q.String("people")}, Tuple: q.Tuple{q.Variable{q.IntType}}},
+		Value: q.Variable{},
+	}
+	template := q.KeyValue{
+		Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.Reference("id")}},
+		Value: q.Nil{},
+	}
+
+	tests := []struct {
+		name     string
+		source   q.KeyValue
+		names    []string
+		template q.KeyValue
+		err      bool
+	}{
+		{name: "valid", source: source, names: []string{"id", ""}, template: template},
+		{name: "constant source", source: template, names: nil, template: template, err: true},
+		{name: "unknown reference", source: source, names: []string{"other", ""}, template: template, err: true},
+		{
+			name:   "variable template",
+			source: source,
+			names:  []string{"id", ""},
+			template: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("index")}, Tuple: q.Tuple{q.Variable{}}},
+				Value: q.Nil{},
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewIndex("index", test.source, test.names, test.template)
+			if test.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
 func testEnv(t *testing.T, f func(Engine)) {
 	internal.TestEnv(t, force, func(tr facade.Transactor, log zerolog.Logger) {
 		f(New(tr, Logger(log)))
@@ -0,0 +1,456 @@
+package facade
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+)
+
+// WriteOp identifies the kind of mutation described by a Write.
+type WriteOp string
+
+const (
+	SetOp             WriteOp = "set"
+	ClearOp           WriteOp = "clear"
+	ClearRangeOp      WriteOp = "clear_range"
+	AddOp             WriteOp = "add"
+	BitAndOp          WriteOp = "bit_and"
+	BitOrOp           WriteOp = "bit_or"
+	BitXorOp          WriteOp = "bit_xor"
+	MinOp             WriteOp = "min"
+	MaxOp             WriteOp = "max"
+	ByteMinOp         WriteOp = "byte_min"
+	ByteMaxOp         WriteOp = "byte_max"
+	CompareAndClearOp WriteOp = "compare_and_clear"
+	AppendIfFitsOp    WriteOp = "append_if_fits"
+	CreateDirOp       WriteOp = "create_dir"
+	MoveDirOp         WriteOp = "move_dir"
+	RemoveDirOp       WriteOp = "remove_dir"
+)
+
+// Write describes a mutation performed by a transaction
+// created via a Transactor from NewDryRunTransactor.
+type Write struct {
+	Op WriteOp
+
+	// Dir is the path of the directory containing the Key.
+	// For directory operations, it's the path of the directory
+	// being operated on. Dir is nil if the directory containing
+	// the Key wasn't opened during the dry run.
+	Dir []string
+
+	// Prefix is the key prefix of Dir. The prefix of a directory
+	// created during the dry run may differ from the prefix the
+	// directory would be allocated if the writes were committed.
+	Prefix []byte
+
+	// Key is the full key being written, including the Prefix.
+	// For ClearRangeOp, it's the beginning of the range and
+	// End is the exclusive end of the range.
+	Key []byte
+	End []byte
+
+	// Param is the value of a SetOp or the
+	// parameter of an atomic mutation.
+	Param []byte
+
+	// OldDir is the previous path of a MoveDirOp.
+	OldDir []string
+}
+
+// String describes the Write on a single line. Byte strings
+// are printed as hex.
+func (x Write) String() string {
+	var b strings.Builder
+	b.WriteString(string(x.Op))
+
+	if x.OldDir != nil {
+		b.WriteString(" " + dirString(x.OldDir) + " ->")
+	}
+	if x.Dir != nil {
+		b.WriteString(" " + dirString(x.Dir))
+	}
+	if x.Prefix != nil {
+		b.WriteString(" prefix=" + hex.EncodeToString(x.Prefix))
+	}
+	if x.Key != nil {
+		b.WriteString(" key=" + hex.EncodeToString(x.Key))
+	}
+	if x.End != nil {
+		b.WriteString(" end=" + hex.EncodeToString(x.End))
+	}
+	if x.Param != nil {
+		b.WriteString(" value=" + hex.EncodeToString(x.Param))
+	}
+	return b.String()
+}
+
+func dirString(path []string) string {
+	return "/" + strings.Join(path, "/")
+}
+
+// errDryRun is returned by the function passed to the underlying
+// Transactor so the transaction is aborted instead of committed.
+var errDryRun = errors.New("dry run")
+
+type (
+	// dryRunState is shared by a dryRunTransactor and the
+	// transactions it creates. It tracks the directories
+	// opened during the dry run so written keys can be
+	// attributed to their directory.
+	dryRunState struct {
+		report func(Write)
+
+		mu   sync.Mutex
+		dirs map[string]directory.DirectorySubspace
+	}
+
+	dryRunTransactor struct {
+		tr    Transactor
+		state *dryRunState
+	}
+
+	dryRunReadTransaction struct {
+		ReadTransaction
+		state *dryRunState
+	}
+
+	dryRunTransaction struct {
+		Transaction
+		state  *dryRunState
+		writes []Write
+	}
+)
+
+var (
+	_ Transactor      = &dryRunTransactor{}
+	_ ReadTransaction = &dryRunReadTransaction{}
+	_ Transaction     = &dryRunTransaction{}
+)
+
+// NewDryRunTransactor wraps the given Transactor so its transactions are
+// aborted instead of committed. Reads are performed as usual and observe
+// the writes made earlier in the same transaction. If a transaction's
+// function succeeds, each of its writes is passed to the report function
+// before the transaction is aborted. The given Transactor must not be
+// backed by a transaction, as that transaction would not be aborted.
+func NewDryRunTransactor(tr Transactor, report func(Write)) Transactor {
+	return &dryRunTransactor{
+		tr: tr,
+		state: &dryRunState{
+			report: report,
+			dirs:   make(map[string]directory.DirectorySubspace),
+		},
+	}
+}
+
+func (x *dryRunState) addDir(dir directory.DirectorySubspace) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.dirs[string(dir.Bytes())] = dir
+}
+
+// resolve returns the opened directory with the longest
+// prefix of the given key, or nil if there isn't one.
+func (x *dryRunState) resolve(key fdb.Key) directory.DirectorySubspace {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var out directory.DirectorySubspace
+	for prefix, dir := range x.dirs {
+		if !bytes.HasPrefix(key, []byte(prefix)) {
+			continue
+		}
+		if out == nil || len(prefix) > len(out.Bytes()) {
+			out = dir
+		}
+	}
+	return out
+}
+
+func (x *dryRunTransactor) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return x.tr.ReadTransact(func(tr ReadTransaction) (interface{}, error) {
+		return f(&dryRunReadTransaction{tr, x.state})
+	})
+}
+
+func (x *dryRunTransactor) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.tr.DirOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	x.state.addDir(dir)
+	return dir, nil
+}
+
+func (x *dryRunTransactor) DirList(path []string) ([]string, error) {
+	return x.tr.DirList(path)
+}
+
+func (x *dryRunTransactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	var (
+		out    interface{}
+		writes []Write
+	)
+	_, err := x.tr.Transact(func(tr Transaction) (interface{}, error) {
+		// If the transaction is retried, the
+		// writes of the failed attempt are
+		// discarded along with the attempt.
+		txn := &dryRunTransaction{Transaction: tr, state: x.state}
+
+		var err error
+		out, err = f(txn)
+		if err != nil {
+			return nil, err
+		}
+		writes = txn.writes
+		return nil, errDryRun
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	for _, write := range writes {
+		x.state.report(write)
+	}
+	return out, nil
+}
+
+func (x *dryRunTransactor) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.Transact(func(tr Transaction) (interface{}, error) {
+		return tr.DirCreateOrOpen(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+func (x *dryRunTransactor) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	dir, err := x.Transact(func(tr Transaction) (interface{}, error) {
+		return tr.DirCreate(path, layer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+func (x *dryRunTransactor) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	dir, err := x.Transact(func(tr Transaction) (interface{}, error) {
+		return tr.DirMove(oldPath, newPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dir.(directory.DirectorySubspace), nil
+}
+
+func (x *dryRunTransactor) DirRemove(path []string) (bool, error) {
+	removed, err := x.Transact(func(tr Transaction) (interface{}, error) {
+		return tr.DirRemove(path)
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed.(bool), nil
+}
+
+func (x *dryRunReadTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return f(x)
+}
+
+func (x *dryRunReadTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.ReadTransaction.DirOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	x.state.addDir(dir)
+	return dir, nil
+}
+
+func (x *dryRunReadTransaction) Snapshot() ReadTransaction {
+	return &dryRunReadTransaction{x.ReadTransaction.Snapshot(), x.state}
+}
+
+func (x *dryRunTransaction) ReadTransact(f func(ReadTransaction) (interface{}, error)) (interface{}, error) {
+	return f(x)
+}
+
+func (x *dryRunTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
+	return f(x)
+}
+
+func (x *dryRunTransaction) DirOpen(path []string) (directory.DirectorySubspace, error) {
+	dir, err := x.Transaction.DirOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	x.state.addDir(dir)
+	return dir, nil
+}
+
+func (x *dryRunTransaction) Snapshot() ReadTransaction {
+	return &dryRunReadTransaction{x.Transaction.Snapshot(), x.state}
+}
+
+func (x *dryRunTransaction) DirCreateOrOpen(path []string) (directory.DirectorySubspace, error) {
+	// The directory is opened first so the
+	// creation is only reported if the
+	// directory doesn't exist.
+	dir, err := x.DirOpen(path)
+	if err == nil {
+		return dir, nil
+	}
+	if !errors.Is(err, directory.ErrDirNotExists) {
+		return nil, err
+	}
+	return x.DirCreate(path, nil)
+}
+
+func (x *dryRunTransaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	dir, err := x.Transaction.DirCreate(path, layer)
+	if err != nil {
+		return nil, err
+	}
+	x.state.addDir(dir)
+	x.append(Write{Op: CreateDirOp, Dir: dir.GetPath(), Prefix: dir.Bytes()})
+	return dir, nil
+}
+
+func (x *dryRunTransaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	old, err := x.DirOpen(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := x.Transaction.DirMove(oldPath, newPath)
+	if err != nil {
+		return nil, err
+	}
+	x.state.addDir(dir)
+	x.append(Write{Op: MoveDirOp, Dir: dir.GetPath(), Prefix: dir.Bytes(), OldDir: old.GetPath()})
+	return dir, nil
+}
+
+func (x *dryRunTransaction) DirRemove(path []string) (bool, error) {
+	dir, err := x.DirOpen(path)
+	if err != nil {
+		if errors.Is(err, directory.ErrDirNotExists) {
+			return false, nil
+		}
+		return false, err
+	}
+	removed, err := x.Transaction.DirRemove(path)
+	if err != nil {
+		return false, err
+	}
+	if removed {
+		x.append(Write{Op: RemoveDirOp, Dir: dir.GetPath(), Prefix: dir.Bytes()})
+	}
+	return removed, nil
+}
+
+func (x *dryRunTransaction) Set(key fdb.KeyConvertible, val []byte) {
+	x.Transaction.Set(key, val)
+	x.record(SetOp, key, val)
+}
+
+func (x *dryRunTransaction) Clear(key fdb.KeyConvertible) {
+	x.Transaction.Clear(key)
+	x.record(ClearOp, key, nil)
+}
+
+func (x *dryRunTransaction) ClearRange(rng fdb.ExactRange) {
+	x.Transaction.ClearRange(rng)
+
+	begin, end := rng.FDBRangeKeys()
+	write := x.write(ClearRangeOp, begin, nil)
+	write.End = append([]byte{}, end.FDBKey()...)
+	x.append(write)
+}
+
+func (x *dryRunTransaction) Add(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.Add(key, param)
+	x.record(AddOp, key, param)
+}
+
+func (x *dryRunTransaction) BitAnd(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.BitAnd(key, param)
+	x.record(BitAndOp, key, param)
+}
+
+func (x *dryRunTransaction) BitOr(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.BitOr(key, param)
+	x.record(BitOrOp, key, param)
+}
+
+func (x *dryRunTransaction) BitXor(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.BitXor(key, param)
+	x.record(BitXorOp, key, param)
+}
+
+func (x *dryRunTransaction) Min(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.Min(key, param)
+	x.record(MinOp, key, param)
+}
+
+func (x *dryRunTransaction) Max(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.Max(key, param)
+	x.record(MaxOp, key, param)
+}
+
+func (x *dryRunTransaction) ByteMin(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.ByteMin(key, param)
+	x.record(ByteMinOp, key, param)
+}
+
+func (x *dryRunTransaction) ByteMax(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.ByteMax(key, param)
+	x.record(ByteMaxOp, key, param)
+}
+
+func (x *dryRunTransaction) CompareAndClear(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.CompareAndClear(key, param)
+	x.record(CompareAndClearOp, key, param)
+}
+
+func (x *dryRunTransaction) AppendIfFits(key fdb.KeyConvertible, param []byte) {
+	x.Transaction.AppendIfFits(key, param)
+	x.record(AppendIfFitsOp, key, param)
+}
+
+func (x *dryRunTransaction) GetCommittedVersion() (int64, error) {
+	// The transaction is never committed,
+	// like a read-only transaction.
+	return -1, nil
+}
+
+func (x *dryRunTransaction) record(op WriteOp, key fdb.KeyConvertible, param []byte) {
+	x.append(x.write(op, key, param))
+}
+
+// write creates a Write for the given key, attributing
+// the key to the directory which contains it.
+func (x *dryRunTransaction) write(op WriteOp, key fdb.KeyConvertible, param []byte) Write {
+	k := key.FDBKey()
+	write := Write{Op: op, Key: append([]byte{}, k...)}
+	if param != nil {
+		write.Param = append([]byte{}, param...)
+	}
+	if dir := x.state.resolve(k); dir != nil {
+		write.Dir = dir.GetPath()
+		write.Prefix = dir.Bytes()
+	}
+	return write
+}
+
+func (x *dryRunTransaction) append(write Write) {
+	x.state.mu.Lock()
+	defer x.state.mu.Unlock()
+	x.writes = append(x.writes, write)
+}
@@ -2,8 +2,11 @@
 package facade
 
 import (
+	"time"
+
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
 )
 
 type (
@@ -32,6 +35,22 @@ type (
 
 		// GetRange performs a range-read over the given range.
 		GetRange(r fdb.Range, options fdb.RangeOptions) fdb.RangeResult
+
+		// GetReadVersion returns the version at which the transaction reads.
+		GetReadVersion() fdb.FutureInt64
+
+		// SetReadVersion sets the version at which the transaction reads. This
+		// must be called before any reads are performed. It has no effect on a
+		// ReadTransaction returned by Snapshot.
+		SetReadVersion(version int64)
+
+		// Snapshot returns a view of the transaction which performs snapshot
+		// reads. Snapshot reads don't add read conflict ranges.
+		Snapshot() ReadTransaction
+
+		// SetOptions applies the given options to the transaction. It has no
+		// effect on a ReadTransaction returned by Snapshot.
+		SetOptions(opts TransactionOptions) error
 	}
 
 	// Transactor provides methods for performing read or write transactions and for
@@ -46,6 +65,21 @@ type (
 		// DirCreateOrOpen opens a directory (or creates it if it doesn't exist)
 		// under the root directory specified by the implementation.
 		DirCreateOrOpen(path []string) (directory.DirectorySubspace, error)
+
+		// DirCreate creates a directory tagged with the given layer under the
+		// root directory specified by the implementation. If the directory
+		// already exists, an error is returned.
+		DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error)
+
+		// DirMove moves a directory, and all of its subdirectories, to a new
+		// path. Both paths are relative to the root directory specified by
+		// the implementation.
+		DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error)
+
+		// DirRemove removes a directory, all of its subdirectories, and all
+		// of their contents. If the directory doesn't exist, false is
+		// returned.
+		DirRemove(path []string) (bool, error)
 	}
 
 	// Transaction provides methods for reading or writing key-values from an open
@@ -59,9 +93,89 @@ type (
 
 		// Clear deletes a key-value.
 		Clear(fdb.KeyConvertible)
+
+		// ClearRange deletes all key-values within the given range.
+		ClearRange(fdb.ExactRange)
+
+		// Add atomically adds the given little-endian integer to the key's value.
+		Add(fdb.KeyConvertible, []byte)
+
+		// BitAnd atomically performs a bitwise AND on the key's value.
+		BitAnd(fdb.KeyConvertible, []byte)
+
+		// BitOr atomically performs a bitwise OR on the key's value.
+		BitOr(fdb.KeyConvertible, []byte)
+
+		// BitXor atomically performs a bitwise XOR on the key's value.
+		BitXor(fdb.KeyConvertible, []byte)
+
+		// Min atomically stores the lesser little-endian integer.
+		Min(fdb.KeyConvertible, []byte)
+
+		// Max atomically stores the greater little-endian integer.
+		Max(fdb.KeyConvertible, []byte)
+
+		// ByteMin atomically stores the lexicographically lesser byte string.
+		ByteMin(fdb.KeyConvertible, []byte)
+
+		// ByteMax atomically stores the lexicographically greater byte string.
+		ByteMax(fdb.KeyConvertible, []byte)
+
+		// CompareAndClear atomically clears the key if its value equals the given bytes.
+		CompareAndClear(fdb.KeyConvertible, []byte)
+
+		// AppendIfFits atomically appends to the key's value if the result fits.
+		AppendIfFits(fdb.KeyConvertible, []byte)
+
+		// Watch returns a future which becomes ready when the key's value
+		// changes. The watch is only active once the transaction commits.
+		Watch(fdb.KeyConvertible) fdb.FutureNil
+
+		// GetCommittedVersion returns the version at which the transaction
+		// was committed. This is only valid after the transaction commits.
+		// Read-only transactions return -1.
+		GetCommittedVersion() (int64, error)
 	}
 )
 
+// Priority determines how a transaction is scheduled relative to
+// other transactions.
+type Priority int
+
+const (
+	// DefaultPriority is the priority used when none is specified.
+	DefaultPriority Priority = iota
+
+	// BatchPriority is for transactions which may be delayed in favor
+	// of transactions with the default priority.
+	BatchPriority
+
+	// SystemPriority is for transactions which must not be delayed.
+	// This priority should be used sparingly.
+	SystemPriority
+)
+
+// TransactionOptions configures a transaction. The zero value of each
+// field leaves the corresponding FDB option at its default.
+type TransactionOptions struct {
+	// Timeout is the max duration of the transaction,
+	// including retries.
+	Timeout time.Duration
+
+	// RetryLimit is the max number of retries.
+	RetryLimit int
+
+	// MaxRetryDelay is the max backoff between retries.
+	MaxRetryDelay time.Duration
+
+	// Priority is the scheduling priority.
+	Priority Priority
+
+	// SizeLimit is the max number of bytes the
+	// transaction may write.
+	SizeLimit int
+}
+
 type (
 	readTransactor struct {
 		tr   fdb.ReadTransactor
@@ -157,6 +271,64 @@ func (x *readTransaction) GetRange(rng fdb.Range, options fdb.RangeOptions) fdb.
 	return x.tr.GetRange(rng, options)
 }
 
+func (x *readTransaction) GetReadVersion() fdb.FutureInt64 {
+	return x.tr.GetReadVersion()
+}
+
+func (x *readTransaction) SetReadVersion(version int64) {
+	// Only transactions can set their read version. Snapshots
+	// share the read version of the transaction they view.
+	if tr, ok := x.tr.(fdb.Transaction); ok {
+		tr.SetReadVersion(version)
+	}
+}
+
+func (x *readTransaction) Snapshot() ReadTransaction {
+	return NewReadTransaction(x.tr.Snapshot(), x.root)
+}
+
+func (x *readTransaction) SetOptions(opts TransactionOptions) error {
+	// Only transactions have options. Snapshots share the
+	// options of the transaction they view.
+	tr, ok := x.tr.(fdb.Transaction)
+	if !ok {
+		return nil
+	}
+
+	o := tr.Options()
+	if opts.Timeout > 0 {
+		if err := o.SetTimeout(opts.Timeout.Milliseconds()); err != nil {
+			return errors.Wrap(err, "failed to set timeout")
+		}
+	}
+	if opts.RetryLimit > 0 {
+		if err := o.SetRetryLimit(int64(opts.RetryLimit)); err != nil {
+			return errors.Wrap(err, "failed to set retry limit")
+		}
+	}
+	if opts.MaxRetryDelay > 0 {
+		if err := o.SetMaxRetryDelay(opts.MaxRetryDelay.Milliseconds()); err != nil {
+			return errors.Wrap(err, "failed to set max retry delay")
+		}
+	}
+	switch opts.Priority {
+	case BatchPriority:
+		if err := o.SetPriorityBatch(); err != nil {
+			return errors.Wrap(err, "failed to set batch priority")
+		}
+	case SystemPriority:
+		if err := o.SetPrioritySystemImmediate(); err != nil {
+			return errors.Wrap(err, "failed to set system priority")
+		}
+	}
+	if opts.SizeLimit > 0 {
+		if err := o.SetSizeLimit(int64(opts.SizeLimit)); err != nil {
+			return errors.Wrap(err, "failed to set size limit")
+		}
+	}
+	return nil
+}
+
 func (x *transactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.Transact(func(tr fdb.Transaction) (interface{}, error) {
 		return f(NewTransaction(tr, x.root))
@@ -167,6 +339,18 @@ func (x *transactor) DirCreateOrOpen(path []string) (directory.DirectorySubspace
 	return x.root.CreateOrOpen(x.tr, path, nil)
 }
 
+func (x *transactor) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.root.Create(x.tr, path, layer)
+}
+
+func (x *transactor) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.root.Move(x.tr, oldPath, newPath)
+}
+
+func (x *transactor) DirRemove(path []string) (bool, error) {
+	return x.root.Remove(x.tr, path)
+}
+
 func (x *transaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return x.tr.Transact(func(tr fdb.Transaction) (interface{}, error) {
 		return f(NewTransaction(tr, x.root))
@@ -177,6 +361,18 @@ func (x *transaction) DirCreateOrOpen(path []string) (directory.DirectorySubspac
 	return x.root.CreateOrOpen(x.tr, path, nil)
 }
 
+func (x *transaction) DirCreate(path []string, layer []byte) (directory.DirectorySubspace, error) {
+	return x.root.Create(x.tr, path, layer)
+}
+
+func (x *transaction) DirMove(oldPath []string, newPath []string) (directory.DirectorySubspace, error) {
+	return x.root.Move(x.tr, oldPath, newPath)
+}
+
+func (x *transaction) DirRemove(path []string) (bool, error) {
+	return x.root.Remove(x.tr, path)
+}
+
 func (x *transaction) Set(key fdb.KeyConvertible, val []byte) {
 	x.tr.Set(key, val)
 }
@@ -184,3 +380,55 @@ func (x *transaction) Set(key fdb.KeyConvertible, val []byte) {
 func (x *transaction) Clear(key fdb.KeyConvertible) {
 	x.tr.Clear(key)
 }
+
+func (x *transaction) ClearRange(rng fdb.ExactRange) {
+	x.tr.ClearRange(rng)
+}
+
+func (x *transaction) Add(key fdb.KeyConvertible, param []byte) {
+	x.tr.Add(key, param)
+}
+
+func (x *transaction) BitAnd(key fdb.KeyConvertible, param []byte) {
+	x.tr.BitAnd(key, param)
+}
+
+func (x *transaction) BitOr(key fdb.KeyConvertible, param []byte) {
+	x.tr.BitOr(key, param)
+}
+
+func (x *transaction) BitXor(key fdb.KeyConvertible, param []byte) {
+	x.tr.BitXor(key, param)
+}
+
+func (x *transaction) Min(key fdb.KeyConvertible, param []byte) {
+	x.tr.Min(key, param)
+}
+
+func (x *transaction) Max(key fdb.KeyConvertible, param []byte) {
+	x.tr.Max(key, param)
+}
+
+func (x *transaction) ByteMin(key fdb.KeyConvertible, param []byte) {
+	x.tr.ByteMin(key, param)
+}
+
+func (x *transaction) ByteMax(key fdb.KeyConvertible, param []byte) {
+	x.tr.ByteMax(key, param)
+}
+
+func (x *transaction) CompareAndClear(key fdb.KeyConvertible, param []byte) {
+	x.tr.CompareAndClear(key, param)
+}
+
+func (x *transaction) AppendIfFits(key fdb.KeyConvertible, param []byte) {
+	x.tr.AppendIfFits(key, param)
+}
+
+func (x *transaction) Watch(key fdb.KeyConvertible) fdb.FutureNil {
+	return x.tr.Watch(key)
+}
+
+func (x *transaction) GetCommittedVersion() (int64, error) {
+	return x.tr.GetCommittedVersion()
+}
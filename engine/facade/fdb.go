@@ -20,6 +20,14 @@ type (
 	nilFutureByteSlice struct {
 		fdb.Future
 	}
+
+	nilFutureNil struct {
+		fdb.Future
+	}
+
+	nilFutureInt64 struct {
+		fdb.Future
+	}
 )
 
 var (
@@ -30,6 +38,8 @@ var (
 
 	_ fdb.Future          = &nilFuture{}
 	_ fdb.FutureByteSlice = &nilFutureByteSlice{}
+	_ fdb.FutureNil       = &nilFutureNil{}
+	_ fdb.FutureInt64     = &nilFutureInt64{}
 )
 
 // NewNilRange returns a nil implementation of fdb.Range
@@ -68,6 +78,18 @@ func NewNilFutureByteSlice() fdb.FutureByteSlice {
 	return &nilFutureByteSlice{NewNilFuture()}
 }
 
+// NewNilFutureNil returns a nil implementation of fdb.FutureNil
+// where every operation is a no-op.
+func NewNilFutureNil() fdb.FutureNil {
+	return &nilFutureNil{NewNilFuture()}
+}
+
+// NewNilFutureInt64 returns a nil implementation of fdb.FutureInt64
+// where every operation is a no-op.
+func NewNilFutureInt64() fdb.FutureInt64 {
+	return &nilFutureInt64{NewNilFuture()}
+}
+
 func (x *nilFuture) BlockUntilReady() {}
 
 func (x *nilFuture) IsReady() bool {
@@ -99,3 +121,17 @@ func (x *nilFutureByteSlice) Get() ([]byte, error) {
 func (x *nilFutureByteSlice) MustGet() []byte {
 	return nil
 }
+
+func (x *nilFutureNil) Get() error {
+	return nil
+}
+
+func (x *nilFutureNil) MustGet() {}
+
+func (x *nilFutureInt64) Get() (int64, error) {
+	return 0, nil
+}
+
+func (x *nilFutureInt64) MustGet() int64 {
+	return 0
+}
@@ -82,6 +82,20 @@ func (x *nilReadTransaction) GetRange(_ fdb.Range, _ fdb.RangeOptions) fdb.Range
 	return fdb.RangeResult{}
 }
 
+func (x *nilReadTransaction) GetReadVersion() fdb.FutureInt64 {
+	return NewNilFutureInt64()
+}
+
+func (x *nilReadTransaction) SetReadVersion(_ int64) {}
+
+func (x *nilReadTransaction) SetOptions(_ TransactionOptions) error {
+	return nil
+}
+
+func (x *nilReadTransaction) Snapshot() ReadTransaction {
+	return x
+}
+
 func (x *nilTransactor) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return f(NewNilTransaction())
 }
@@ -90,6 +104,18 @@ func (x *nilTransactor) DirCreateOrOpen(_ []string) (directory.DirectorySubspace
 	return NewNilDirectorySubspace(), nil
 }
 
+func (x *nilTransactor) DirCreate(_ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransactor) DirMove(_ []string, _ []string) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransactor) DirRemove(_ []string) (bool, error) {
+	return false, nil
+}
+
 func (x *nilTransaction) Transact(f func(Transaction) (interface{}, error)) (interface{}, error) {
 	return f(x)
 }
@@ -98,6 +124,48 @@ func (x *nilTransaction) DirCreateOrOpen(_ []string) (directory.DirectorySubspac
 	return NewNilDirectorySubspace(), nil
 }
 
+func (x *nilTransaction) DirCreate(_ []string, _ []byte) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransaction) DirMove(_ []string, _ []string) (directory.DirectorySubspace, error) {
+	return NewNilDirectorySubspace(), nil
+}
+
+func (x *nilTransaction) DirRemove(_ []string) (bool, error) {
+	return false, nil
+}
+
 func (x *nilTransaction) Set(_ fdb.KeyConvertible, _ []byte) {}
 
 func (x *nilTransaction) Clear(_ fdb.KeyConvertible) {}
+
+func (x *nilTransaction) ClearRange(_ fdb.ExactRange) {}
+
+func (x *nilTransaction) Add(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) BitAnd(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) BitOr(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) BitXor(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) Min(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) Max(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) ByteMin(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) ByteMax(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) CompareAndClear(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) AppendIfFits(_ fdb.KeyConvertible, _ []byte) {}
+
+func (x *nilTransaction) Watch(_ fdb.KeyConvertible) fdb.FutureNil {
+	return NewNilFutureNil()
+}
+
+func (x *nilTransaction) GetCommittedVersion() (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fdbq/engine/facade"
+	"github.com/janderland/fdbq/engine/internal"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/keyval/compare"
+	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/rewrite"
+	"github.com/janderland/fdbq/keyval/values"
+)
+
+// Index is a secondary index maintained by an Engine. For each key-value
+// matching the index's source schema, an index entry is created by applying
+// the key-value to the index's template. Indexes are registered via the
+// [Indexes] option. See [NewIndex].
+type Index struct {
+	name     string
+	source   keyval.KeyValue
+	names    []string
+	template keyval.KeyValue
+
+	// These fields are used by the planner to find the keys
+	// matching a query via the index's entries. If the source
+	// keys can't be recovered from the entries, key is nil.
+	key         *keyval.Key
+	entrySchema keyval.KeyValue
+	entryNames  []string
+}
+
+// NewIndex creates an [Index]. The source query must belong to [class.ReadRange].
+// The names hold the name of each of the source query's variables in the order
+// they appear, as returned by parser.Parser.Names. The template may refer to
+// the named variables via a [keyval.Reference]. Once the references are
+// replaced, the template must belong to [class.Constant]. For instance, the
+// source '/people(<id:int>,<last:string>)=nil' and the template
+// '/index/last_name(:last,:id)=nil' index people by their last name.
+func NewIndex(name string, source keyval.KeyValue, names []string, template keyval.KeyValue) (Index, error) {
+	if name == "" {
+		return Index{}, errors.New("index name is empty")
+	}
+	if c := class.Classify(source); c != class.ReadRange {
+		return Index{}, errors.Errorf("source query isn't a range-read, has class '%v'", c)
+	}
+	if _, err := internal.NewValueHandler(source.Value, binary.BigEndian, true); err != nil {
+		return Index{}, errors.Wrap(err, "invalid source value")
+	}
+	if err := rewrite.Check(template, names); err != nil {
+		return Index{}, errors.Wrap(err, "invalid template")
+	}
+
+	// Every name is bound to a string so the template can be checked
+	// for variables, clears, etc. before any key-values are indexed.
+	bindings := make(rewrite.Bindings)
+	for _, name := range names {
+		if name != "" {
+			bindings[name] = keyval.String("")
+		}
+	}
+	entry, err := rewrite.Apply(template, bindings)
+	if err != nil {
+		return Index{}, errors.Wrap(err, "invalid template")
+	}
+	if c := class.Classify(entry); c != class.Constant {
+		return Index{}, errors.Errorf("template isn't a set query, has class '%v'", c)
+	}
+
+	index := Index{
+		name:     name,
+		source:   source,
+		names:    names,
+		template: template,
+	}
+	index.entrySchema, index.entryNames = rewrite.Invert(template)
+
+	// The source keys can be recovered from the index entries
+	// if every variable of the source key is named and every
+	// named variable is referenced by the template's key.
+	key, err := rewrite.Template(source, names)
+	if err != nil {
+		return Index{}, errors.Wrap(err, "invalid names")
+	}
+	key.Value = keyval.Variable{}
+	bindings = make(rewrite.Bindings)
+	for _, name := range index.entryNames {
+		if name != "" {
+			bindings[name] = keyval.String("")
+		}
+	}
+	if kv, err := rewrite.Apply(key, bindings); err == nil && class.Classify(kv) == class.ReadSingle {
+		index.key = &key.Key
+	}
+	return index, nil
+}
+
+// Name returns the name given to [NewIndex].
+func (x Index) Name() string {
+	return x.name
+}
+
+// Indexes registers indexes which are maintained by [Engine.Set], [Engine.Clear],
+// [Engine.ClearRange], and [Loader]. When a key matching an index's source schema
+// is written, the index entry of the key's prior value is cleared and the index
+// entry of the key's new value is set, all within the same transaction. While
+// indexes are registered, [Engine.Atomic] fails. Use [Engine.Reindex] to backfill
+// an index. This method must not be called concurrently with other methods.
+func Indexes(indexes ...Index) Option {
+	return func(eg *Engine) {
+		eg.indexes = append(eg.indexes, indexes...)
+	}
+}
+
+// Reindex writes the index entry of every key-value matching the index's source
+// schema. The key-values are read via [Engine.ReadRange] using the given options,
+// with filtering enabled. The entries are written via a [Loader]. Stale entries
+// aren't removed, see [Engine.ClearIndex].
+func (x *Engine) Reindex(ctx context.Context, index Index, rangeOpts RangeOpts, loadOpts LoadOpts) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The source is always scanned, as the
+	// other indexes may be stale as well.
+	scan := *x
+	scan.indexes = nil
+
+	rangeOpts.Filter = true
+	loader := x.NewLoader(loadOpts)
+	for msg := range scan.ReadRange(ctx, index.source, rangeOpts) {
+		if msg.Err != nil {
+			return msg.Err
+		}
+
+		entry, err := index.entry(msg.KV)
+		if err != nil {
+			return errors.Wrapf(err, "failed to index key-value for index '%s'", index.name)
+		}
+		if err := loader.Set(entry); err != nil {
+			return err
+		}
+	}
+	return loader.Flush()
+}
+
+// ClearIndex clears every key-value which could be an entry of the given
+// index. This includes every key-value matching the template with each
+// reference replaced by a variable. See [Engine.ClearRange].
+func (x *Engine) ClearIndex(ctx context.Context, index Index) error {
+	query := rewrite.Schema(index.template)
+	query.Value = keyval.Clear{}
+
+	if class.Classify(query) == class.Clear {
+		return x.Clear(query)
+	}
+	return x.ClearRange(ctx, query)
+}
+
+// entry applies the given key-value, which must
+// match the source schema, to the index's template.
+func (x *Index) entry(kv keyval.KeyValue) (keyval.KeyValue, error) {
+	bindings, err := rewrite.Bind(x.source, x.names, kv)
+	if err != nil {
+		return keyval.KeyValue{}, err
+	}
+	out, err := rewrite.Apply(x.template, bindings)
+	if err != nil {
+		return keyval.KeyValue{}, err
+	}
+	if c := class.Classify(out); c != class.Constant {
+		return keyval.KeyValue{}, errors.Errorf("index entry isn't a set query, has class '%v'", c)
+	}
+	return out, nil
+}
+
+// updateIndex maintains the given index for a write of the given key. The
+// prior & new values are the key's packed values before & after the write.
+// Either may be nil if the key doesn't exist. If the key doesn't match the
+// index's source schema, nothing is written.
+func (x *Engine) updateIndex(tr facade.Transaction, index Index, path []string, key keyval.Tuple, prior []byte, value []byte) error {
+	if !compare.Directory(index.source.Key.Directory, path) || compare.Tuples(index.source.Key.Tuple, key) != nil {
+		return nil
+	}
+
+	valHandler, err := internal.NewValueHandler(index.source.Value, x.order, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to create value handler")
+	}
+
+	entryFor := func(val []byte) (*keyval.KeyValue, error) {
+		decoded, err := valHandler.Handle(val)
+		if err != nil || decoded == nil {
+			return nil, err
+		}
+		entry, err := index.entry(keyval.KeyValue{
+			Key:   keyval.Key{Directory: convert.FromStringArray(path), Tuple: key},
+			Value: decoded,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+
+	oldEntry, err := entryFor(prior)
+	if err != nil {
+		return errors.Wrap(err, "failed to create prior entry")
+	}
+	newEntry, err := entryFor(value)
+	if err != nil {
+		return errors.Wrap(err, "failed to create new entry")
+	}
+
+	if oldEntry != nil && (newEntry == nil || !oldEntry.Key.Eq(newEntry.Key)) {
+		if err := x.writeEntry(tr, *oldEntry, true); err != nil {
+			return errors.Wrap(err, "failed to clear prior entry")
+		}
+	}
+	if newEntry != nil {
+		if err := x.writeEntry(tr, *newEntry, false); err != nil {
+			return errors.Wrap(err, "failed to set new entry")
+		}
+	}
+	return nil
+}
+
+// writeEntry sets or clears the given index entry. The entry's
+// prior value is passed to the journal, if one is configured.
+func (x *Engine) writeEntry(tr facade.Transaction, entry keyval.KeyValue, clear bool) error {
+	path, err := convert.ToStringArray(entry.Key.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	tup, err := convert.ToFDBTuple(entry.Key.Tuple)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert to FDB tuple")
+	}
+
+	var dir directory.DirectorySubspace
+	if clear {
+		dir, err = tr.DirOpen(path)
+		if errors.Is(err, directory.ErrDirNotExists) {
+			return nil
+		}
+	} else {
+		dir, err = tr.DirCreateOrOpen(path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open directory")
+	}
+
+	if x.journal != nil {
+		prior, err := tr.Get(dir.Pack(tup)).Get()
+		if err != nil {
+			return errors.Wrap(err, "failed to read prior value")
+		}
+		entry := JournalEntry{Dir: path, Key: tup.Pack(), Value: prior}
+		if err := x.journal(entry); err != nil {
+			return errors.Wrap(err, "failed to record journal entry")
+		}
+	}
+
+	if clear {
+		tr.Clear(dir.Pack(tup))
+		return nil
+	}
+
+	value, err := values.Pack(entry.Value, x.order)
+	if err != nil {
+		return errors.Wrap(err, "failed to pack value")
+	}
+	tr.Set(dir.Pack(tup), value)
+	return nil
+}
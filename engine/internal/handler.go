@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fdbq/keyval"
+	kvcompare "github.com/janderland/fdbq/keyval/compare"
 	"github.com/janderland/fdbq/keyval/values"
 )
 
@@ -34,6 +35,17 @@ type (
 		filter   bool
 	}
 
+	// check is a ValHandler which deserializes the given []byte like
+	// unpack and then checks if the resultant value satisfies the
+	// predicate. If the value doesn't satisfy the predicate and
+	// filter=false, then an error is returned. If filter=true,
+	// errors are not returned.
+	check struct {
+		predicate keyval.Predicate
+		unpack    ValHandler
+		filter    bool
+	}
+
 	// compare is a ValHandler which compares the given []byte to
 	// the packed bytes of the query. If the bytes match, the original
 	// query is returned. If the bytes don't match and filter=false,
@@ -47,6 +59,23 @@ type (
 )
 
 func NewValueHandler(query keyval.Value, order binary.ByteOrder, filter bool) (ValHandler, error) {
+	if predicate, ok := query.(keyval.Predicate); ok {
+		// Predicates are checked against decoded values, so
+		// an empty variable is decoded as bytes.
+		variable := predicate.Variable
+		if len(variable) == 0 {
+			variable = keyval.Variable{keyval.BytesType}
+		}
+		return &check{
+			predicate: predicate,
+			unpack: &unpack{
+				variable: variable,
+				order:    order,
+				filter:   filter,
+			},
+			filter: filter,
+		}, nil
+	}
 	if variable, ok := query.(keyval.Variable); ok {
 		if len(variable) == 0 {
 			return &pass{}, nil
@@ -93,7 +122,7 @@ func (x *unpack) Handle(val []byte) (keyval.Value, error) {
 	if x.filter {
 		return nil, nil
 	}
-	return nil, errors.New("unexpected value")
+	return nil, errors.Errorf("value can't be decoded as any of the types %v", x.variable)
 }
 
 func (x *compare) Handle(val []byte) (keyval.Value, error) {
@@ -106,5 +135,19 @@ func (x *compare) Handle(val []byte) (keyval.Value, error) {
 	if x.filter {
 		return nil, nil
 	}
-	return nil, errors.New("unexpected value")
+	return nil, errors.New("value doesn't equal the query's value")
+}
+
+func (x *check) Handle(val []byte) (keyval.Value, error) {
+	out, err := x.unpack.Handle(val)
+	if err != nil || out == nil {
+		return nil, err
+	}
+	if kvcompare.Satisfies(x.predicate, out) {
+		return out, nil
+	}
+	if x.filter {
+		return nil, nil
+	}
+	return nil, errors.New("value doesn't satisfy the query's predicate")
 }
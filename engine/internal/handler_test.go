@@ -21,6 +21,8 @@ func TestNoFilter(t *testing.T) {
 		{name: "variable mismatch", query: q.Variable{q.IntType}, val: []byte("hi"), err: true},
 		{name: "packed match", query: q.String("you"), val: []byte("you"), out: q.String("you")},
 		{name: "packed mismatch", query: q.Int(22), val: []byte("you"), err: true},
+		{name: "predicate match", query: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.MatchOp, Operands: q.Tuple{q.String("^h")}}, val: []byte("hi"), out: q.String("hi")},
+		{name: "predicate mismatch", query: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.MatchOp, Operands: q.Tuple{q.String("^y")}}, val: []byte("hi"), err: true},
 	}
 
 	for _, test := range tests {
@@ -53,6 +55,8 @@ func TestFilter(t *testing.T) {
 		{name: "variable mismatch", query: q.Variable{q.IntType}, val: []byte("hi"), out: nil},
 		{name: "packed match", query: q.String("you"), val: []byte("you"), out: q.String("you")},
 		{name: "packed mismatch", query: q.Int(22), val: []byte("you"), out: nil},
+		{name: "predicate match", query: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.MatchOp, Operands: q.Tuple{q.String("^h")}}, val: []byte("hi"), out: q.String("hi")},
+		{name: "predicate mismatch", query: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.MatchOp, Operands: q.Tuple{q.String("^y")}}, val: []byte("hi"), out: nil},
 	}
 
 	for _, test := range tests {
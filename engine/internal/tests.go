@@ -13,7 +13,7 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func TestEnv(t *testing.T, force bool, f func(facade.Transactor, zerolog.Logger)) {
+func TestEnv(t testing.TB, force bool, f func(facade.Transactor, zerolog.Logger)) {
 	db := fdb.MustOpenDefault()
 	rootPath := genRootPath()
 
@@ -0,0 +1,371 @@
+package engine
+
+import (
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fdbq/engine/facade"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/values"
+)
+
+const (
+	// loadBatchKeys is the default max number of
+	// key-values written by each transaction of
+	// a [Loader].
+	loadBatchKeys = 1000
+
+	// loadBatchBytes is the default max number of
+	// key & value bytes written by each transaction
+	// of a [Loader]. FDB limits transactions to 10MB.
+	loadBatchBytes = 1 << 20
+
+	// loadRetries is the default number of times
+	// a [Loader] retries a failed batch.
+	loadRetries = 3
+)
+
+// LoadOpts configures how a [Loader] groups writes into transactions.
+type LoadOpts struct {
+	// BatchKeys is the max number of key-values written by
+	// each transaction. If zero, a default of 1000 is used.
+	BatchKeys int
+
+	// BatchBytes is the max number of key & value bytes written
+	// by each transaction. If zero, a default of 1MB is used. A
+	// single key-value larger than this is written on its own.
+	BatchBytes int
+
+	// Retries is the number of times a batch is retried after
+	// its transaction fails. This is in addition to the retries
+	// performed by FDB for retryable errors. If zero, a default
+	// of 3 is used. If negative, failed batches aren't retried.
+	Retries int
+
+	// Progress, if non-nil, is called after each
+	// batch is successfully written.
+	Progress func(LoadProgress)
+}
+
+// LoadProgress describes the writes performed by a [Loader].
+type LoadProgress struct {
+	Batches int
+	Keys    int
+	Bytes   int
+}
+
+// Loader writes many key-values by grouping them into transactions,
+// avoiding both the overhead of a transaction per key-value and the
+// size limit of a single transaction. Directories are opened once
+// and cached for the lifetime of the Loader. Because the key-values
+// are written across multiple transactions, a failure may leave some
+// of them written. A Loader must not be used concurrently.
+type Loader struct {
+	eg   *Engine
+	opts LoadOpts
+
+	dirs     map[string]directory.DirectorySubspace
+	batch    []loadKV
+	bytes    int
+	progress LoadProgress
+}
+
+// loadKV is a key-value buffered by a
+// Loader. The key is packed without its
+// directory prefix. If clear is true, the
+// key is cleared instead of set.
+type loadKV struct {
+	path  []string
+	key   []byte
+	value []byte
+	clear bool
+}
+
+// NewLoader creates a [Loader] which writes via this Engine.
+func (x *Engine) NewLoader(opts LoadOpts) *Loader {
+	if opts.BatchKeys <= 0 {
+		opts.BatchKeys = loadBatchKeys
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = loadBatchBytes
+	}
+	if opts.Retries == 0 {
+		opts.Retries = loadRetries
+	} else if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	return &Loader{
+		eg:   x,
+		opts: opts,
+		dirs: make(map[string]directory.DirectorySubspace),
+	}
+}
+
+// SetMany writes the given key-values using a [Loader]. Each query must
+// belong to [class.Constant]. Unlike [Engine.Set], the key-values are
+// grouped into transactions according to the given options.
+func (x *Engine) SetMany(queries []keyval.KeyValue, opts LoadOpts) error {
+	loader := x.NewLoader(opts)
+	for i, query := range queries {
+		if err := loader.Set(query); err != nil {
+			return errors.Wrapf(err, "failed to load query %d", i)
+		}
+	}
+	return loader.Flush()
+}
+
+// Set buffers the given key-value, which must belong to [class.Constant].
+// If the buffer has reached one of the batch limits, the buffered
+// key-values are written before the given key-value is buffered.
+func (x *Loader) Set(query keyval.KeyValue) error {
+	if class.Classify(query) != class.Constant {
+		return errors.New("query not constant class")
+	}
+
+	path, err := convert.ToStringArray(query.Key.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	tup, err := convert.ToFDBTuple(query.Key.Tuple)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert to FDB tuple")
+	}
+
+	value, err := values.Pack(query.Value, x.eg.order)
+	if err != nil {
+		return errors.Wrap(err, "failed to pack value")
+	}
+
+	return x.buffer(loadKV{path: path, key: tup.Pack(), value: value})
+}
+
+// Clear buffers the clearing of the given key-value, which must belong to
+// [class.Clear]. Within each transaction, the buffered clears are performed
+// before the buffered sets, so a key which is both cleared & set by the same
+// batch ends up set. If the buffer has reached one of the batch limits, the
+// buffered key-values are written before the given key-value is buffered.
+func (x *Loader) Clear(query keyval.KeyValue) error {
+	if class.Classify(query) != class.Clear {
+		return errors.New("query not clear class")
+	}
+
+	path, err := convert.ToStringArray(query.Key.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	tup, err := convert.ToFDBTuple(query.Key.Tuple)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert to FDB tuple")
+	}
+
+	return x.buffer(loadKV{path: path, key: tup.Pack(), clear: true})
+}
+
+// SetRaw buffers a key-value which is written as is within the directory
+// at the given path. The key shouldn't include the directory's prefix.
+// If the buffer has reached one of the batch limits, the buffered
+// key-values are written before the given key-value is buffered.
+func (x *Loader) SetRaw(path []string, key []byte, value []byte) error {
+	if len(path) == 0 {
+		return errors.New("directory path is empty")
+	}
+	return x.buffer(loadKV{path: path, key: key, value: value})
+}
+
+// ClearRaw buffers the clearing of a key within the directory at the given
+// path. The key shouldn't include the directory's prefix. Like [Loader.Clear],
+// the clears of each transaction are performed before its sets. If the buffer
+// has reached one of the batch limits, the buffered key-values are written
+// before the given key is buffered.
+func (x *Loader) ClearRaw(path []string, key []byte) error {
+	if len(path) == 0 {
+		return errors.New("directory path is empty")
+	}
+	return x.buffer(loadKV{path: path, key: key, clear: true})
+}
+
+func (x *Loader) buffer(kv loadKV) error {
+	size := len(kv.key) + len(kv.value)
+
+	if len(x.batch) > 0 && (len(x.batch) >= x.opts.BatchKeys || x.bytes+size > x.opts.BatchBytes) {
+		if err := x.Flush(); err != nil {
+			return err
+		}
+	}
+
+	x.batch = append(x.batch, kv)
+	x.bytes += size
+	return nil
+}
+
+// Flush writes the buffered key-values in a single transaction. If the
+// transaction fails, it is retried according to [LoadOpts.Retries].
+func (x *Loader) Flush() error {
+	if len(x.batch) == 0 {
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt <= x.opts.Retries; attempt++ {
+		if err = x.write(); err == nil {
+			break
+		}
+		x.eg.log.Log().Err(err).Int("attempt", attempt).Msg("batch failed")
+	}
+	if err != nil {
+		return err
+	}
+
+	x.progress.Batches++
+	x.progress.Keys += len(x.batch)
+	x.progress.Bytes += x.bytes
+	x.batch = nil
+	x.bytes = 0
+
+	if x.opts.Progress != nil {
+		x.opts.Progress(x.progress)
+	}
+	return nil
+}
+
+// Progress returns the writes performed so far.
+func (x *Loader) Progress() LoadProgress {
+	return x.progress
+}
+
+// write performs a single attempt at writing the buffered key-values. The
+// directories opened by the transaction are only cached if it succeeds, as
+// the directories created by a failed transaction don't exist.
+func (x *Loader) write() error {
+	var opened map[string]directory.DirectorySubspace
+
+	_, err := x.eg.transact(func(tr facade.Transaction) (interface{}, error) {
+		x.eg.log.Log().Int("keys", len(x.batch)).Int("bytes", x.bytes).Msg("writing batch")
+
+		opened = make(map[string]directory.DirectorySubspace)
+		openDir := func(path []string) (directory.DirectorySubspace, error) {
+			id := dirID(path)
+			if dir, ok := x.dirs[id]; ok {
+				return dir, nil
+			}
+			if dir, ok := opened[id]; ok {
+				return dir, nil
+			}
+			dir, err := tr.DirCreateOrOpen(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to open directory %v", path)
+			}
+			opened[id] = dir
+			return dir, nil
+		}
+
+		if err := x.record(tr, openDir); err != nil {
+			return nil, err
+		}
+
+		// Clears are performed first so they
+		// don't undo the sets of this batch.
+		for _, clear := range []bool{true, false} {
+			for _, kv := range x.batch {
+				if kv.clear != clear {
+					continue
+				}
+				dir, err := openDir(kv.path)
+				if err != nil {
+					return nil, err
+				}
+				key := append(append(fdb.Key{}, dir.Bytes()...), kv.key...)
+				if kv.clear {
+					tr.Clear(key)
+				} else {
+					tr.Set(key, kv.value)
+				}
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "transaction failed")
+	}
+
+	for id, dir := range opened {
+		x.dirs[id] = dir
+	}
+	return nil
+}
+
+// record passes the prior value of each key written by the buffered key-values
+// to the Engine's journal & indexes. The prior values are read concurrently
+// before any writes are performed. A key written more than once by the batch
+// is recorded once, using its final value.
+func (x *Loader) record(tr facade.Transaction, openDir func([]string) (directory.DirectorySubspace, error)) error {
+	if x.eg.journal == nil && len(x.eg.indexes) == 0 {
+		return nil
+	}
+
+	type written struct {
+		path  []string
+		key   []byte
+		prior fdb.FutureByteSlice
+		value []byte
+	}
+
+	var (
+		order []*written
+		byKey = make(map[string]*written)
+	)
+	for _, clear := range []bool{true, false} {
+		for _, kv := range x.batch {
+			if kv.clear != clear {
+				continue
+			}
+			dir, err := openDir(kv.path)
+			if err != nil {
+				return err
+			}
+			key := append(append(fdb.Key{}, dir.Bytes()...), kv.key...)
+
+			w, ok := byKey[string(key)]
+			if !ok {
+				w = &written{path: kv.path, key: kv.key, prior: tr.Get(key)}
+				byKey[string(key)] = w
+				order = append(order, w)
+			}
+			w.value = kv.value
+		}
+	}
+
+	for _, w := range order {
+		prior, err := w.prior.Get()
+		if err != nil {
+			return errors.Wrap(err, "failed to read prior value")
+		}
+
+		// Raw keys may not be tuples, in which
+		// case they can't belong to an index.
+		var key keyval.Tuple
+		if tup, err := tuple.Unpack(w.key); err == nil {
+			key = convert.FromFDBTuple(tup)
+		}
+		if err := x.eg.recordPrior(tr, w.path, key, w.key, prior, w.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirID converts the directory path
+// into a key for the directory cache.
+func dirID(path []string) string {
+	tup := make(tuple.Tuple, len(path))
+	for i, part := range path {
+		tup[i] = part
+	}
+	return string(tup.Pack())
+}
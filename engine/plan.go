@@ -0,0 +1,423 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/pkg/errors"
+
+	"github.com/janderland/fdbq/engine/facade"
+	"github.com/janderland/fdbq/engine/internal"
+	"github.com/janderland/fdbq/engine/stream"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/keyval/compare"
+	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/rewrite"
+	"github.com/janderland/fdbq/keyval/values"
+)
+
+// Plan describes how [Engine.ReadRange] reads the key-values matching
+// a query. By default, the directories matching the query are scanned.
+// If one of the indexes registered via [Indexes] narrows the read more
+// than the query's own key, the index's entries are read instead and
+// the source keys they refer to are read individually. Either way, the
+// same key-values are returned in the same order. See [Engine.Explain].
+type Plan struct {
+	// Index is the name of the index used to find the matching
+	// keys. If empty, the query's directories are scanned.
+	Index string
+
+	// Lookup is the query which reads the entries of
+	// the index. It's only set if Index isn't empty.
+	Lookup keyval.KeyValue
+
+	index *Index
+}
+
+// Explain returns the [Plan] which [Engine.ReadRange] would use to execute
+// the given query, which must belong to [class.ReadRange]. No reads are
+// performed.
+func (x *Engine) Explain(query keyval.KeyValue, opts RangeOpts) (Plan, error) {
+	if class.Classify(query) != class.ReadRange {
+		return Plan{}, errors.New("query not range-read class")
+	}
+	return x.plan(query, opts), nil
+}
+
+// plan chooses how the given range-read is executed. An index is only
+// used when every key-value matched by the query is guaranteed to match
+// the index's source schema, and the query's constants bind more of the
+// leading elements of the index's lookup than the constant prefix of the
+// query's own key. Otherwise, reading via the index could skip key-values
+// which a scan would return. Strict reads always scan, as a scan fails on
+// key-values which don't match the query. Reverse, resumable, paginated,
+// & distinct reads always scan as well.
+func (x *Engine) plan(query keyval.KeyValue, opts RangeOpts) Plan {
+	if len(x.indexes) == 0 || !opts.Filter || opts.Reverse || opts.Resume || opts.Cursor != "" || opts.Paginate || opts.Distinct > 0 {
+		return Plan{}
+	}
+	path, err := convert.ToStringArray(query.Key.Directory)
+	if err != nil {
+		return Plan{}
+	}
+
+	var (
+		best      Plan
+		bestScore = len(constantTuplePrefix(query.Key.Tuple))
+	)
+	for i := range x.indexes {
+		plan, score, ok := x.indexes[i].plan(path, query, x.order)
+		if ok && score > bestScore {
+			best, bestScore = plan, score
+		}
+	}
+	return best
+}
+
+// plan binds the query's constants to the source schema of the index and
+// returns the lookup of the index's entries, along with the number of
+// leading elements of the lookup which were bound by the query. If the
+// index can't answer the query, false is returned.
+func (x *Index) plan(path []string, query keyval.KeyValue, order binary.ByteOrder) (Plan, int, bool) {
+	if x.key == nil || !compare.Directory(x.source.Key.Directory, path) {
+		return Plan{}, 0, false
+	}
+	if !tupleWithin(query.Key.Tuple, x.source.Key.Tuple) || !valueWithin(query.Value, x.source.Value, order) {
+		return Plan{}, 0, false
+	}
+
+	bindings := make(rewrite.Bindings)
+	for i, element := range x.key.Directory {
+		if ref, ok := element.(keyval.Reference); ok {
+			bindings[string(ref)] = keyval.String(path[i])
+		}
+	}
+	for i, element := range query.Key.Tuple {
+		if ref, ok := x.key.Tuple[i].(keyval.Reference); ok && isConstant(element) {
+			bindings[string(ref)] = element
+		}
+	}
+
+	lookup, err := rewrite.Partial(x.template, bindings)
+	if err != nil {
+		return Plan{}, 0, false
+	}
+	if _, err := convert.ToStringArray(lookup.Key.Directory); err != nil {
+		return Plan{}, 0, false
+	}
+	lookup.Value = keyval.Variable{}
+
+	score := len(constantTuplePrefix(lookup.Key.Tuple)) - len(constantTuplePrefix(rewrite.Schema(x.template).Key.Tuple))
+	return Plan{Index: x.name, Lookup: lookup, index: x}, score, true
+}
+
+// indexReadBatch is the number of source keys
+// whose reads are in flight at the same time.
+const indexReadBatch = 100
+
+// readIndex streams the key-values matching the given query via the
+// index chosen by the plan. The index's entries and the keys they
+// refer to are read within a single transaction. The keys are read
+// in the order a scan would return them. Entries referring to keys
+// which don't exist or don't match the query are skipped.
+func (x *Engine) readIndex(ctx context.Context, s stream.Stream, out chan stream.KeyValErr, plan Plan, query keyval.KeyValue, opts RangeOpts) error {
+	valHandler, err := internal.NewValueHandler(query.Value, x.order, opts.Filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to create value handler")
+	}
+	path, err := convert.ToStringArray(query.Key.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert directory to string array")
+	}
+
+	lookupOpts := RangeOpts{
+		Filter:      true,
+		ReadVersion: opts.ReadVersion,
+		Snapshot:    opts.Snapshot,
+		Mode:        opts.Mode,
+		BatchSize:   opts.BatchSize,
+	}
+	singleOpts := SingleOpts{
+		Filter:      true,
+		ReadVersion: opts.ReadVersion,
+		Snapshot:    opts.Snapshot,
+	}
+
+	type source struct {
+		tup    keyval.Tuple
+		packed []byte
+	}
+
+	_, err = x.Transact(func(eg Engine) (interface{}, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Indexes aren't used to read other indexes.
+		eg.indexes = nil
+
+		var entries []keyval.KeyValue
+		if class.Classify(plan.Lookup) == class.ReadSingle {
+			entry, err := eg.ReadSingle(plan.Lookup, singleOpts)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read index entry")
+			}
+			if entry != nil {
+				entries = append(entries, *entry)
+			}
+		} else {
+			for msg := range eg.ReadRange(ctx, plan.Lookup, lookupOpts) {
+				if msg.Err != nil {
+					return nil, errors.Wrap(msg.Err, "failed to read index entries")
+				}
+				entries = append(entries, msg.KV)
+			}
+		}
+
+		var sources []source
+		for _, entry := range entries {
+			bindings, err := rewrite.Bind(plan.index.entrySchema, plan.index.entryNames, entry)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to bind index entry")
+			}
+			key, err := rewrite.Apply(keyval.KeyValue{Key: *plan.index.key, Value: keyval.Variable{}}, bindings)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create key from index entry")
+			}
+			if !key.Key.Directory.Eq(query.Key.Directory) || compare.Tuples(query.Key.Tuple, key.Key.Tuple) != nil {
+				continue
+			}
+
+			tup, err := convert.ToFDBTuple(key.Key.Tuple)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to convert to FDB tuple")
+			}
+			sources = append(sources, source{tup: key.Key.Tuple, packed: tup.Pack()})
+		}
+
+		// A scan returns the keys of a directory in
+		// the order of their packed bytes.
+		sort.Slice(sources, func(i, j int) bool {
+			return bytes.Compare(sources[i].packed, sources[j].packed) < 0
+		})
+		unique := sources[:0]
+		for _, src := range sources {
+			if len(unique) == 0 || !bytes.Equal(unique[len(unique)-1].packed, src.packed) {
+				unique = append(unique, src)
+			}
+		}
+		sources = unique
+
+		_, err := eg.transact(func(tx facade.Transaction) (interface{}, error) {
+			tr := readTransaction(tx, opts.ReadVersion, opts.Snapshot)
+
+			dir, err := tr.DirOpen(path)
+			if err != nil {
+				if errors.Is(err, directory.ErrDirNotExists) {
+					return nil, nil
+				}
+				return nil, errors.Wrap(err, "failed to open directory")
+			}
+
+			// Like a scan, the returned keys contain
+			// the directory's full path.
+			dirPath := convert.FromStringArray(dir.GetPath())
+
+			var (
+				sent    int
+				futures = make([]fdb.FutureByteSlice, 0, indexReadBatch)
+			)
+			for start := 0; start < len(sources); start += indexReadBatch {
+				batch := sources[start:]
+				if len(batch) > indexReadBatch {
+					batch = batch[:indexReadBatch]
+				}
+
+				futures = futures[:0]
+				for _, src := range batch {
+					futures = append(futures, tr.Get(append(append(fdb.Key{}, dir.Bytes()...), src.packed...)))
+				}
+
+				for i, future := range futures {
+					valBytes, err := future.Get()
+					if err != nil {
+						return nil, errors.Wrap(err, "failed to read key from index entry")
+					}
+					value, err := valHandler.Handle(valBytes)
+					if err != nil {
+						return nil, errors.Wrap(err, "failed to unpack value")
+					}
+					if value == nil {
+						continue
+					}
+
+					if !s.SendKV(out, stream.KeyValErr{KV: keyval.KeyValue{Key: keyval.Key{Directory: dirPath, Tuple: batch[i].tup}, Value: value}}) {
+						return nil, nil
+					}
+					sent++
+					if opts.Limit > 0 && sent >= opts.Limit {
+						return nil, nil
+					}
+				}
+			}
+			return nil, nil
+		})
+		return nil, err
+	})
+	return err
+}
+
+// tupleWithin returns true if every tuple matched by
+// the query is guaranteed to be matched by the schema.
+func tupleWithin(query keyval.Tuple, schema keyval.Tuple) bool {
+	queryMore := len(query) > 0 && isMaybeMore(query[len(query)-1])
+	if queryMore {
+		query = query[:len(query)-1]
+	}
+	schemaMore := len(schema) > 0 && isMaybeMore(schema[len(schema)-1])
+	if schemaMore {
+		schema = schema[:len(schema)-1]
+	}
+
+	switch {
+	case queryMore && !schemaMore:
+		return false
+	case schemaMore:
+		if len(query) < len(schema) {
+			return false
+		}
+	default:
+		if len(query) != len(schema) {
+			return false
+		}
+	}
+
+	for i, element := range schema {
+		if !elementWithin(query[i], element) {
+			return false
+		}
+	}
+	return true
+}
+
+// elementWithin returns true if every tuple element matched
+// by the query is guaranteed to be matched by the schema.
+func elementWithin(query keyval.TupElement, schema keyval.TupElement) bool {
+	if isConstant(query) {
+		return compare.Tuples(keyval.Tuple{schema}, keyval.Tuple{query}) == nil
+	}
+
+	switch schema := schema.(type) {
+	case keyval.Variable:
+		switch query := query.(type) {
+		case keyval.Variable:
+			return typesWithin(query, schema)
+		case keyval.Predicate:
+			return typesWithin(query.Variable, schema)
+		case keyval.Tuple:
+			return typesWithin(keyval.Variable{keyval.TupleType}, schema)
+		default:
+			return false
+		}
+
+	case keyval.Tuple:
+		query, ok := query.(keyval.Tuple)
+		return ok && tupleWithin(query, schema)
+
+	default:
+		return false
+	}
+}
+
+// valueWithin returns true if every value matched by
+// the query is guaranteed to be matched by the schema.
+func valueWithin(query keyval.Value, schema keyval.Value, order binary.ByteOrder) bool {
+	if variable, ok := schema.(keyval.Variable); ok && len(variable) == 0 {
+		return true
+	}
+
+	switch query := query.(type) {
+	case keyval.Variable:
+		schema, ok := schema.(keyval.Variable)
+		return ok && len(query) > 0 && typesWithin(query, schema)
+
+	case keyval.Predicate:
+		// Predicates with an empty variable
+		// are decoded as bytes.
+		variable := query.Variable
+		if len(variable) == 0 {
+			variable = keyval.Variable{keyval.BytesType}
+		}
+		schema, ok := schema.(keyval.Variable)
+		return ok && typesWithin(variable, schema)
+
+	default:
+		packed, err := values.Pack(query, order)
+		if err != nil {
+			return false
+		}
+		handler, err := internal.NewValueHandler(schema, order, true)
+		if err != nil {
+			return false
+		}
+		value, err := handler.Handle(packed)
+		return err == nil && value != nil
+	}
+}
+
+// typesWithin returns true if every value matched by the query
+// variable is guaranteed to be matched by the schema variable.
+// An empty variable matches any type.
+func typesWithin(query keyval.Variable, schema keyval.Variable) bool {
+	if len(schema) == 0 {
+		return true
+	}
+	for _, typ := range schema {
+		if typ == keyval.AnyType {
+			return true
+		}
+	}
+	if len(query) == 0 {
+		return false
+	}
+	for _, typ := range query {
+		found := false
+		for _, other := range schema {
+			if typ == other {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isMaybeMore returns true if
+// the element is a MaybeMore.
+func isMaybeMore(element keyval.TupElement) bool {
+	_, ok := element.(keyval.MaybeMore)
+	return ok
+}
+
+// isConstant returns true if the given
+// element contains no variables.
+func isConstant(element keyval.TupElement) bool {
+	switch element := element.(type) {
+	case keyval.Variable, keyval.Predicate, keyval.MaybeMore, keyval.Reference:
+		return false
+	case keyval.Tuple:
+		for _, e := range element {
+			if !isConstant(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
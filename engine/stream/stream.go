@@ -2,8 +2,12 @@
 package stream
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
@@ -17,11 +21,71 @@ import (
 	"github.com/janderland/fdbq/keyval/convert"
 )
 
+const (
+	// resumeAfter is how long a transaction reads before a resumable
+	// range read continues in a new transaction. FDB transactions
+	// become too old after 5 seconds.
+	resumeAfter = 3 * time.Second
+
+	// resumeBatchSize is the batch size used by resumable range reads
+	// when [RangeOpts.BatchSize] isn't specified.
+	resumeBatchSize = 1000
+)
+
 type (
 	// RangeOpts configures how a Stream performs a range read.
 	RangeOpts struct {
 		Reverse bool
-		Limit   int
+
+		// Limit, when non-zero, bounds the number of
+		// key-values read from each directory.
+		Limit int
+
+		// TotalLimit causes Limit to bound the total number
+		// of key-values read across all the directories.
+		TotalLimit bool
+
+		// Mode is the streaming mode used for reading
+		// each batch of key-values.
+		Mode fdb.StreamingMode
+
+		// BatchSize, when non-zero, is the number of key-values
+		// requested by each range read. The range is read via
+		// multiple requests which resume after the last key
+		// of the previous batch. When zero, the batches are
+		// sized by FDB according to the streaming mode.
+		BatchSize int
+
+		// After, when non-nil, causes the range read to continue
+		// after the given position. Directories before the position
+		// are skipped, as are the keys of the position's directory
+		// which come before (or after, when reversed) its key.
+		After *Position
+
+		// Resume allows a range read to span multiple transactions.
+		// Before a transaction becomes too old, the range read is
+		// resumed in a new transaction after the last key read. This
+		// allows for arbitrarily long range reads, but the key-values
+		// aren't read from a consistent snapshot of the DB. Resume has
+		// no effect if the transactor is itself a transaction.
+		Resume bool
+
+		// Distinct, when non-zero, groups the keys of each directory
+		// by their first Distinct tuple elements and only reads the
+		// first key-value of each group. After a key-value is read,
+		// the read skips past the rest of its group using a range
+		// beginning at strinc of the group's prefix, so each group
+		// costs a single read. Keys which can't be unpacked as
+		// tuples or have fewer elements form their own group.
+		Distinct int
+	}
+
+	// Position identifies a key-value read by [Stream.ReadRange].
+	// Dir is the path of the key-value's directory and Key is the
+	// key-value's key with the directory prefix removed.
+	Position struct {
+		Dir []string
+		Key []byte
 	}
 
 	// DirErr is streamed from a call to [Stream.OpenDirectories].
@@ -49,6 +113,21 @@ type (
 		Err error
 	}
 
+	// ViolationErr is streamed from a call to [Stream.Audit]. If Err
+	// is nil, KV is the key-value which doesn't conform to the query,
+	// Kind categorizes the violation, and Reason describes it. If Err
+	// is non-nil, the other fields should be empty.
+	ViolationErr struct {
+		KV     keyval.KeyValue
+		Kind   ViolationKind
+		Reason string
+		Err    error
+	}
+
+	// ViolationKind categorizes why a key-value
+	// doesn't conform to a query.
+	ViolationKind int
+
 	// Option can be passed as a trailing argument to the New function
 	// to modify properties of the created Stream.
 	Option func(*Stream)
@@ -62,6 +141,33 @@ type (
 	}
 )
 
+const (
+	// InvalidKey means the key isn't a valid tuple. The
+	// KV of the ViolationErr will have a nil tuple.
+	InvalidKey ViolationKind = iota
+
+	// KeyMismatch means the key's tuple doesn't
+	// conform to the query's tuple.
+	KeyMismatch
+
+	// ValueMismatch means the value doesn't
+	// conform to the query's value.
+	ValueMismatch
+)
+
+func (x ViolationKind) String() string {
+	switch x {
+	case InvalidKey:
+		return "invalid key"
+	case KeyMismatch:
+		return "key mismatch"
+	case ValueMismatch:
+		return "value mismatch"
+	default:
+		return fmt.Sprintf("ViolationKind(%d)", int(x))
+	}
+}
+
 // New constructs a new Stream. The context provides a way
 // to cancel any pipelines created with this Stream.
 func New(ctx context.Context, opts ...Option) Stream {
@@ -127,6 +233,18 @@ func (x *Stream) SendKV(out chan<- KeyValErr, in KeyValErr) bool {
 	}
 }
 
+// SendViolation sends the given ViolationErr onto the given channel and
+// returns true. If the context.Context associated with this Stream is
+// canceled, then nothing is sent and false is returned.
+func (x *Stream) SendViolation(out chan<- ViolationErr, in ViolationErr) bool {
+	select {
+	case <-x.ctx.Done():
+		return false
+	case out <- in:
+		return true
+	}
+}
+
 // OpenDirectories executes the given directory query in a separate goroutine using the given
 // transactor. When the goroutine exits, the returned channel is closed. If the associated
 // context.Context is canceled, then the goroutine exits after the latest FDB call.
@@ -144,8 +262,9 @@ func (x *Stream) OpenDirectories(tr facade.ReadTransactor, query keyval.Director
 // ReadRange executes range-reads in a separate goroutine using the given transactor. When the goroutine exits, the
 // returned channel is closed. Any errors read from the input channel are wrapped and forwarded. For each directory
 // read from the input channel, a range-read is performed using the tuple prefix defined by the given [keyval.Tuple].
-// If the associated context.Context is canceled, then the goroutine exits after the latest FDB call.
-func (x *Stream) ReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts RangeOpts, in chan DirErr) chan DirKVErr {
+// If the associated context.Context is canceled, then the goroutine exits after the latest FDB call. Unless
+// [RangeOpts.Resume] is set, each directory is read within a single transaction.
+func (x *Stream) ReadRange(tr facade.ReadTransactor, query keyval.Tuple, opts RangeOpts, in chan DirErr) chan DirKVErr {
 	out := make(chan DirKVErr)
 
 	go func() {
@@ -186,6 +305,20 @@ func (x *Stream) UnpackValues(query keyval.Value, filter bool, in chan KeyValErr
 	return out
 }
 
+// Audit checks each key-value against the given query in a separate goroutine, streaming a ViolationErr
+// for each key-value which doesn't conform. Conforming key-values are not streamed. When the goroutine
+// exits, the returned channel is closed. Any errors read from the input channel are wrapped and forwarded.
+func (x *Stream) Audit(query keyval.KeyValue, in chan DirKVErr) chan ViolationErr {
+	out := make(chan ViolationErr)
+
+	go func() {
+		defer close(out)
+		x.goAudit(query, in, out)
+	}()
+
+	return out
+}
+
 func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Directory, out chan DirErr) {
 	log := x.log.With().Str("stage", "open directories").Interface("query", query).Logger()
 
@@ -242,7 +375,7 @@ func (x *Stream) goOpenDirectories(tr facade.ReadTransactor, query keyval.Direct
 	}
 }
 
-func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts RangeOpts, in chan DirErr, out chan DirKVErr) {
+func (x *Stream) goReadRange(tr facade.ReadTransactor, query keyval.Tuple, opts RangeOpts, in chan DirErr, out chan DirKVErr) {
 	log := x.log.With().Str("stage", "read range").Interface("query", query).Logger()
 
 	prefix := toTuplePrefix(query)
@@ -253,6 +386,7 @@ func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts
 		return
 	}
 
+	remaining := opts.Limit
 	for msg := range in {
 		if msg.Err != nil {
 			x.SendDirKV(out, DirKVErr{Err: errors.Wrap(msg.Err, "read range input closed")})
@@ -269,24 +403,276 @@ func (x *Stream) goReadRange(tr facade.ReadTransaction, query keyval.Tuple, opts
 			return
 		}
 
-		iter := tr.GetRange(rng, fdb.RangeOptions{
-			Reverse: opts.Reverse,
-			Limit:   opts.Limit,
-		}).Iterator()
+		if opts.After != nil {
+			c := comparePaths(dir.GetPath(), opts.After.Dir)
+			if c < 0 {
+				log.Log().Msg("skipping directory before position")
+				continue
+			}
+			if c == 0 {
+				rng = rangeAfter(rng, dir, opts.After.Key, opts.Reverse)
+			}
+		}
+
+		dirOpts := opts
+		if opts.TotalLimit {
+			dirOpts.Limit = remaining
+		}
 
-		for iter.Advance() {
-			kv, err := iter.Get()
+		var (
+			sent int
+			ok   bool
+		)
+		if opts.Resume {
+			sent, ok = x.readResumable(log, tr, dir, rng, dirOpts, out)
+		} else {
+			_, err = tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+				sent, ok = x.readDirectory(tr, dir, rng, dirOpts, out)
+				return nil, nil
+			})
 			if err != nil {
-				x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "failed to get key-value")})
+				x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "transaction failed")})
 				return
 			}
-			if !x.SendDirKV(out, DirKVErr{Dir: dir, KV: kv}) {
+		}
+		if !ok {
+			return
+		}
+
+		if opts.TotalLimit && opts.Limit > 0 {
+			remaining -= sent
+			if remaining <= 0 {
 				return
 			}
 		}
 	}
 }
 
+// comparePaths compares directory paths element by element,
+// returning -1, 0, or 1 like [strings.Compare]. A path which
+// is the prefix of another path comes first.
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// rangeAfter narrows the range to the keys after the given key, which has
+// its directory prefix removed. When reverse is true, the range is narrowed
+// to the keys before the given key.
+func rangeAfter(rng fdb.KeyRange, dir directory.DirectorySubspace, key []byte, reverse bool) fdb.KeyRange {
+	full := append(append(fdb.Key{}, dir.Bytes()...), key...)
+	if reverse {
+		if bytes.Compare(full, rng.End.FDBKey()) < 0 {
+			rng.End = full
+		}
+	} else {
+		full = append(full, 0x00)
+		if bytes.Compare(full, rng.Begin.FDBKey()) > 0 {
+			rng.Begin = full
+		}
+	}
+	return rng
+}
+
+// readDirectory reads the given range of the directory within the given transaction.
+// The number of key-values sent is returned. If the caller should stop reading, false
+// is also returned.
+func (x *Stream) readDirectory(tr facade.ReadTransaction, dir directory.DirectorySubspace, rng fdb.KeyRange, opts RangeOpts, out chan DirKVErr) (int, bool) {
+	if opts.BatchSize > 0 || opts.Distinct > 0 {
+		batches := newBatchReader(dir, rng, opts, opts.BatchSize)
+		status, err := batches.read(x, tr, time.Time{}, out)
+		if err != nil {
+			x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "failed to get key-values")})
+			return batches.sent, false
+		}
+		return batches.sent, status == batchesDone
+	}
+
+	iter := tr.GetRange(rng, fdb.RangeOptions{
+		Reverse: opts.Reverse,
+		Limit:   opts.Limit,
+		Mode:    opts.Mode,
+	}).Iterator()
+
+	sent := 0
+	for iter.Advance() {
+		kv, err := iter.Get()
+		if err != nil {
+			x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "failed to get key-value")})
+			return sent, false
+		}
+		if !x.SendDirKV(out, DirKVErr{Dir: dir, KV: kv}) {
+			return sent, false
+		}
+		sent++
+	}
+	return sent, true
+}
+
+// readResumable reads the given range of the directory across as many transactions
+// as needed. Each transaction reads batches until resumeAfter has elapsed, and then
+// the read is resumed in a new transaction. The number of key-values sent is returned.
+// If the caller should stop reading, false is also returned.
+func (x *Stream) readResumable(log zerolog.Logger, tr facade.ReadTransactor, dir directory.DirectorySubspace, rng fdb.KeyRange, opts RangeOpts, out chan DirKVErr) (int, bool) {
+	batchSize := opts.BatchSize
+	if batchSize == 0 {
+		batchSize = resumeBatchSize
+	}
+	batches := newBatchReader(dir, rng, opts, batchSize)
+
+	for {
+		// If the transaction is retried, the batch reader
+		// continues after the last key sent, so no key-value
+		// is sent twice.
+		status, err := tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+			return batches.read(x, tr, time.Now().Add(resumeAfter), out)
+		})
+		if err != nil {
+			x.SendDirKV(out, DirKVErr{Err: errors.Wrap(err, "transaction failed")})
+			return batches.sent, false
+		}
+
+		switch status.(batchStatus) {
+		case batchesDone:
+			return batches.sent, true
+		case batchesStopped:
+			return batches.sent, false
+		}
+		log.Log().Msg("resuming range read in a new transaction")
+	}
+}
+
+type batchStatus int
+
+const (
+	// batchesDone means the entire range was read.
+	batchesDone batchStatus = iota
+
+	// batchesStopped means the reader should stop
+	// because the output channel is closed.
+	batchesStopped
+
+	// batchesPaused means the deadline passed before
+	// the entire range was read.
+	batchesPaused
+)
+
+// batchReader reads a range as a series of batches, each requesting at most
+// batchSize key-values. Each batch resumes after the last key of the previous
+// batch, even if the batches are read by different transactions. If
+// RangeOpts.Distinct is set, each batch requests a single key-value and
+// resumes after the last key's group.
+type batchReader struct {
+	dir       directory.DirectorySubspace
+	rng       fdb.KeyRange
+	opts      RangeOpts
+	batchSize int
+	remaining int
+	sent      int
+}
+
+func newBatchReader(dir directory.DirectorySubspace, rng fdb.KeyRange, opts RangeOpts, batchSize int) *batchReader {
+	return &batchReader{
+		dir:       dir,
+		rng:       rng,
+		opts:      opts,
+		batchSize: batchSize,
+		remaining: opts.Limit,
+	}
+}
+
+// read sends batches of key-values to the output channel until the range is
+// exhausted, the output channel is closed, or the deadline passes. A zero
+// deadline never passes.
+func (x *batchReader) read(s *Stream, tr facade.ReadTransaction, deadline time.Time, out chan DirKVErr) (batchStatus, error) {
+	for deadline.IsZero() || time.Now().Before(deadline) {
+		limit := x.batchSize
+		if x.opts.Distinct > 0 {
+			limit = 1
+		}
+		if x.opts.Limit > 0 && x.remaining < limit {
+			limit = x.remaining
+		}
+
+		kvs, err := tr.GetRange(x.rng, fdb.RangeOptions{
+			Reverse: x.opts.Reverse,
+			Limit:   limit,
+			Mode:    x.opts.Mode,
+		}).GetSliceWithError()
+		if err != nil {
+			// The error isn't wrapped so FDB's retry
+			// loop can recognize retryable errors.
+			return 0, err
+		}
+
+		for _, kv := range kvs {
+			if !s.SendDirKV(out, DirKVErr{Dir: x.dir, KV: kv}) {
+				return batchesStopped, nil
+			}
+			x.sent++
+		}
+
+		x.remaining -= len(kvs)
+		if len(kvs) < limit || (x.opts.Limit > 0 && x.remaining == 0) {
+			return batchesDone, nil
+		}
+
+		last := kvs[len(kvs)-1].Key
+		if x.opts.Distinct > 0 {
+			if !x.skipGroup(last) {
+				return batchesDone, nil
+			}
+			continue
+		}
+		if x.opts.Reverse {
+			x.rng.End = last
+		} else {
+			x.rng.Begin = append(append(fdb.Key{}, last...), 0x00)
+		}
+	}
+	return batchesPaused, nil
+}
+
+// skipGroup narrows the range to exclude the group of the given key,
+// which is identified by the key's first RangeOpts.Distinct tuple
+// elements. If the range no longer contains any keys, false is
+// returned.
+func (x *batchReader) skipGroup(key fdb.Key) bool {
+	begin := append(append(fdb.Key{}, key...), 0x00)
+	end := key
+
+	if tup, err := x.dir.Unpack(key); err == nil && len(tup) >= x.opts.Distinct {
+		prefix := x.dir.Pack(tup[:x.opts.Distinct])
+		if next, err := fdb.Strinc(prefix); err == nil {
+			begin, end = next, prefix
+		}
+	}
+
+	if x.opts.Reverse {
+		if bytes.Compare(end, x.rng.Begin.FDBKey()) <= 0 {
+			return false
+		}
+		x.rng.End = end
+	} else {
+		if bytes.Compare(begin, x.rng.End.FDBKey()) >= 0 {
+			return false
+		}
+		x.rng.Begin = fdb.Key(begin)
+	}
+	return true
+}
+
 func (x *Stream) goUnpackKeys(query keyval.Tuple, filter bool, in chan DirKVErr, out chan KeyValErr) {
 	log := x.log.With().Str("stage", "unpack keys").Interface("query", query).Logger()
 
@@ -364,6 +750,56 @@ func (x *Stream) goUnpackValues(query keyval.Value, filter bool, in chan KeyValE
 	}
 }
 
+func (x *Stream) goAudit(query keyval.KeyValue, in chan DirKVErr, out chan ViolationErr) {
+	log := x.log.With().Str("stage", "audit").Interface("query", query).Logger()
+
+	valHandler, err := internal.NewValueHandler(query.Value, x.order, false)
+	if err != nil {
+		x.SendViolation(out, ViolationErr{Err: err})
+		return
+	}
+
+	for msg := range in {
+		if msg.Err != nil {
+			x.SendViolation(out, ViolationErr{Err: errors.Wrap(msg.Err, "audit input closed")})
+			return
+		}
+
+		dir := msg.Dir
+		log := log.With().Interface("dir", dir.GetPath()).Logger()
+		log.Log().Msg("received key-value")
+
+		kv := keyval.KeyValue{
+			Key:   keyval.Key{Directory: convert.FromStringArray(dir.GetPath())},
+			Value: keyval.Bytes(msg.KV.Value),
+		}
+
+		violation := ViolationErr{KV: kv}
+		if tup, err := dir.Unpack(msg.KV.Key); err != nil {
+			violation.Kind = InvalidKey
+			violation.Reason = err.Error()
+		} else {
+			kv.Key.Tuple = convert.FromFDBTuple(tup)
+			violation.KV = kv
+
+			if mismatch := compare.Tuples(query.Key.Tuple, kv.Key.Tuple); mismatch != nil {
+				violation.Kind = KeyMismatch
+				violation.Reason = fmt.Sprintf("key's tuple disobeys schema at index path %v", mismatch)
+			} else if _, err := valHandler.Handle(msg.KV.Value); err != nil {
+				violation.Kind = ValueMismatch
+				violation.Reason = err.Error()
+			} else {
+				continue
+			}
+		}
+
+		log.Log().Interface("kv", kv).Str("reason", violation.Reason).Msg("sending violation")
+		if !x.SendViolation(out, violation) {
+			return
+		}
+	}
+}
+
 func splitAtFirstVariable(dir keyval.Directory) (keyval.Directory, *keyval.Variable, keyval.Directory) {
 	for i, element := range dir {
 		if variable, ok := element.(keyval.Variable); ok {
@@ -375,7 +811,8 @@ func splitAtFirstVariable(dir keyval.Directory) (keyval.Directory, *keyval.Varia
 
 func toTuplePrefix(tup keyval.Tuple) keyval.Tuple {
 	for i, element := range tup {
-		if _, ok := element.(keyval.Variable); ok {
+		switch element.(type) {
+		case keyval.Variable, keyval.Predicate:
 			return tup[:i]
 		}
 	}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
@@ -174,6 +175,299 @@ func TestStream_ReadRange(t *testing.T) {
 	}
 }
 
+func TestStream_ReadRangeBatches(t *testing.T) {
+	var initial []q.KeyValue
+	for i := 0; i < 10; i++ {
+		initial = append(initial, q.KeyValue{
+			Key:   q.Key{Directory: q.Directory{q.String("batches")}, Tuple: q.Tuple{q.Int(i)}},
+			Value: q.Nil{},
+		})
+	}
+
+	reversed := make([]q.KeyValue, len(initial))
+	for i, kv := range initial {
+		reversed[len(initial)-1-i] = kv
+	}
+
+	var tests = []struct {
+		name     string
+		opts     RangeOpts
+		expected []q.KeyValue
+	}{
+		{
+			name:     "forward",
+			opts:     RangeOpts{BatchSize: 3},
+			expected: initial,
+		},
+		{
+			name:     "reverse",
+			opts:     RangeOpts{BatchSize: 3, Reverse: true},
+			expected: reversed,
+		},
+		{
+			name:     "limit",
+			opts:     RangeOpts{BatchSize: 3, Limit: 5},
+			expected: initial[:5],
+		},
+		{
+			name:     "exact",
+			opts:     RangeOpts{BatchSize: 4, Mode: fdb.StreamingModeExact},
+			expected: initial,
+		},
+		{
+			name:     "batch larger than range",
+			opts:     RangeOpts{BatchSize: 100, Mode: fdb.StreamingModeWantAll},
+			expected: initial,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testEnv(t, func(tr facade.Transaction, s Stream) {
+				dirsByPath, uniqueDirs := openDirs(t, tr, initial)
+				for _, dirKV := range buildDirKVs(t, dirsByPath, initial) {
+					tr.Set(dirKV.kv.Key, dirKV.kv.Value)
+				}
+
+				expected := buildDirKVs(t, dirsByPath, test.expected)
+
+				ch := s.ReadRange(tr, q.Tuple{}, test.opts, sendDirs(t, s, uniqueDirs))
+				actual, err := collectDirKVs(ch)
+				require.NoError(t, err, "failed to read range")
+				require.Equal(t, expected, actual)
+			})
+		})
+	}
+}
+
+func TestStream_ReadRangeDistinct(t *testing.T) {
+	var initial []q.KeyValue
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 3; j++ {
+			initial = append(initial, q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("distinct")}, Tuple: q.Tuple{q.Int(i), q.Int(j)}},
+				Value: q.Nil{},
+			})
+		}
+	}
+
+	var (
+		firsts []q.KeyValue
+		lasts  []q.KeyValue
+	)
+	for i := 0; i < len(initial); i += 3 {
+		firsts = append(firsts, initial[i])
+		lasts = append([]q.KeyValue{initial[i+2]}, lasts...)
+	}
+
+	var tests = []struct {
+		name     string
+		opts     RangeOpts
+		expected []q.KeyValue
+	}{
+		{
+			name:     "forward",
+			opts:     RangeOpts{Distinct: 1},
+			expected: firsts,
+		},
+		{
+			name:     "reverse",
+			opts:     RangeOpts{Distinct: 1, Reverse: true},
+			expected: lasts,
+		},
+		{
+			name:     "limit",
+			opts:     RangeOpts{Distinct: 1, Limit: 2},
+			expected: firsts[:2],
+		},
+		{
+			name:     "resume",
+			opts:     RangeOpts{Distinct: 1, Resume: true},
+			expected: firsts,
+		},
+		{
+			name:     "whole key",
+			opts:     RangeOpts{Distinct: 2, BatchSize: 5},
+			expected: initial,
+		},
+		{
+			name:     "longer than key",
+			opts:     RangeOpts{Distinct: 3},
+			expected: initial,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testEnv(t, func(tr facade.Transaction, s Stream) {
+				dirsByPath, uniqueDirs := openDirs(t, tr, initial)
+				for _, dirKV := range buildDirKVs(t, dirsByPath, initial) {
+					tr.Set(dirKV.kv.Key, dirKV.kv.Value)
+				}
+
+				expected := buildDirKVs(t, dirsByPath, test.expected)
+
+				ch := s.ReadRange(tr, q.Tuple{}, test.opts, sendDirs(t, s, uniqueDirs))
+				actual, err := collectDirKVs(ch)
+				require.NoError(t, err, "failed to read range")
+				require.Equal(t, expected, actual)
+			})
+		})
+	}
+}
+
+func TestStream_ReadRangeAfter(t *testing.T) {
+	var initial []q.KeyValue
+	for _, dir := range []string{"a", "b", "c"} {
+		for i := 0; i < 3; i++ {
+			initial = append(initial, q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("after"), q.String(dir)}, Tuple: q.Tuple{q.Int(i)}},
+				Value: q.Nil{},
+			})
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		opts     RangeOpts
+		after    int
+		expected []q.KeyValue
+	}{
+		{
+			name:     "first directory",
+			after:    1,
+			expected: initial[2:],
+		},
+		{
+			name:     "end of directory",
+			after:    5,
+			expected: initial[6:],
+		},
+		{
+			name:     "limit per directory",
+			opts:     RangeOpts{Limit: 1},
+			after:    1,
+			expected: []q.KeyValue{initial[2], initial[3], initial[6]},
+		},
+		{
+			name:     "limit across directories",
+			opts:     RangeOpts{Limit: 4, TotalLimit: true},
+			after:    1,
+			expected: initial[2:6],
+		},
+		{
+			name:     "batches",
+			opts:     RangeOpts{BatchSize: 2, Limit: 4, TotalLimit: true},
+			after:    4,
+			expected: initial[5:],
+		},
+		{
+			name:     "reverse",
+			opts:     RangeOpts{Reverse: true},
+			after:    4,
+			expected: []q.KeyValue{initial[3], initial[8], initial[7], initial[6]},
+		},
+		{
+			name:     "last",
+			after:    8,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testEnv(t, func(tr facade.Transaction, s Stream) {
+				dirsByPath, uniqueDirs := openDirs(t, tr, initial)
+				dirKVs := buildDirKVs(t, dirsByPath, initial)
+				for _, dirKV := range dirKVs {
+					tr.Set(dirKV.kv.Key, dirKV.kv.Value)
+				}
+
+				after := dirKVs[test.after]
+				opts := test.opts
+				opts.After = &Position{
+					Dir: after.dir.GetPath(),
+					Key: after.kv.Key[len(after.dir.Bytes()):],
+				}
+
+				ch := s.ReadRange(tr, q.Tuple{}, opts, sendDirs(t, s, uniqueDirs))
+				actual, err := collectDirKVs(ch)
+				require.NoError(t, err, "failed to read range")
+
+				var expected []DirKV
+				if test.expected != nil {
+					expected = buildDirKVs(t, dirsByPath, test.expected)
+				}
+				require.Equal(t, expected, actual)
+			})
+		})
+	}
+}
+
+func BenchmarkStream_ReadRange(b *testing.B) {
+	const count = 10000
+
+	modes := []struct {
+		name string
+		opts RangeOpts
+	}{
+		{name: "want all", opts: RangeOpts{Mode: fdb.StreamingModeWantAll}},
+		{name: "iterator", opts: RangeOpts{Mode: fdb.StreamingModeIterator}},
+		{name: "exact", opts: RangeOpts{Mode: fdb.StreamingModeExact, BatchSize: 1000}},
+		{name: "small", opts: RangeOpts{Mode: fdb.StreamingModeSmall}},
+		{name: "serial", opts: RangeOpts{Mode: fdb.StreamingModeSerial}},
+		{name: "batch 100", opts: RangeOpts{BatchSize: 100}},
+		{name: "batch 1000", opts: RangeOpts{BatchSize: 1000}},
+	}
+
+	internal.TestEnv(b, force, func(tr facade.Transactor, _ zerolog.Logger) {
+		dir, err := tr.Transact(func(tr facade.Transaction) (interface{}, error) {
+			dir, err := tr.DirCreateOrOpen([]string{"bench"})
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < count; i++ {
+				tr.Set(dir.Pack(tuple.Tuple{i}), make([]byte, 100))
+			}
+			return dir, nil
+		})
+		if err != nil {
+			b.Fatal(errors.Wrap(err, "failed to write key-values"))
+		}
+
+		for _, mode := range modes {
+			b.Run(mode.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := tr.ReadTransact(func(tr facade.ReadTransaction) (interface{}, error) {
+						ctx, cancel := context.WithCancel(context.Background())
+						defer cancel()
+
+						s := New(ctx)
+						dirs := make(chan DirErr, 1)
+						dirs <- DirErr{Dir: dir.(directory.DirectorySubspace)}
+						close(dirs)
+
+						n := 0
+						for msg := range s.ReadRange(tr, q.Tuple{}, mode.opts, dirs) {
+							if msg.Err != nil {
+								return nil, msg.Err
+							}
+							n++
+						}
+						if n != count {
+							return nil, errors.Errorf("read %d key-values, expected %d", n, count)
+						}
+						return nil, nil
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	})
+}
+
 func TestStream_UnpackKeys(t *testing.T) {
 	var tests = []struct {
 		name     string
@@ -327,6 +621,36 @@ func TestStream_UnpackValues(t *testing.T) {
 	}
 }
 
+func TestStream_Audit(t *testing.T) {
+	dir := q.Directory{q.String("audit")}
+	query := q.KeyValue{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Variable{q.IntType}}}, Value: q.Variable{q.IntType}}
+
+	initial := []q.KeyValue{
+		{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Int(1)}}, Value: q.Int(1)},
+		{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.Int(2)}}, Value: q.String("hi")},
+		{Key: q.Key{Directory: dir, Tuple: q.Tuple{q.String("bad")}}, Value: q.Int(3)},
+	}
+
+	testEnv(t, func(tr facade.Transaction, s Stream) {
+		dirsByPath, uniqueDirs := openDirs(t, tr, initial)
+		for _, dirKV := range buildDirKVs(t, dirsByPath, initial) {
+			tr.Set(dirKV.kv.Key, dirKV.kv.Value)
+		}
+
+		// This key isn't a valid tuple.
+		invalid := append(append(fdb.Key{}, uniqueDirs[0].Bytes()...), 0x0a)
+		tr.Set(invalid, nil)
+
+		var kinds []ViolationKind
+		for msg := range s.Audit(query, s.ReadRange(tr, q.Tuple{}, RangeOpts{}, sendDirs(t, s, uniqueDirs))) {
+			require.NoError(t, msg.Err)
+			require.NotEmpty(t, msg.Reason)
+			kinds = append(kinds, msg.Kind)
+		}
+		require.Equal(t, []ViolationKind{KeyMismatch, InvalidKey, ValueMismatch}, kinds)
+	})
+}
+
 func TestSplitAtFirstVariable(t *testing.T) {
 	prefix, variable, suffix := splitAtFirstVariable(q.Directory{
 		q.String("one"), q.Variable{q.FloatType}, q.String("-39.9"),
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
@@ -15,7 +18,11 @@ import (
 	"github.com/janderland/fdbq/engine/facade"
 	"github.com/janderland/fdbq/internal/app/fullscreen"
 	"github.com/janderland/fdbq/internal/app/headless"
+	"github.com/janderland/fdbq/internal/app/kvfile"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/parser"
 	"github.com/janderland/fdbq/parser/format"
+	"github.com/janderland/fdbq/parser/scanner"
 )
 
 var (
@@ -33,6 +40,14 @@ var (
 
 func init() {
 	flags = SetupFlags(FDBQ)
+	FDBQ.AddCommand(dirCmd)
+	FDBQ.AddCommand(importCmd)
+	FDBQ.AddCommand(exportCmd)
+	FDBQ.AddCommand(restoreCmd)
+	FDBQ.AddCommand(diffCmd)
+	FDBQ.AddCommand(rewriteCmd)
+	FDBQ.AddCommand(undoCmd)
+	FDBQ.AddCommand(reindexCmd)
 }
 
 var FDBQ = &cobra.Command{
@@ -45,40 +60,37 @@ var FDBQ = &cobra.Command{
 			return errors.New("unexpected positional args")
 		}
 
-		log := zerolog.Nop()
-		if flags.Log {
-			var writer io.Writer = zerolog.ConsoleWriter{
-				Out:         os.Stderr,
-				FormatLevel: func(_ interface{}) string { return "" },
-			}
-			if flags.Fullscreen() {
-				file, err := os.Create(flags.LogFile)
-				if err != nil {
-					return errors.Wrap(err, "failed to open logging file")
-				}
-				defer func() {
-					if err := file.Close(); err != nil {
-						fmt.Println(errors.Wrap(err, "failed to close logging file"))
-					}
-				}()
-				writer = file
-			}
-			log = zerolog.New(writer).With().Timestamp().Logger()
+		log, closeLog, err := newLogger(flags.Fullscreen())
+		if err != nil {
+			return err
 		}
+		defer closeLog()
 
-		log.Log().Str("cluster file", flags.Cluster).Msg("connecting to DB")
-		if err := fdb.APIVersion(APIVersion); err != nil {
-			return errors.Wrap(err, "failed to set FDB API version")
+		journal, closeJournal, err := newJournal()
+		if err != nil {
+			return err
 		}
-		db, err := fdb.OpenDatabase(flags.Cluster)
+		defer closeJournal()
+
+		eg, err := newEngine(log, journal...)
 		if err != nil {
-			return errors.Wrap(err, "failed to connect to DB")
+			return err
 		}
 
-		eg := engine.New(
-			facade.NewTransactor(db, directory.Root()),
-			engine.ByteOrder(flags.ByteOrder()),
-			engine.Logger(log))
+		rangeOpts, err := flags.RangeOpts()
+		if err != nil {
+			return err
+		}
+		if flags.DryRun && flags.Watch {
+			return errors.New("watches can't be used during a dry run")
+		}
+		if flags.DryRun && flags.Journal != "" {
+			return errors.New("a journal can't be used during a dry run")
+		}
+		selectFormat, err := kvfile.ParseSelectFormat(flags.SelectFormat)
+		if err != nil {
+			return err
+		}
 
 		fmt := format.New(flags.FormatOpts()...)
 		out := os.Stdout
@@ -90,9 +102,12 @@ var FDBQ = &cobra.Command{
 				Log:    log,
 				Out:    out,
 
-				Write:      flags.Write,
-				SingleOpts: flags.SingleOpts(),
-				RangeOpts:  flags.RangeOpts(),
+				Write:       flags.Write,
+				Watch:       flags.Watch,
+				ReadVersion: flags.ReadVersion,
+				SingleOpts:  flags.SingleOpts(),
+				RangeOpts:   rangeOpts,
+				DryRun:      flags.DryRun,
 			}
 			return app.Run(cmd.Context())
 		}
@@ -101,11 +116,218 @@ var FDBQ = &cobra.Command{
 			Engine: eg,
 			Format: fmt,
 			Out:    out,
+			Warn:   os.Stderr,
+
+			Write:       flags.Write,
+			RangeClear:  flags.RangeClear,
+			Watch:       flags.Watch,
+			ReadVersion: flags.ReadVersion,
+			ShowVersion: flags.ShowVersion,
+			Count:       flags.Count,
+			Audit:       flags.Audit,
+			Bulk:        flags.Bulk,
+			SingleOpts:  flags.SingleOpts(),
+			RangeOpts:   rangeOpts,
+			DryRun:      flags.DryRun,
+			Explain:     flags.Explain,
+
+			Select:       flags.Select,
+			SelectFormat: selectFormat,
 
-			Write:      flags.Write,
-			SingleOpts: flags.SingleOpts(),
-			RangeOpts:  flags.RangeOpts(),
+			GroupBy: flags.GroupBy,
 		}
 		return app.Run(cmd.Context(), flags.Queries)
 	},
 }
+
+// newLogger creates the logger used by the application. If logging
+// is disabled, a no-op logger is returned. When fullscreen is true,
+// logs are written to the logging file instead of stderr. The
+// returned function must be called to release the logging file.
+func newLogger(fullscreen bool) (zerolog.Logger, func(), error) {
+	if !flags.Log {
+		return zerolog.Nop(), func() {}, nil
+	}
+
+	var writer io.Writer = zerolog.ConsoleWriter{
+		Out:         os.Stderr,
+		FormatLevel: func(_ interface{}) string { return "" },
+	}
+	closeLog := func() {}
+
+	if fullscreen {
+		file, err := os.Create(flags.LogFile)
+		if err != nil {
+			return zerolog.Nop(), nil, errors.Wrap(err, "failed to open logging file")
+		}
+		closeLog = func() {
+			if err := file.Close(); err != nil {
+				fmt.Println(errors.Wrap(err, "failed to close logging file"))
+			}
+		}
+		writer = file
+	}
+
+	return zerolog.New(writer).With().Timestamp().Logger(), closeLog, nil
+}
+
+// newJournal opens the journal file specified by the flags and returns
+// the engine.Option which records each journal entry into the file. If
+// no journal was specified, no options are returned. The returned
+// function must be called to close the journal file.
+func newJournal() ([]engine.Option, func(), error) {
+	if flags.Journal == "" {
+		return nil, func() {}, nil
+	}
+
+	file, err := os.OpenFile(flags.Journal, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open journal file")
+	}
+	closeJournal := func() {
+		if err := file.Close(); err != nil {
+			fmt.Println(errors.Wrap(err, "failed to close journal file"))
+		}
+	}
+
+	// In fullscreen mode, queries may be
+	// executed concurrently.
+	var mu sync.Mutex
+	w := kvfile.NewJournalWriter(file)
+
+	record := engine.Journal(func(entry engine.JournalEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return w.Write(kvfile.JournalEntry{
+			Time:  time.Now().UTC(),
+			Dir:   entry.Dir,
+			Key:   entry.Key,
+			Value: entry.Value,
+		})
+	})
+	return []engine.Option{record}, closeJournal, nil
+}
+
+// newEngine connects to the DB specified by the
+// cluster file and wraps the connection with an
+// engine.Engine configured by the flags. The given
+// options are applied after those of the flags.
+func newEngine(log zerolog.Logger, extra ...engine.Option) (engine.Engine, error) {
+	opts, err := flags.EngineOpts()
+	if err != nil {
+		return engine.Engine{}, err
+	}
+	indexes, err := loadIndexes()
+	if err != nil {
+		return engine.Engine{}, err
+	}
+	if len(indexes) > 0 {
+		opts = append(opts, engine.Indexes(indexes...))
+	}
+	opts = append(opts, extra...)
+
+	log.Log().Str("cluster file", flags.Cluster).Msg("connecting to DB")
+	if err := fdb.APIVersion(APIVersion); err != nil {
+		return engine.Engine{}, errors.Wrap(err, "failed to set FDB API version")
+	}
+	db, err := fdb.OpenDatabase(flags.Cluster)
+	if err != nil {
+		return engine.Engine{}, errors.Wrap(err, "failed to connect to DB")
+	}
+
+	return engine.New(
+		facade.NewTransactor(db, directory.Root()),
+		append(opts, engine.Logger(log))...), nil
+}
+
+// loadIndexes reads the index file specified by the
+// flags. If no index file was specified, no indexes
+// are returned.
+func loadIndexes() ([]engine.Index, error) {
+	if flags.Indexes == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(flags.Indexes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open index file")
+	}
+	defer func() { _ = file.Close() }()
+
+	defs, err := kvfile.ReadIndexDefs(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read index file")
+	}
+
+	var indexes []engine.Index
+	for _, def := range defs {
+		source, names, err := parseNamedKeyValue(def.Source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid source for index '%s'", def.Name)
+		}
+		template, err := parseKeyValue(def.Template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template for index '%s'", def.Name)
+		}
+		index, err := engine.NewIndex(def.Name, source, names, template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid index '%s'", def.Name)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// withEngine creates a logger & engine.Engine for the
+// non-interactive subcommands and passes the engine to
+// the given function.
+func withEngine(f func(engine.Engine) error) error {
+	log, closeLog, err := newLogger(false)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	eg, err := newEngine(log)
+	if err != nil {
+		return err
+	}
+	return f(eg)
+}
+
+// parseDirectory parses the given string as
+// a directory query.
+func parseDirectory(str string) (keyval.Directory, error) {
+	p := parser.New(scanner.New(strings.NewReader(str)))
+	query, err := p.Parse()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse query")
+	}
+	dir, ok := query.(keyval.Directory)
+	if !ok {
+		return nil, errors.Errorf("expected a directory query, got '%s'", str)
+	}
+	return dir, nil
+}
+
+// parseKeyValue parses the given string as a
+// key-value query.
+func parseKeyValue(str string) (keyval.KeyValue, error) {
+	kv, _, err := parseNamedKeyValue(str)
+	return kv, err
+}
+
+// parseNamedKeyValue parses the given string as a key-value
+// query and returns the names of the query's variables.
+func parseNamedKeyValue(str string) (keyval.KeyValue, []string, error) {
+	p := parser.New(scanner.New(strings.NewReader(str)))
+	query, err := p.Parse()
+	if err != nil {
+		return keyval.KeyValue{}, nil, errors.Wrap(err, "failed to parse query")
+	}
+	kv, ok := query.(keyval.KeyValue)
+	if !ok {
+		return keyval.KeyValue{}, nil, errors.Errorf("expected a key-value query, got '%s'", str)
+	}
+	return kv, p.Names(), nil
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/engine/stream"
+	"github.com/janderland/fdbq/internal/app/kvfile"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/compare"
+	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/values"
+	"github.com/janderland/fdbq/parser/format"
+)
+
+var diffFlags struct {
+	file     string
+	longScan bool
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffFlags.file, "file", "", "export file to compare against the query instead of a second query")
+	diffCmd.Flags().BoolVar(&diffFlags.longScan, "long-scan", false, "allow the range-reads to span multiple transactions, giving up consistency")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [flags] query [query]",
+	Short: "print the differences between the key-values of two range-reads",
+	Long: "Print the key-values which only exist on one side, or whose values differ, between two range-read " +
+		"queries. If the --file flag is given, the key-values read by a single query are compared against the " +
+		"key-values of an export file which match the same query. Directories are paired by the elements " +
+		"matched by the variables of each query's directory. Key-values only found on the left side are " +
+		"prefixed with '<' and those only found on the right side are prefixed with '>'. If a value differs, " +
+		"both key-values are printed.",
+	Args: cobra.RangeArgs(1, 2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffFlags.file == "" && len(args) != 2 {
+			return errors.New("expected two queries or one query and the --file flag")
+		}
+		if diffFlags.file != "" && len(args) != 1 {
+			return errors.New("expected one query when the --file flag is given")
+		}
+
+		var queries []keyval.KeyValue
+		for _, arg := range args {
+			query, err := parseKeyValue(arg)
+			if err != nil {
+				return err
+			}
+			queries = append(queries, query)
+		}
+
+		if diffFlags.longScan {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", engine.ResumeWarning)
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			opts := engine.RangeOpts{Filter: true, Resume: diffFlags.longScan}
+			left := readDiffKVs(eg.ReadRange(ctx, queries[0], opts), queries[0])
+
+			var right func() (*kvfile.DiffKV, error)
+			if diffFlags.file != "" {
+				file, err := os.Open(diffFlags.file)
+				if err != nil {
+					return errors.Wrap(err, "failed to open file")
+				}
+				defer func() { _ = file.Close() }()
+				right = fileDiffKVs(kvfile.NewExportReader(file), queries[0])
+			} else {
+				right = readDiffKVs(eg.ReadRange(ctx, queries[1], opts), queries[1])
+			}
+
+			f := format.New(flags.FormatOpts()...)
+			printKV := func(prefix string, kv keyval.KeyValue) error {
+				f.Reset()
+				f.KeyValue(kv)
+				_, err := fmt.Printf("%s %s\n", prefix, f.String())
+				return errors.Wrap(err, "failed to print output")
+			}
+
+			return kvfile.MergeDiff(left, right, func(l, r *kvfile.DiffKV) error {
+				if l != nil {
+					if err := printKV("<", l.KV); err != nil {
+						return err
+					}
+				}
+				if r != nil {
+					if err := printKV(">", r.KV); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	},
+}
+
+// newDiffKV creates a kvfile.DiffKV for the given key-value which
+// was read or matched by the given query.
+func newDiffKV(query keyval.KeyValue, kv keyval.KeyValue, value []byte) (*kvfile.DiffKV, error) {
+	path, err := convert.ToStringArray(kv.Key.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert directory")
+	}
+
+	var dir []string
+	for i, element := range query.Key.Directory {
+		if _, ok := element.(keyval.Variable); ok {
+			dir = append(dir, path[i])
+		}
+	}
+
+	key, err := convert.ToFDBTuple(kv.Key.Tuple)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert tuple")
+	}
+
+	if value == nil {
+		value, err = values.Pack(kv.Value, flags.ByteOrder())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to pack value")
+		}
+	}
+
+	return &kvfile.DiffKV{KV: kv, Dir: dir, Key: key.Pack(), Value: value}, nil
+}
+
+// readDiffKVs returns a function which returns the next
+// key-value read from the given stream. After the last
+// key-value, nil is returned.
+func readDiffKVs(in chan stream.KeyValErr, query keyval.KeyValue) func() (*kvfile.DiffKV, error) {
+	return func() (*kvfile.DiffKV, error) {
+		msg, ok := <-in
+		if !ok {
+			return nil, nil
+		}
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		return newDiffKV(query, msg.KV, nil)
+	}
+}
+
+// fileDiffKVs returns a function which returns the next key-value
+// from the given export file which matches the given query. After
+// the last key-value, nil is returned.
+func fileDiffKVs(r *kvfile.ExportReader, query keyval.KeyValue) func() (*kvfile.DiffKV, error) {
+	return func() (*kvfile.DiffKV, error) {
+		for {
+			entry, err := r.Read()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if entry.IsDir || entry.Key == nil || !compare.Directory(query.Key.Directory, entry.Dir) {
+				continue
+			}
+			if compare.Tuples(query.Key.Tuple, entry.Key) != nil {
+				continue
+			}
+			value, ok := decodeValue(query.Value, entry.Value)
+			if !ok {
+				continue
+			}
+
+			kv := keyval.KeyValue{
+				Key:   keyval.Key{Directory: convert.FromStringArray(entry.Dir), Tuple: entry.Key},
+				Value: value,
+			}
+			return newDiffKV(query, kv, entry.Value)
+		}
+	}
+}
+
+// decodeValue decodes the given bytes using the value of
+// the range-read query, similar to how the engine decodes
+// values. If the bytes don't match the query, false is
+// returned.
+func decodeValue(query keyval.Value, val []byte) (keyval.Value, bool) {
+	if pred, ok := query.(keyval.Predicate); ok {
+		variable := pred.Variable
+		if len(variable) == 0 {
+			variable = keyval.Variable{keyval.BytesType}
+		}
+		out, ok := decodeValue(variable, val)
+		if !ok || !compare.Satisfies(pred, out) {
+			return nil, false
+		}
+		return out, true
+	}
+
+	variable, ok := query.(keyval.Variable)
+	if !ok {
+		packed, err := values.Pack(query, flags.ByteOrder())
+		if err != nil || !bytes.Equal(packed, val) {
+			return nil, false
+		}
+		return query, true
+	}
+	if len(variable) == 0 {
+		return keyval.Bytes(val), true
+	}
+	for _, typ := range variable {
+		if out, err := values.Unpack(val, typ, flags.ByteOrder()); err == nil {
+			return out, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/parser/format"
+)
+
+var dirCreateFlags struct {
+	layer string
+}
+
+func init() {
+	dirCreateCmd.Flags().StringVar(&dirCreateFlags.layer, "layer", "", "layer tag stored in the directory's metadata")
+
+	dirCmd.AddCommand(dirCreateCmd)
+	dirCmd.AddCommand(dirMoveCmd)
+	dirCmd.AddCommand(dirRemoveCmd)
+	dirCmd.AddCommand(dirListCmd)
+}
+
+var dirCmd = &cobra.Command{
+	Use:   "dir",
+	Short: "manage directories",
+}
+
+var dirCreateCmd = &cobra.Command{
+	Use:   "create [flags] directory",
+	Short: "create a directory",
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write {
+			return errors.New("writing isn't enabled")
+		}
+
+		query, err := parseDirectory(args[0])
+		if err != nil {
+			return err
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			dir, err := eg.CreateDirectory(query, []byte(dirCreateFlags.layer))
+			if err != nil {
+				return err
+			}
+			return printDir(dir.GetPath(), dir.Bytes(), dir.GetLayer())
+		})
+	},
+}
+
+var dirMoveCmd = &cobra.Command{
+	Use:   "move [flags] old-directory new-directory",
+	Short: "move a directory and its subdirectories",
+	Args:  cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write {
+			return errors.New("writing isn't enabled")
+		}
+
+		oldQuery, err := parseDirectory(args[0])
+		if err != nil {
+			return err
+		}
+		newQuery, err := parseDirectory(args[1])
+		if err != nil {
+			return err
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			dir, err := eg.MoveDirectory(oldQuery, newQuery)
+			if err != nil {
+				return err
+			}
+			return printDir(dir.GetPath(), dir.Bytes(), dir.GetLayer())
+		})
+	},
+}
+
+var dirRemoveCmd = &cobra.Command{
+	Use:   "remove [flags] directory",
+	Short: "remove a directory, its subdirectories, and all their contents",
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write {
+			return errors.New("writing isn't enabled")
+		}
+
+		query, err := parseDirectory(args[0])
+		if err != nil {
+			return err
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			removed, err := eg.RemoveDirectory(query)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				return errors.New("directory doesn't exist")
+			}
+			return nil
+		})
+	},
+}
+
+var dirListCmd = &cobra.Command{
+	Use:   "list [flags] directory",
+	Short: "list the directories matching a directory query",
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query, err := parseDirectory(args[0])
+		if err != nil {
+			return err
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			for msg := range eg.Directories(cmd.Context(), query) {
+				if msg.Err != nil {
+					return msg.Err
+				}
+				if err := printDir(msg.Dir.GetPath(), msg.Dir.Bytes(), msg.Dir.GetLayer()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	},
+}
+
+// printDir prints a line describing a directory: its path,
+// prefix, and layer. The prefix & layer are always printed
+// as hex byte strings.
+func printDir(path []string, prefix []byte, layer []byte) error {
+	dir := make(keyval.Directory, len(path))
+	for i, element := range path {
+		dir[i] = keyval.String(element)
+	}
+
+	f := format.New(format.WithPrintBytes())
+	f.Directory(dir)
+	line := []interface{}{f.String()}
+
+	f.Reset()
+	f.Bytes(prefix)
+	line = append(line, f.String())
+
+	if len(layer) > 0 {
+		f.Reset()
+		f.Bytes(layer)
+		line = append(line, f.String())
+	}
+
+	_, err := fmt.Fprintln(os.Stdout, line...)
+	return errors.Wrap(err, "failed to print directory")
+}
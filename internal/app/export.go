@@ -0,0 +1,209 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/internal/app/kvfile"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/convert"
+)
+
+var exportFlags struct {
+	output   string
+	layers   bool
+	rawKeys  bool
+	longScan bool
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportFlags.output, "output", "o", "-", "file to write the export to, or '-' for stdout")
+	exportCmd.Flags().BoolVar(&exportFlags.layers, "layers", false, "include the layer of each directory")
+	exportCmd.Flags().BoolVar(&exportFlags.rawKeys, "raw-keys", false, "write keys as byte strings instead of decoded tuples")
+	exportCmd.Flags().BoolVar(&exportFlags.longScan, "long-scan", false, "allow the export to span multiple transactions, giving up consistency")
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [flags] directory",
+	Short: "write the key-values of a directory subtree to a file",
+	Long: "Write every key-value within the directories matching the directory query, along with their " +
+		"subdirectories, to a file. Each line of the file is a JSON object describing either a directory " +
+		"or a key-value. The values are written as byte strings. The file may be read by the restore command.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query, err := parseDirectory(args[0])
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = os.Stdout
+		if exportFlags.output != "-" {
+			file, err := os.Create(exportFlags.output)
+			if err != nil {
+				return errors.Wrap(err, "failed to create file")
+			}
+			defer func() { _ = file.Close() }()
+			out = file
+		}
+		if exportFlags.longScan {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", engine.ResumeWarning)
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			dirs, err := eg.Subtree(cmd.Context(), query)
+			if err != nil {
+				return err
+			}
+
+			w := kvfile.NewExportWriter(out)
+			next := 0
+			writeDirsUntil := func(dir directory.DirectorySubspace) error {
+				for ; next < len(dirs); next++ {
+					if dir != nil && bytes.Equal(dirs[next].Bytes(), dir.Bytes()) {
+						return nil
+					}
+					if err := w.Write(exportDir(dirs[next])); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			opts := engine.RangeOpts{Resume: exportFlags.longScan}
+			var current directory.DirectorySubspace
+			for msg := range eg.ReadDirectories(cmd.Context(), dirs, opts) {
+				if msg.Err != nil {
+					return msg.Err
+				}
+				if current == nil || !bytes.Equal(current.Bytes(), msg.Dir.Bytes()) {
+					if err := writeDirsUntil(msg.Dir); err != nil {
+						return err
+					}
+					if err := w.Write(exportDir(msg.Dir)); err != nil {
+						return err
+					}
+					next++
+					current = msg.Dir
+				}
+
+				rawKey := msg.KV.Key[len(msg.Dir.Bytes()):]
+				entry := kvfile.Entry{Dir: msg.Dir.GetPath(), RawKey: rawKey, Value: msg.KV.Value}
+				if !exportFlags.rawKeys {
+					entry.Key = decodeKey(rawKey)
+				}
+				if err := w.Write(entry); err != nil {
+					return err
+				}
+			}
+			return writeDirsUntil(nil)
+		})
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [flags] file",
+	Short: "write the directories and key-values of an export file",
+	Long: "Write the directories and key-values read from a file created by the export command. If the file " +
+		"is '-', the export is read from stdin. Missing directories are created. The key-values are written " +
+		"in batches of transactions, so a failure may leave the export partially restored.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write {
+			return errors.New("writing isn't enabled")
+		}
+
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return errors.Wrap(err, "failed to open file")
+			}
+			defer func() { _ = file.Close() }()
+			in = file
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			r := kvfile.NewExportReader(in)
+			loader := eg.NewLoader(engine.LoadOpts{
+				Progress: func(p engine.LoadProgress) {
+					_, _ = fmt.Fprintf(os.Stderr, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+				},
+			})
+
+			for {
+				entry, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+
+				switch {
+				case entry.IsDir:
+					_, err = eg.CreateDirectory(convert.FromStringArray(entry.Dir), entry.Layer)
+					if errors.Is(err, directory.ErrDirAlreadyExists) {
+						err = nil
+					}
+
+				case entry.Key != nil:
+					err = loader.Set(keyval.KeyValue{
+						Key:   keyval.Key{Directory: convert.FromStringArray(entry.Dir), Tuple: entry.Key},
+						Value: keyval.Bytes(entry.Value),
+					})
+
+				default:
+					err = loader.SetRaw(entry.Dir, entry.RawKey, entry.Value)
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to restore entry for directory %v", entry.Dir)
+				}
+			}
+			return loader.Flush()
+		})
+	},
+}
+
+// exportDir creates the export entry for the given directory.
+// The layer is only included if enabled by the flags.
+func exportDir(dir directory.DirectorySubspace) kvfile.Entry {
+	entry := kvfile.Entry{Dir: dir.GetPath(), IsDir: true}
+	if exportFlags.layers {
+		entry.Layer = dir.GetLayer()
+	}
+	return entry
+}
+
+// decodeKey unpacks the given key as a tuple. If the key isn't
+// a valid tuple, or the tuple wouldn't pack into the same bytes,
+// nil is returned so the key is exported as a byte string.
+func decodeKey(key []byte) (decoded keyval.Tuple) {
+	// FromFDBTuple panics on elements which
+	// keyval doesn't support, like big ints.
+	defer func() {
+		if recover() != nil {
+			decoded = nil
+		}
+	}()
+
+	tup, err := tuple.Unpack(key)
+	if err != nil {
+		return nil
+	}
+	decoded = convert.FromFDBTuple(tup)
+	repacked, err := convert.ToFDBTuple(decoded)
+	if err != nil || !bytes.Equal(repacked.Pack(), key) {
+		return nil
+	}
+	return decoded
+}
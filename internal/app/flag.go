@@ -2,18 +2,46 @@ package app
 
 import (
 	"encoding/binary"
+	"time"
 
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/engine/facade"
 	"github.com/janderland/fdbq/parser/format"
 )
 
 type Flags struct {
-	Cluster string
-	Write   bool
-	Log     bool
-	LogFile string
+	Cluster    string
+	Write      bool
+	RangeClear bool
+	Watch      bool
+	Log        bool
+	LogFile    string
+
+	ReadVersion int64
+	Snapshot    bool
+	ShowVersion bool
+	Count       bool
+	Distinct    int
+	GroupBy     int
+	Audit       bool
+	Bulk        bool
+	DryRun      bool
+	Journal     string
+	Indexes     string
+	Explain     bool
+
+	Select       []string
+	SelectFormat string
+
+	Timeout       time.Duration
+	RetryLimit    int
+	MaxRetryDelay time.Duration
+	Priority      string
+	SizeLimit     int
 
 	Queries []string
 	Reverse bool
@@ -21,22 +49,66 @@ type Flags struct {
 	Little  bool
 	Bytes   bool
 	Limit   int
+
+	StreamingMode string
+	BatchSize     int
+	LongScan      bool
+
+	Paginate bool
+	Cursor   string
+}
+
+var streamingModes = map[string]fdb.StreamingMode{
+	"want_all": fdb.StreamingModeWantAll,
+	"iterator": fdb.StreamingModeIterator,
+	"exact":    fdb.StreamingModeExact,
+	"small":    fdb.StreamingModeSmall,
+	"medium":   fdb.StreamingModeMedium,
+	"large":    fdb.StreamingModeLarge,
+	"serial":   fdb.StreamingModeSerial,
 }
 
 func SetupFlags(cmd *cobra.Command) *Flags {
 	var flags Flags
 
-	cmd.Flags().StringVarP(&flags.Cluster, "cluster", "c", "", "path to cluster file")
-	cmd.Flags().BoolVarP(&flags.Write, "write", "w", false, "allow write queries")
-	cmd.Flags().BoolVar(&flags.Log, "log", false, "enable debug logging")
-	cmd.Flags().StringVar(&flags.LogFile, "log-file", "log.txt", "logging file when in fullscreen")
+	// These flags are shared by the root command and its subcommands.
+	cmd.PersistentFlags().StringVarP(&flags.Cluster, "cluster", "c", "", "path to cluster file")
+	cmd.PersistentFlags().BoolVarP(&flags.Write, "write", "w", false, "allow write queries")
+	cmd.PersistentFlags().BoolVar(&flags.Log, "log", false, "enable debug logging")
+	cmd.PersistentFlags().StringVar(&flags.LogFile, "log-file", "log.txt", "logging file when in fullscreen")
+	cmd.PersistentFlags().BoolVarP(&flags.Little, "little", "l", false, "encode/decode values as little endian instead of big endian")
+	cmd.PersistentFlags().BoolVarP(&flags.Bytes, "bytes", "b", false, "print full byte strings instead of just their length")
+	cmd.PersistentFlags().DurationVar(&flags.Timeout, "timeout", 0, "max duration of each transaction, including retries")
+	cmd.PersistentFlags().IntVar(&flags.RetryLimit, "retry-limit", 0, "max number of retries for each transaction")
+	cmd.PersistentFlags().DurationVar(&flags.MaxRetryDelay, "max-retry-delay", 0, "max backoff between transaction retries")
+	cmd.PersistentFlags().StringVar(&flags.Priority, "priority", "", "transaction priority, either 'batch' or 'system'")
+	cmd.PersistentFlags().IntVar(&flags.SizeLimit, "size-limit", 0, "max number of bytes each transaction may write")
+	cmd.PersistentFlags().StringVar(&flags.Indexes, "indexes", "", "file defining the secondary indexes maintained by write queries")
 
+	cmd.Flags().BoolVar(&flags.RangeClear, "range-clear", false, "allow clear queries containing variables when non-interactive")
+	cmd.Flags().BoolVar(&flags.Watch, "watch", false, "watch single-read queries and print their key-value each time it changes")
+	cmd.Flags().Int64Var(&flags.ReadVersion, "read-version", 0, "perform reads at the given version instead of the latest version")
+	cmd.Flags().BoolVar(&flags.Snapshot, "snapshot", false, "perform snapshot reads which don't cause transaction conflicts")
+	cmd.Flags().BoolVar(&flags.ShowVersion, "show-version", false, "print the read & commit versions when non-interactive")
+	cmd.Flags().BoolVar(&flags.Audit, "audit", false, "print the KVs which don't match the schema of range-reads & why when non-interactive")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", false, "print the writes of write queries instead of committing them")
+	cmd.Flags().StringVar(&flags.Journal, "journal", "", "append the prior value of each key changed by set & clear queries to the given file")
+	cmd.Flags().BoolVar(&flags.Explain, "explain", false, "print how each query would be executed instead of executing it when non-interactive")
+	cmd.Flags().StringSliceVar(&flags.Select, "select", nil, "print the data bound to the given named variables instead of the KVs when non-interactive")
+	cmd.Flags().StringVar(&flags.SelectFormat, "select-format", "tsv", "format of the data printed by --select: tsv or json")
+	cmd.Flags().BoolVar(&flags.Bulk, "bulk", false, "execute set queries in batched transactions instead of a single transaction")
+	cmd.Flags().BoolVar(&flags.Count, "count", false, "print the number of KVs matched by range-reads instead of the KVs when non-interactive")
 	cmd.Flags().StringArrayVarP(&flags.Queries, "query", "q", nil, "execute query non-interactively")
 	cmd.Flags().BoolVarP(&flags.Reverse, "reverse", "r", false, "query range-reads in reverse order")
 	cmd.Flags().BoolVarP(&flags.Strict, "strict", "s", false, "throw an error if a KV is read which doesn't match the schema")
-	cmd.Flags().BoolVarP(&flags.Little, "little", "l", false, "encode/decode values as little endian instead of big endian")
-	cmd.Flags().BoolVarP(&flags.Bytes, "bytes", "b", false, "print full byte strings instead of just their length")
-	cmd.Flags().IntVar(&flags.Limit, "limit", 0, "limit the number of KVs read in range-reads")
+	cmd.Flags().IntVar(&flags.Distinct, "distinct", 0, "only read the first KV of each group of keys sharing their first N tuple elements in range-reads")
+	cmd.Flags().IntVar(&flags.GroupBy, "group-by", 0, "print the number of KVs & value bytes of each group of keys sharing their first N tuple elements in range-reads")
+	cmd.Flags().IntVar(&flags.Limit, "limit", 0, "limit the number of KVs read from each directory in range-reads")
+	cmd.Flags().StringVar(&flags.StreamingMode, "streaming-mode", "iterator", "streaming mode of range-reads: want_all, iterator, exact, small, medium, large, or serial")
+	cmd.Flags().IntVar(&flags.BatchSize, "batch-size", 0, "number of KVs requested at a time by range-reads")
+	cmd.Flags().BoolVar(&flags.LongScan, "long-scan", false, "allow range-reads to span multiple transactions, giving up consistency")
+	cmd.Flags().BoolVar(&flags.Paginate, "paginate", false, "limit the total number of KVs read by a range-read & print a cursor to the next page when non-interactive")
+	cmd.Flags().StringVar(&flags.Cursor, "cursor", "", "continue a paginated range-read after the KV identified by the given cursor when non-interactive")
 
 	return &flags
 }
@@ -48,18 +120,59 @@ func (x *Flags) ByteOrder() binary.ByteOrder {
 	return binary.BigEndian
 }
 
+func (x *Flags) EngineOpts() ([]engine.Option, error) {
+	opts := []engine.Option{
+		engine.ByteOrder(x.ByteOrder()),
+		engine.Timeout(x.Timeout),
+		engine.RetryLimit(x.RetryLimit),
+		engine.MaxRetryDelay(x.MaxRetryDelay),
+		engine.SizeLimit(x.SizeLimit),
+	}
+
+	switch x.Priority {
+	case "":
+	case "batch":
+		opts = append(opts, engine.Priority(facade.BatchPriority))
+	case "system":
+		opts = append(opts, engine.Priority(facade.SystemPriority))
+	default:
+		return nil, errors.Errorf("invalid priority '%s'", x.Priority)
+	}
+
+	return opts, nil
+}
+
 func (x *Flags) SingleOpts() engine.SingleOpts {
 	return engine.SingleOpts{
-		Filter: !x.Strict,
+		Filter:   !x.Strict,
+		Snapshot: x.Snapshot,
 	}
 }
 
-func (x *Flags) RangeOpts() engine.RangeOpts {
-	return engine.RangeOpts{
-		Reverse: x.Reverse,
-		Filter:  !x.Strict,
-		Limit:   x.Limit,
+func (x *Flags) RangeOpts() (engine.RangeOpts, error) {
+	mode, ok := streamingModes[x.StreamingMode]
+	if !ok {
+		return engine.RangeOpts{}, errors.Errorf("invalid streaming mode '%s'", x.StreamingMode)
 	}
+	if mode == fdb.StreamingModeExact && x.BatchSize == 0 && x.Limit == 0 && x.Distinct == 0 {
+		return engine.RangeOpts{}, errors.New("streaming mode 'exact' requires --batch-size or --limit")
+	}
+	if (x.Paginate || x.Cursor != "") && x.Limit == 0 {
+		return engine.RangeOpts{}, errors.New("pagination requires --limit")
+	}
+
+	return engine.RangeOpts{
+		Reverse:   x.Reverse,
+		Filter:    !x.Strict,
+		Limit:     x.Limit,
+		Snapshot:  x.Snapshot,
+		Mode:      mode,
+		BatchSize: x.BatchSize,
+		Resume:    x.LongScan,
+		Distinct:  x.Distinct,
+		Paginate:  x.Paginate || x.Cursor != "",
+		Cursor:    x.Cursor,
+	}, nil
 }
 
 func (x *Flags) FormatOpts() []format.Option {
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/janderland/fdbq/internal/app/fullscreen/results"
+	"github.com/janderland/fdbq/keyval"
 )
 
 var helpMsg string
@@ -34,6 +35,10 @@ switches back to input mode. Pressing "?" switches to
 help mode. Pressing "q" quits the application after
 confirmation.
 
+If a clear query containing variables is executed, the
+key-values matching the query are only cleared after
+confirmation.
+
 During help mode, this help screen is displayed.
 Scrolling works the same as in scroll mode. Pressing
 "escape" switches to scroll mode.
@@ -63,3 +68,10 @@ func newQuit() results.Model {
 	x.Push("Are you sure you want to quit? (y/n)")
 	return x
 }
+
+func newConfirmClear(query keyval.KeyValue) results.Model {
+	x := results.New()
+	x.Push("Are you sure you want to clear every key-value matching the following query? (y/n)")
+	x.Push(query)
+	return x
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/engine/facade"
 	"github.com/janderland/fdbq/internal/app/fullscreen/buffer"
 	"github.com/janderland/fdbq/keyval"
 	"github.com/janderland/fdbq/keyval/class"
@@ -21,6 +22,21 @@ type AsyncQueryMsg struct {
 	Buffer    buffer.StreamBuffer
 }
 
+// ConfirmClearMsg is returned by QueryManager.Query when
+// a range clear is requested. The range clear is only
+// executed after the user confirms it by passing the
+// query to QueryManager.ClearRange.
+type ConfirmClearMsg struct {
+	Query keyval.KeyValue
+}
+
+// DryRunMsg is returned instead of the usual message
+// when a write query is executed during a dry run. It
+// holds the writes which weren't committed.
+type DryRunMsg struct {
+	Writes []facade.Write
+}
+
 type Option func(*QueryManager)
 
 type QueryManager struct {
@@ -28,6 +44,8 @@ type QueryManager struct {
 	singleOpts engine.SingleOpts
 	rangeOpts  engine.RangeOpts
 	write      bool
+	watch      bool
+	dryRun     bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -63,6 +81,25 @@ func WithWrite(write bool) Option {
 	}
 }
 
+// WithWatch causes single-read queries to be executed
+// as watches. The result is updated each time the
+// key's value changes.
+func WithWatch(watch bool) Option {
+	return func(x *QueryManager) {
+		x.watch = watch
+	}
+}
+
+// WithDryRun causes write queries to be executed without
+// committing. Instead, a DryRunMsg is returned describing
+// the writes. Write queries are allowed even if writing
+// wasn't enabled via WithWrite.
+func WithDryRun(dryRun bool) Option {
+	return func(x *QueryManager) {
+		x.dryRun = dryRun
+	}
+}
+
 func (x *QueryManager) Cancel() {
 	x.cancel()
 }
@@ -98,24 +135,33 @@ func (x *QueryManager) Query(str string) func() tea.Msg {
 
 		switch c := class.Classify(kv); c {
 		case class.Constant:
-			if !x.write {
-				return errors.New("writing isn't enabled")
-			}
-			if err := x.eg.Set(kv); err != nil {
-				return err
-			}
-			return "key set"
+			return x.mutate("key set", func(eg engine.Engine) error {
+				return eg.Set(kv)
+			})
 
 		case class.Clear:
-			if !x.write {
+			return x.mutate("key cleared", func(eg engine.Engine) error {
+				return eg.Clear(kv)
+			})
+
+		case class.VariableClear:
+			if !x.write && !x.dryRun {
 				return errors.New("writing isn't enabled")
 			}
-			if err := x.eg.Clear(kv); err != nil {
-				return err
-			}
-			return "key cleared"
+			return ConfirmClearMsg{Query: kv}
+
+		case class.Atomic:
+			return x.mutate("key mutated", func(eg engine.Engine) error {
+				return eg.Atomic(kv)
+			})
 
 		case class.ReadSingle:
+			if x.watch {
+				return AsyncQueryMsg{
+					StartedAt: time.Now(),
+					Buffer:    buffer.New(x.eg.Watch(childCtx, kv, x.singleOpts)),
+				}
+			}
 			out, err := x.eg.ReadSingle(kv, x.singleOpts)
 			if err != nil {
 				return err
@@ -131,8 +177,50 @@ func (x *QueryManager) Query(str string) func() tea.Msg {
 				Buffer:    buffer.New(x.eg.ReadRange(childCtx, kv, x.rangeOpts)),
 			}
 
+		case class.VariableOperand:
+			return errors.New("atomic operand must be constant")
+
 		default:
 			return errors.Errorf("unexpected query class '%v'", c)
 		}
 	}
 }
+
+func (x *QueryManager) ClearRange(query keyval.KeyValue) func() tea.Msg {
+	// Cancel previous query before starting a new one.
+	x.cancel()
+
+	// Create a new context for the new query.
+	var childCtx context.Context
+	childCtx, x.cancel = context.WithCancel(x.ctx)
+
+	return func() tea.Msg {
+		return x.mutate("range cleared", func(eg engine.Engine) error {
+			return eg.ClearRange(childCtx, query)
+		})
+	}
+}
+
+// mutate executes a write query via the given function and returns
+// the given message if it succeeds. During a dry run, the function
+// is passed a dry-run Engine and a DryRunMsg is returned instead.
+func (x *QueryManager) mutate(msg string, f func(engine.Engine) error) tea.Msg {
+	if !x.dryRun {
+		if !x.write {
+			return errors.New("writing isn't enabled")
+		}
+		if err := f(x.eg); err != nil {
+			return err
+		}
+		return msg
+	}
+
+	var writes []facade.Write
+	eg := x.eg.DryRun(func(w facade.Write) {
+		writes = append(writes, w)
+	})
+	if err := f(eg); err != nil {
+		return err
+	}
+	return DryRunMsg{Writes: writes}
+}
@@ -41,6 +41,36 @@ func TestWriteFlag(t *testing.T) {
 			query: "/my/dir(\"hi\",\"there\")=clear",
 			err:   true,
 		},
+		{
+			name:  "range clear",
+			write: true,
+			query: "/my/<>(<>,\"expired\",...)=clear",
+			err:   false,
+		},
+		{
+			name:  "range clear error",
+			write: false,
+			query: "/my/<>(<>,\"expired\",...)=clear",
+			err:   true,
+		},
+		{
+			name:  "atomic",
+			write: true,
+			query: "/my/dir(\"hits\")=bit_or(1)",
+			err:   false,
+		},
+		{
+			name:  "atomic big endian error",
+			write: true,
+			query: "/my/dir(\"hits\")=add(1)",
+			err:   true,
+		},
+		{
+			name:  "atomic error",
+			write: false,
+			query: "/my/dir(\"hits\")=add(1)",
+			err:   true,
+		},
 		{
 			name:  "get nothing",
 			write: false,
@@ -67,3 +97,16 @@ func TestWriteFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestDryRun(t *testing.T) {
+	qm := New(
+		context.Background(),
+		engine.New(facade.NewNilTransactor()),
+		WithDryRun(true))
+
+	out := qm.Query("/my/dir(\"hi\",\"there\")=33.9")()
+	msg, ok := out.(DryRunMsg)
+	require.True(t, ok)
+	require.Len(t, msg.Writes, 1)
+	require.Equal(t, facade.SetOp, msg.Writes[0].Op)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/janderland/fdbq/engine"
 	"github.com/janderland/fdbq/internal/app/fullscreen/manager"
+	"github.com/janderland/fdbq/keyval"
 	"github.com/janderland/fdbq/parser/format"
 )
 
@@ -23,12 +24,25 @@ type App struct {
 	Log    zerolog.Logger
 	Out    io.Writer
 
-	Write      bool
-	SingleOpts engine.SingleOpts
-	RangeOpts  engine.RangeOpts
+	Write       bool
+	Watch       bool
+	ReadVersion int64
+	SingleOpts  engine.SingleOpts
+	RangeOpts   engine.RangeOpts
+
+	// DryRun causes write queries to be executed
+	// without committing. Instead, the writes are
+	// displayed as the query's results.
+	DryRun bool
 }
 
 func (x *App) Run(ctx context.Context) error {
+	// Each query runs in its own transaction, so
+	// the read version is applied to every query.
+	singleOpts, rangeOpts := x.SingleOpts, x.RangeOpts
+	singleOpts.ReadVersion = x.ReadVersion
+	rangeOpts.ReadVersion = x.ReadVersion
+
 	input := textinput.New()
 	input.Placeholder = "Query"
 
@@ -56,9 +70,14 @@ func (x *App) Run(ctx context.Context) error {
 		qm: manager.New(
 			ctx,
 			x.Engine,
-			manager.WithSingleOpts(x.SingleOpts),
-			manager.WithRangeOpts(x.RangeOpts),
-			manager.WithWrite(x.Write)),
+			manager.WithSingleOpts(singleOpts),
+			manager.WithRangeOpts(rangeOpts),
+			manager.WithWatch(x.Watch),
+			manager.WithWrite(x.Write),
+			manager.WithDryRun(x.DryRun)),
+	}
+	if rangeOpts.Resume {
+		model.warning = engine.ResumeWarning
 	}
 
 	_, err := tea.NewProgram(
@@ -77,6 +96,7 @@ const (
 	modeInput
 	modeHelp
 	modeQuit
+	modeConfirm
 )
 
 type Style struct {
@@ -93,4 +113,11 @@ type Model struct {
 	input   textinput.Model
 	results stack.ResultsStack
 	qm      manager.QueryManager
+
+	// confirm is the range clear awaiting
+	// confirmation during modeConfirm.
+	confirm keyval.KeyValue
+
+	// warning is displayed when the app starts.
+	warning string
 }
@@ -11,6 +11,7 @@ import (
 	"math"
 	"strings"
 
+	"github.com/janderland/fdbq/engine/facade"
 	"github.com/janderland/fdbq/engine/stream"
 	"github.com/janderland/fdbq/keyval"
 	"github.com/janderland/fdbq/keyval/convert"
@@ -336,6 +337,9 @@ func (x *Model) str(item any) string {
 		}
 		return x.str(val.Dir)
 
+	case facade.Write:
+		return val.String()
+
 	default:
 		return fmt.Sprintf("ERR! unexpected %T", val)
 	}
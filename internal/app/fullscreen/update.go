@@ -1,6 +1,8 @@
 package fullscreen
 
 import (
+	"container/list"
+	"fmt"
 	"time"
 
 	"github.com/charmbracelet/bubbles/cursor"
@@ -14,6 +16,9 @@ import (
 
 func (x Model) Init() tea.Cmd {
 	return func() tea.Msg {
+		if x.warning != "" {
+			return fmt.Sprintf("WARNING: %s. Press '?' to see the help menu.", x.warning)
+		}
 		return "Press '?' to see the help menu."
 	}
 }
@@ -33,6 +38,12 @@ func (x Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case manager.AsyncQueryMsg:
 		return x.updateAsyncQuery(msg)
 
+	case manager.ConfirmClearMsg:
+		return x.updateConfirmClear(msg), nil
+
+	case manager.DryRunMsg:
+		return x.updateDryRun(msg)
+
 	case error, string, keyval.KeyValue:
 		return x.updateSingle(msg)
 
@@ -132,6 +143,30 @@ func (x Model) updateKey(msg tea.KeyMsg) (Model, tea.Cmd) {
 		x.results.Top().Scroll(msg)
 		return x, nil
 
+	case modeConfirm:
+		switch msg.Type {
+		case tea.KeyEscape:
+			x.mode = modeScroll
+			x.results.Pop()
+			return x, nil
+
+		case tea.KeyRunes:
+			switch msg.String() {
+			case "n", "N":
+				x.mode = modeScroll
+				x.results.Pop()
+				return x, nil
+
+			case "y", "Y":
+				x.mode = modeScroll
+				x.results.Pop()
+				return x, x.qm.ClearRange(x.confirm)
+			}
+		}
+
+		x.results.Top().Scroll(msg)
+		return x, nil
+
 	default:
 		panic(errors.Errorf("unexpected mode '%v'", x.mode))
 	}
@@ -163,6 +198,28 @@ func (x Model) updateAsyncQuery(msg manager.AsyncQueryMsg) (Model, tea.Cmd) {
 	return x, nil
 }
 
+func (x Model) updateConfirmClear(msg manager.ConfirmClearMsg) Model {
+	if x.mode == modeInput {
+		x.input.Blur()
+	}
+	x.mode = modeConfirm
+	x.confirm = msg.Query
+	x.results.Push(newConfirmClear(msg.Query))
+	return x
+}
+
+func (x Model) updateDryRun(msg manager.DryRunMsg) (Model, tea.Cmd) {
+	writes := list.New()
+	for _, write := range msg.Writes {
+		writes.PushBack(write)
+	}
+	writes.PushBack(fmt.Sprintf("dry run: %d writes weren't committed", len(msg.Writes)))
+
+	x.results.Top().Reset()
+	x.results.Top().PushMany(writes)
+	return x, nil
+}
+
 func (x Model) updateSingle(msg any) (Model, tea.Cmd) {
 	x.results.Top().Reset()
 	x.results.Top().Push(msg)
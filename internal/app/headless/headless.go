@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/engine/facade"
+	"github.com/janderland/fdbq/engine/stream"
+	"github.com/janderland/fdbq/internal/app/kvfile"
 	q "github.com/janderland/fdbq/keyval"
 	"github.com/janderland/fdbq/keyval/class"
 	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/rewrite"
 	"github.com/janderland/fdbq/parser"
 	"github.com/janderland/fdbq/parser/format"
 	"github.com/janderland/fdbq/parser/scanner"
@@ -22,62 +27,295 @@ type App struct {
 	Format format.Format
 	Out    io.Writer
 
-	Write      bool
-	SingleOpts engine.SingleOpts
-	RangeOpts  engine.RangeOpts
+	// Warn receives warnings about how the queries
+	// are executed. If nil, warnings are discarded.
+	Warn io.Writer
+
+	Write       bool
+	RangeClear  bool
+	Watch       bool
+	ReadVersion int64
+	ShowVersion bool
+	Count       bool
+	Audit       bool
+	Bulk        bool
+	SingleOpts  engine.SingleOpts
+	RangeOpts   engine.RangeOpts
+
+	// DryRun causes write queries to be executed without
+	// committing. Instead, the writes are printed to Out.
+	// Write queries are allowed even if Write is false.
+	DryRun bool
+
+	// Explain causes the queries to be printed along with
+	// how they would be executed instead of executing them.
+	// See engine.Engine.Explain.
+	Explain bool
+
+	// Select holds the names of the variables whose data is
+	// printed for each key-value read by a query, instead of
+	// the key-value itself. The data is encoded according
+	// to SelectFormat. See kvfile.SelectWriter.
+	Select       []string
+	SelectFormat kvfile.SelectFormat
+
+	// GroupBy, when non-zero, causes range-reads to print the
+	// number of key-values & total value bytes of each group
+	// of keys sharing their first GroupBy tuple elements,
+	// instead of the key-values. See engine.Engine.GroupBy.
+	GroupBy int
 }
 
 func (x *App) Run(ctx context.Context, queries []string) error {
-	_, err := x.Engine.Transact(func(eg engine.Engine) (interface{}, error) {
+	if x.Explain {
 		for _, str := range queries {
-			p := parser.New(scanner.New(strings.NewReader(str)))
-			query, err := p.Parse()
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to parse query")
+			if err := x.query(ctx, x.Engine, str); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
+	if x.DryRun {
+		return x.dryRun(ctx, queries)
+	}
+	if x.Watch {
+		return x.watch(ctx, queries)
+	}
+	if x.paginate() && len(queries) != 1 {
+		return errors.New("paginated range-reads require a single query")
+	}
+	if x.paginate() && (x.Count || x.Audit || x.GroupBy > 0) {
+		return errors.New("paginated range-reads can't be counted, audited, or grouped")
+	}
+	if x.RangeOpts.Resume {
+		return x.resume(ctx, queries)
+	}
+	if x.Bulk {
+		return x.bulk(ctx, queries)
+	}
 
-			if dir, ok := query.(q.Directory); ok {
-				if err := x.directories(ctx, eg, dir); err != nil {
-					return nil, err
-				}
-				continue
+	_, versions, err := x.Engine.TransactVersions(func(eg engine.Engine) (interface{}, error) {
+		// All the queries share a single transaction,
+		// so the read version is set once up front.
+		if x.ReadVersion != 0 {
+			if err := eg.SetReadVersion(x.ReadVersion); err != nil {
+				return nil, errors.Wrap(err, "failed to set read version")
 			}
+		}
 
-			var kv q.KeyValue
-			if key, ok := query.(q.Key); ok {
-				kv = q.KeyValue{Key: key, Value: q.Variable{}}
-			} else {
-				kv = query.(q.KeyValue)
+		for _, str := range queries {
+			if err := x.query(ctx, eg, str); err != nil {
+				return nil, err
 			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
 
-			switch c := class.Classify(kv); c {
-			case class.Constant:
-				if err := x.set(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as set query")
-				}
+	if x.ShowVersion {
+		if _, err := fmt.Fprintf(x.Out, "read version: %d\n", versions.Read); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+		if versions.Commit >= 0 {
+			if _, err := fmt.Fprintf(x.Out, "commit version: %d\n", versions.Commit); err != nil {
+				return errors.Wrap(err, "failed to print output")
+			}
+		}
+	}
+	return nil
+}
 
-			case class.Clear:
-				if err := x.clear(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as clear query")
-				}
+// dryRun executes the given queries using an Engine which prints
+// the writes of each transaction to Out instead of committing them.
+func (x *App) dryRun(ctx context.Context, queries []string) error {
+	if x.Watch {
+		return errors.New("watches can't be used during a dry run")
+	}
 
-			case class.ReadSingle:
-				if err := x.singleRead(eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as single read query")
-				}
+	app := *x
+	app.DryRun = false
+	app.Write = true
+	app.Engine = x.Engine.DryRun(func(w facade.Write) {
+		_, _ = fmt.Fprintln(x.Out, w.String())
+	})
+	if err := app.Run(ctx, queries); err != nil {
+		return err
+	}
 
-			case class.ReadRange:
-				if err := x.rangeRead(ctx, eg, kv); err != nil {
-					return nil, errors.Wrap(err, "failed to execute as range read query")
-				}
+	if x.Warn != nil {
+		if _, err := fmt.Fprintln(x.Warn, "dry run: no writes were committed"); err != nil {
+			return errors.Wrap(err, "failed to print warning")
+		}
+	}
+	return nil
+}
 
-			default:
-				return nil, errors.Errorf("unexpected query class '%v'", c)
-			}
+// query parses and executes a single query using the given engine.
+func (x *App) query(ctx context.Context, eg engine.Engine, str string) error {
+	p := parser.New(scanner.New(strings.NewReader(str)))
+	query, err := p.Parse()
+	if err != nil {
+		return errors.Wrap(err, "failed to parse query")
+	}
+
+	if dir, ok := query.(q.Directory); ok {
+		if x.Explain {
+			return x.printPlan("directories", dir)
 		}
-		return nil, nil
+		return x.directories(ctx, eg, dir)
+	}
+
+	var (
+		kv    q.KeyValue
+		names = p.Names()
+	)
+	if key, ok := query.(q.Key); ok {
+		kv = q.KeyValue{Key: key, Value: q.Variable{}}
+		names = append(names, "")
+	} else {
+		kv = query.(q.KeyValue)
+	}
+
+	if x.Explain {
+		return x.explain(eg, kv)
+	}
+
+	switch c := class.Classify(kv); c {
+	case class.Constant:
+		if err := x.set(eg, kv); err != nil {
+			return errors.Wrap(err, "failed to execute as set query")
+		}
+
+	case class.Clear:
+		if err := x.clear(eg, kv); err != nil {
+			return errors.Wrap(err, "failed to execute as clear query")
+		}
+
+	case class.VariableClear:
+		if err := x.rangeClear(ctx, eg, kv); err != nil {
+			return errors.Wrap(err, "failed to execute as range clear query")
+		}
+
+	case class.Atomic:
+		if err := x.atomic(eg, kv); err != nil {
+			return errors.Wrap(err, "failed to execute as atomic query")
+		}
+
+	case class.ReadSingle:
+		printKV, err := x.printer(kv, names)
+		if err != nil {
+			return err
+		}
+		if err := x.singleRead(eg, kv, printKV); err != nil {
+			return errors.Wrap(err, "failed to execute as single read query")
+		}
+
+	case class.ReadRange:
+		printKV, err := x.printer(kv, names)
+		if err != nil {
+			return err
+		}
+		if err := x.rangeRead(ctx, eg, kv, printKV); err != nil {
+			return errors.Wrap(err, "failed to execute as range read query")
+		}
+
+	case class.VariableOperand:
+		return errors.New("atomic operand must be constant")
+
+	default:
+		return errors.Errorf("unexpected query class '%v'", c)
+	}
+	return nil
+}
+
+// resume executes the given queries without a shared transaction so
+// that range-reads may span multiple transactions. Because of this,
+// read versions & write queries are not supported.
+func (x *App) resume(ctx context.Context, queries []string) error {
+	if x.ReadVersion != 0 || x.ShowVersion {
+		return errors.New("read versions can't be used when range-reads span multiple transactions")
+	}
+	for _, str := range queries {
+		write, err := isWrite(str)
+		if err != nil {
+			return err
+		}
+		if write {
+			return errors.New("write queries can't be used when range-reads span multiple transactions")
+		}
+	}
+	if x.Warn != nil {
+		if _, err := fmt.Fprintf(x.Warn, "WARNING: %s\n", engine.ResumeWarning); err != nil {
+			return errors.Wrap(err, "failed to print warning")
+		}
+	}
+	for _, str := range queries {
+		if err := x.query(ctx, x.Engine, str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWrite returns true if the given query is a write query.
+func isWrite(str string) (bool, error) {
+	p := parser.New(scanner.New(strings.NewReader(str)))
+	query, err := p.Parse()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse query")
+	}
+	kv, ok := query.(q.KeyValue)
+	if !ok {
+		return false, nil
+	}
+	switch class.Classify(kv) {
+	case class.Constant, class.Clear, class.VariableClear, class.Atomic, class.VariableAtomic:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// bulk executes the given set queries using an [engine.Loader], which
+// groups the writes into multiple transactions. The progress of the
+// writes is printed to Warn.
+func (x *App) bulk(ctx context.Context, queries []string) error {
+	if !x.Write {
+		return errors.New("writing isn't enabled")
+	}
+	if x.ReadVersion != 0 || x.ShowVersion {
+		return errors.New("read versions can't be used when writes span multiple transactions")
+	}
+
+	loader := x.Engine.NewLoader(engine.LoadOpts{
+		Progress: func(p engine.LoadProgress) {
+			if x.Warn != nil {
+				_, _ = fmt.Fprintf(x.Warn, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+			}
+		},
 	})
-	return err
+
+	for _, str := range queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p := parser.New(scanner.New(strings.NewReader(str)))
+		query, err := p.Parse()
+		if err != nil {
+			return errors.Wrap(err, "failed to parse query")
+		}
+		kv, ok := query.(q.KeyValue)
+		if !ok || class.Classify(kv) != class.Constant {
+			return errors.Errorf("only set queries may be bulk written, got '%s'", str)
+		}
+		if err := loader.Set(kv); err != nil {
+			return errors.Wrap(err, "failed to execute as bulk set query")
+		}
+	}
+	return loader.Flush()
 }
 
 func (x *App) set(eg engine.Engine, query q.KeyValue) error {
@@ -94,7 +332,24 @@ func (x *App) clear(eg engine.Engine, query q.KeyValue) error {
 	return eg.Clear(query)
 }
 
-func (x *App) singleRead(eg engine.Engine, query q.KeyValue) error {
+func (x *App) rangeClear(ctx context.Context, eg engine.Engine, query q.KeyValue) error {
+	if !x.Write {
+		return errors.New("writing isn't enabled")
+	}
+	if !x.RangeClear {
+		return errors.New("range clears aren't enabled")
+	}
+	return eg.ClearRange(ctx, query)
+}
+
+func (x *App) atomic(eg engine.Engine, query q.KeyValue) error {
+	if !x.Write {
+		return errors.New("writing isn't enabled")
+	}
+	return eg.Atomic(query)
+}
+
+func (x *App) singleRead(eg engine.Engine, query q.KeyValue, printKV func(q.KeyValue) error) error {
 	kv, err := eg.ReadSingle(query, x.SingleOpts)
 	if err != nil {
 		return err
@@ -102,24 +357,160 @@ func (x *App) singleRead(eg engine.Engine, query q.KeyValue) error {
 	if kv == nil {
 		return nil
 	}
+	return printKV(*kv)
+}
+
+// printer returns a function which prints the key-values read by the
+// given query. If Select is empty, the key-values are formatted as is.
+// Otherwise, the data bound to the selected variables is printed. The
+// names are the names of the query's variables, see parser.Parser.Names.
+func (x *App) printer(query q.KeyValue, names []string) (func(q.KeyValue) error, error) {
+	if len(x.Select) == 0 {
+		return func(kv q.KeyValue) error {
+			x.Format.Reset()
+			x.Format.KeyValue(kv)
+			if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
+				return errors.Wrap(err, "failed to print output")
+			}
+			return nil
+		}, nil
+	}
+
+	w, err := kvfile.NewSelectWriter(x.Out, x.SelectFormat, x.Select)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Check(names); err != nil {
+		return nil, errors.Wrap(err, "invalid selection")
+	}
+	return func(kv q.KeyValue) error {
+		bindings, err := rewrite.Bind(query, names, kv)
+		if err != nil {
+			return errors.Wrap(err, "failed to bind key-value")
+		}
+		return w.Write(bindings)
+	}, nil
+}
+
+// explain prints how the given query would be executed. Range-reads
+// are either answered by scanning or via an index's entries. Other
+// queries are printed along with their class.
+func (x *App) explain(eg engine.Engine, query q.KeyValue) error {
+	c := class.Classify(query)
+	if c != class.ReadRange {
+		return x.printPlan(string(c), query)
+	}
+
+	plan, err := eg.Explain(query, x.RangeOpts)
+	if err != nil {
+		return err
+	}
+	if plan.Index == "" {
+		return x.printPlan("scan", query)
+	}
+	return x.printPlan("index "+plan.Index, plan.Lookup)
+}
 
+func (x *App) printPlan(label string, query q.Query) error {
 	x.Format.Reset()
-	x.Format.KeyValue(*kv)
-	if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
+	x.Format.Query(query)
+	if _, err := fmt.Fprintf(x.Out, "%s %s\n", label, x.Format.String()); err != nil {
 		return errors.Wrap(err, "failed to print output")
 	}
 	return nil
 }
 
-func (x *App) rangeRead(ctx context.Context, eg engine.Engine, query q.KeyValue) error {
+func (x *App) rangeRead(ctx context.Context, eg engine.Engine, query q.KeyValue, printKV func(q.KeyValue) error) error {
+	if x.Audit {
+		return x.audit(ctx, eg, query)
+	}
+	if x.GroupBy > 0 {
+		return x.groupBy(ctx, eg, query)
+	}
+	if x.Count {
+		count, err := eg.Count(ctx, query, x.RangeOpts)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(x.Out, count); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+		return nil
+	}
+
+	var (
+		last  q.KeyValue
+		count int
+	)
 	for kv := range eg.ReadRange(ctx, query, x.RangeOpts) {
 		if kv.Err != nil {
 			return kv.Err
 		}
+		if err := printKV(kv.KV); err != nil {
+			return err
+		}
+		last = kv.KV
+		count++
+	}
 
+	// If the page isn't full, the range-read is
+	// complete and there's no next page.
+	if !x.paginate() || x.RangeOpts.Limit == 0 || count < x.RangeOpts.Limit {
+		return nil
+	}
+	cursor, err := engine.Cursor(last)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(x.Out, "cursor: %s\n", cursor); err != nil {
+		return errors.Wrap(err, "failed to print output")
+	}
+	return nil
+}
+
+// paginate returns true if range-reads are paginated,
+// in which case a cursor is printed after each full page.
+func (x *App) paginate() bool {
+	return x.RangeOpts.Paginate || x.RangeOpts.Cursor != ""
+}
+
+// groupBy prints the key shared by each group of key-values
+// followed by the group's number of key-values & value bytes.
+func (x *App) groupBy(ctx context.Context, eg engine.Engine, query q.KeyValue) error {
+	groups, err := eg.GroupBy(ctx, query, x.GroupBy, x.RangeOpts)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
 		x.Format.Reset()
-		x.Format.KeyValue(kv.KV)
-		if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
+		x.Format.Key(group.Key)
+		if _, err := fmt.Fprintf(x.Out, "%s %d %d\n", x.Format.String(), group.Count, group.Bytes); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+	}
+	return nil
+}
+
+// audit prints each key-value which doesn't conform to the given
+// query along with the reason why, followed by the number of
+// violations of each kind.
+func (x *App) audit(ctx context.Context, eg engine.Engine, query q.KeyValue) error {
+	counts := make(map[stream.ViolationKind]int)
+	for v := range eg.Audit(ctx, query, x.RangeOpts) {
+		if v.Err != nil {
+			return v.Err
+		}
+		counts[v.Kind]++
+
+		x.Format.Reset()
+		x.Format.KeyValue(v.KV)
+		if _, err := fmt.Fprintf(x.Out, "%s # %s: %s\n", x.Format.String(), v.Kind, v.Reason); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+	}
+
+	for _, kind := range []stream.ViolationKind{stream.InvalidKey, stream.KeyMismatch, stream.ValueMismatch} {
+		if _, err := fmt.Fprintf(x.Out, "%s: %d\n", kind, counts[kind]); err != nil {
 			return errors.Wrap(err, "failed to print output")
 		}
 	}
@@ -140,3 +531,69 @@ func (x *App) directories(ctx context.Context, eg engine.Engine, query q.Directo
 	}
 	return nil
 }
+
+// watch executes the given queries as watches, printing each key-value
+// whenever it changes. The queries must be single-read queries. Watches
+// can't be executed within a shared transaction, so each query uses its
+// own transactions. This function returns when the context is canceled
+// or an error occurs.
+func (x *App) watch(ctx context.Context, queries []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var kvs []q.KeyValue
+	for _, str := range queries {
+		p := parser.New(scanner.New(strings.NewReader(str)))
+		query, err := p.Parse()
+		if err != nil {
+			return errors.Wrap(err, "failed to parse query")
+		}
+
+		var kv q.KeyValue
+		switch query := query.(type) {
+		case q.Key:
+			kv = q.KeyValue{Key: query, Value: q.Variable{}}
+		case q.KeyValue:
+			kv = query
+		default:
+			return errors.Errorf("only single read queries may be watched, got '%s'", str)
+		}
+		if c := class.Classify(kv); c != class.ReadSingle {
+			return errors.Errorf("only single read queries may be watched, got '%s'", str)
+		}
+		kvs = append(kvs, kv)
+	}
+
+	out := make(chan stream.KeyValErr)
+	var wg sync.WaitGroup
+	for _, kv := range kvs {
+		wg.Add(1)
+		go func(kv q.KeyValue) {
+			defer wg.Done()
+			for msg := range x.Engine.Watch(ctx, kv, x.SingleOpts) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- msg:
+				}
+			}
+		}(kv)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	for msg := range out {
+		if msg.Err != nil {
+			return errors.Wrap(msg.Err, "failed to execute as watch query")
+		}
+
+		x.Format.Reset()
+		x.Format.KeyValue(msg.KV)
+		if _, err := fmt.Fprintln(x.Out, x.Format.String()); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+	}
+	return nil
+}
@@ -15,10 +15,20 @@ import (
 
 func TestHeadless_Query(t *testing.T) {
 	tests := []struct {
-		name    string
-		write   bool
-		queries []string
-		err     bool
+		name        string
+		write       bool
+		rangeClear  bool
+		watch       bool
+		showVersion bool
+		readVersion int64
+		longScan    bool
+		bulk        bool
+		dryRun      bool
+		explain     bool
+		selected    []string
+		paginate    bool
+		queries     []string
+		err         bool
 	}{
 		{
 			name:    "set",
@@ -44,18 +54,174 @@ func TestHeadless_Query(t *testing.T) {
 			queries: []string{"/my/dir(\"hi\",\"there\")=clear"},
 			err:     true,
 		},
+		{
+			name:       "range clear",
+			write:      true,
+			rangeClear: true,
+			queries:    []string{"/my/<>(<>,\"expired\",...)=clear"},
+			err:        false,
+		},
+		{
+			name:       "range clear write error",
+			write:      false,
+			rangeClear: true,
+			queries:    []string{"/my/<>(<>,\"expired\",...)=clear"},
+			err:        true,
+		},
+		{
+			name:       "range clear confirm error",
+			write:      true,
+			rangeClear: false,
+			queries:    []string{"/my/<>(<>,\"expired\",...)=clear"},
+			err:        true,
+		},
+		{
+			name:    "atomic",
+			write:   true,
+			queries: []string{"/my/dir(\"hits\")=bit_or(1)"},
+			err:     false,
+		},
+		{
+			name:    "atomic big endian error",
+			write:   true,
+			queries: []string{"/my/dir(\"hits\")=add(1)"},
+			err:     true,
+		},
+		{
+			name:    "atomic error",
+			write:   false,
+			queries: []string{"/my/dir(\"hits\")=add(1)"},
+			err:     true,
+		},
 		{
 			name:    "get nothing",
 			write:   false,
 			queries: []string{"/nothing/is/here(\"wont\",\"match\")=<>"},
 			err:     false,
 		},
+		{
+			name:        "show version",
+			showVersion: true,
+			readVersion: 42,
+			queries:     []string{"/my/dir(\"hi\",\"there\")=<>"},
+			err:         false,
+		},
+		{
+			name:        "long scan version error",
+			longScan:    true,
+			showVersion: true,
+			queries:     []string{"/my/dir(<>)=<>"},
+			err:         true,
+		},
+		{
+			name:    "bulk",
+			write:   true,
+			bulk:    true,
+			queries: []string{"/my/dir(1)=33.9", "/my/dir(2)=\"hi\"", "/other(3)=nil"},
+			err:     false,
+		},
+		{
+			name:    "bulk write error",
+			write:   false,
+			bulk:    true,
+			queries: []string{"/my/dir(1)=33.9"},
+			err:     true,
+		},
+		{
+			name:    "bulk read error",
+			write:   true,
+			bulk:    true,
+			queries: []string{"/my/dir(1)=33.9", "/my/dir(<>)"},
+			err:     true,
+		},
+		{
+			name:    "watch range error",
+			watch:   true,
+			queries: []string{"/my/dir(<>)=<>"},
+			err:     true,
+		},
+		{
+			name:    "watch directory error",
+			watch:   true,
+			queries: []string{"/my/dir"},
+			err:     true,
+		},
+		{
+			name:    "dry run",
+			dryRun:  true,
+			queries: []string{"/my/dir(\"hi\",\"there\")=33.9", "/my/dir(\"hi\",\"there\")=<>"},
+			err:     false,
+		},
+		{
+			name:       "dry run range clear",
+			rangeClear: true,
+			dryRun:     true,
+			queries:    []string{"/my/<>(<>,\"expired\",...)=clear"},
+			err:        false,
+		},
+		{
+			name:    "dry run watch error",
+			watch:   true,
+			dryRun:  true,
+			queries: []string{"/my/dir(\"hi\")"},
+			err:     true,
+		},
+		{
+			name:    "explain",
+			explain: true,
+			queries: []string{"/my/dir(<>,\"there\")=<>", "/my/dir(\"hi\",\"there\")=33.9", "/my/dir"},
+			err:     false,
+		},
+		{
+			name:     "select",
+			selected: []string{"id", "val"},
+			queries:  []string{"/my/dir(<id:int>,\"there\")=<val:>", "/my/dir(<id:>)=<val:>"},
+			err:      false,
+		},
+		{
+			name:     "select write",
+			write:    true,
+			selected: []string{"id"},
+			queries:  []string{"/my/dir(<id:int>,\"there\")=<>", "/my/dir(\"hi\",\"there\")=33.9", "/my/dir(\"hi\",\"there\")=clear"},
+			err:      false,
+		},
+		{
+			name:     "paginate",
+			paginate: true,
+			queries:  []string{"/my/dir(<>,\"there\")=<>"},
+			err:      false,
+		},
+		{
+			name:     "paginate multiple queries error",
+			paginate: true,
+			queries:  []string{"/my/dir(<>,\"there\")=<>", "/my/dir(\"hi\",<>)=<>"},
+			err:      true,
+		},
+		{
+			name:     "select error",
+			selected: []string{"id", "other"},
+			queries:  []string{"/my/dir(<id:int>,\"there\")=<val:>"},
+			err:      true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			testEnv(t, func(app App) {
 				app.Write = test.write
+				app.RangeClear = test.rangeClear
+				app.Watch = test.watch
+				app.ShowVersion = test.showVersion
+				app.ReadVersion = test.readVersion
+				app.RangeOpts.Resume = test.longScan
+				app.Bulk = test.bulk
+				app.DryRun = test.dryRun
+				app.Explain = test.explain
+				app.Select = test.selected
+				if test.paginate {
+					app.RangeOpts.Paginate = true
+					app.RangeOpts.Limit = 1
+				}
 
 				err := app.Run(context.Background(), test.queries)
 				if test.err {
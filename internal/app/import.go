@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/internal/app/kvfile"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/parser/format"
+)
+
+var importFlags struct {
+	format string
+	schema string
+	header bool
+	dryRun bool
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFlags.format, "format", "", "format of the file: fql, ndjson, or csv (default inferred from the file extension)")
+	importCmd.Flags().StringVar(&importFlags.schema, "schema", "", "query whose variables are assigned the columns of each CSV row")
+	importCmd.Flags().BoolVar(&importFlags.header, "header", false, "skip the first row of the CSV file")
+	importCmd.Flags().BoolVar(&importFlags.dryRun, "dry-run", false, "print the key-values instead of writing them")
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [flags] file",
+	Short: "write the key-values read from a file",
+	Long: "Write the key-values read from a file. The file may contain FQL set queries, NDJSON objects, or CSV " +
+		"rows. If the file is '-', the key-values are read from stdin. The key-values are written in batches " +
+		"of transactions, so a failure may leave the file partially imported.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write && !importFlags.dryRun {
+			return errors.New("writing isn't enabled")
+		}
+
+		kvFormat, err := kvfile.ParseFormat(importFlags.format, args[0])
+		if err != nil {
+			return err
+		}
+
+		var schema keyval.KeyValue
+		if kvFormat == kvfile.CSV {
+			if importFlags.schema == "" {
+				return errors.New("CSV files require a schema")
+			}
+			schema, err = parseKeyValue(importFlags.schema)
+			if err != nil {
+				return err
+			}
+		}
+
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return errors.Wrap(err, "failed to open file")
+			}
+			defer func() { _ = file.Close() }()
+			in = file
+		}
+
+		reader, err := kvfile.NewReader(kvFormat, in, schema, importFlags.header)
+		if err != nil {
+			return err
+		}
+
+		if importFlags.dryRun {
+			return printImport(reader)
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			loader := eg.NewLoader(engine.LoadOpts{
+				Progress: func(p engine.LoadProgress) {
+					_, _ = fmt.Fprintf(os.Stderr, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+				},
+			})
+			for {
+				kv, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				if err := loader.Set(kv); err != nil {
+					return errors.Wrapf(err, "failed to import key-value %d", loader.Progress().Keys+1)
+				}
+			}
+			return loader.Flush()
+		})
+	},
+}
+
+// printImport prints the key-values which would be imported,
+// failing if any of them isn't a set query.
+func printImport(reader kvfile.Reader) error {
+	f := format.New(flags.FormatOpts()...)
+	for i := 1; ; i++ {
+		kv, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c := class.Classify(kv); c != class.Constant {
+			return errors.Errorf("key-value %d isn't a set query, has class '%v'", i, c)
+		}
+
+		f.Reset()
+		f.KeyValue(kv)
+		if _, err := fmt.Println(f.String()); err != nil {
+			return errors.Wrap(err, "failed to print output")
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package kvfile
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+type csvReader struct {
+	rows   *csv.Reader
+	schema q.KeyValue
+	vars   int
+	header bool
+}
+
+// NewCSVReader creates a Reader which maps each row of the given io.Reader onto the variables of the given
+// schema. The columns are assigned to the variables in the order the variables appear within the schema.
+// Each row must have a column for every variable. Directory variables are assigned strings, while the
+// other variables must specify a single type which the column is parsed as. Bytes are expected to be hex
+// encoded. If header is true, the first row is skipped.
+func NewCSVReader(r io.Reader, schema q.KeyValue, header bool) (Reader, error) {
+	vars, err := countVariables(schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid schema")
+	}
+	if vars == 0 {
+		return nil, errors.New("invalid schema: no variables")
+	}
+
+	rows := csv.NewReader(r)
+	rows.FieldsPerRecord = vars
+	return &csvReader{
+		rows:   rows,
+		schema: schema,
+		vars:   vars,
+		header: header,
+	}, nil
+}
+
+func (x *csvReader) Read() (q.KeyValue, error) {
+	if x.header {
+		x.header = false
+		if _, err := x.rows.Read(); err != nil {
+			if err == io.EOF {
+				return q.KeyValue{}, err
+			}
+			return q.KeyValue{}, errors.Wrap(err, "failed to read header")
+		}
+	}
+
+	row, err := x.rows.Read()
+	if err != nil {
+		if err == io.EOF {
+			return q.KeyValue{}, err
+		}
+		return q.KeyValue{}, errors.Wrap(err, "failed to read row")
+	}
+
+	line, _ := x.rows.FieldPos(0)
+	kv, err := fillVariables(x.schema, row)
+	if err != nil {
+		return q.KeyValue{}, errors.Wrapf(err, "failed to map row on line %d", line)
+	}
+	return kv, nil
+}
+
+// countVariables returns the number of variables in the schema. An
+// error is returned if the schema contains a variable which can't be
+// filled by a CSV column.
+func countVariables(schema q.KeyValue) (int, error) {
+	// Filling the variables with empty strings
+	// validates the schema without parsing.
+	f := filler{check: true}
+	if _, err := f.keyValue(schema); err != nil {
+		return 0, err
+	}
+	return f.i, nil
+}
+
+// fillVariables replaces the variables of the schema with the given columns.
+func fillVariables(schema q.KeyValue, columns []string) (q.KeyValue, error) {
+	f := filler{columns: columns}
+	return f.keyValue(schema)
+}
+
+// filler replaces the variables of a schema with the parsed columns.
+// When check is true, the columns aren't parsed, allowing the
+// variables to be counted and validated.
+type filler struct {
+	columns []string
+	check   bool
+	i       int
+}
+
+func (x *filler) keyValue(schema q.KeyValue) (q.KeyValue, error) {
+	var kv q.KeyValue
+	for _, part := range schema.Key.Directory {
+		if _, ok := part.(q.Variable); ok {
+			kv.Key.Directory = append(kv.Key.Directory, q.String(x.next()))
+			continue
+		}
+		kv.Key.Directory = append(kv.Key.Directory, part)
+	}
+
+	tup, err := x.tuple(schema.Key.Tuple)
+	if err != nil {
+		return q.KeyValue{}, errors.Wrap(err, "failed to fill key")
+	}
+	kv.Key.Tuple = tup
+
+	switch v := schema.Value.(type) {
+	case q.Variable:
+		val, err := x.variable(v)
+		if err != nil {
+			return q.KeyValue{}, errors.Wrap(err, "failed to fill value")
+		}
+		kv.Value = val
+
+	case q.Tuple:
+		tup, err := x.tuple(v)
+		if err != nil {
+			return q.KeyValue{}, errors.Wrap(err, "failed to fill value")
+		}
+		kv.Value = tup
+
+	default:
+		kv.Value = schema.Value
+	}
+	return kv, nil
+}
+
+func (x *filler) tuple(schema q.Tuple) (q.Tuple, error) {
+	tup := q.Tuple{}
+	for i, e := range schema {
+		switch e := e.(type) {
+		case q.Variable:
+			val, err := x.variable(e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to fill element %d", i)
+			}
+			tup = append(tup, val)
+
+		case q.Tuple:
+			sub, err := x.tuple(e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to fill element %d", i)
+			}
+			tup = append(tup, sub)
+
+		case q.MaybeMore:
+			return nil, errors.New("schema can't contain '...'")
+
+		default:
+			tup = append(tup, e)
+		}
+	}
+	return tup, nil
+}
+
+func (x *filler) variable(v q.Variable) (
+	interface {
+		q.TupElement
+		q.Value
+	},
+	error,
+) {
+	if len(v) != 1 || v[0] == q.AnyType || v[0] == q.TupleType {
+		return nil, errors.Errorf("variable must have a single, non-tuple type, has %v", v)
+	}
+	str := x.next()
+	if x.check {
+		return q.Nil{}, nil
+	}
+	return parseElement(v[0], str)
+}
+
+// next returns the next column. When checking
+// the schema, an empty string is returned.
+func (x *filler) next() string {
+	x.i++
+	if x.check {
+		return ""
+	}
+	return x.columns[x.i-1]
+}
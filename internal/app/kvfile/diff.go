@@ -0,0 +1,111 @@
+package kvfile
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+// DiffKV is a key-value compared by [MergeDiff]. The Dir, Key, & Value
+// fields hold the parts of the key-value which are compared with the
+// other side.
+type DiffKV struct {
+	KV q.KeyValue
+
+	// Dir holds the directory elements matched
+	// by the variables of the query's directory.
+	Dir []string
+
+	// Key holds the packed tuple.
+	Key []byte
+
+	// Value holds the packed value.
+	Value []byte
+}
+
+// CompareDiffKVs returns an integer comparing the keys of the
+// given DiffKVs, using the order they are read from the DB.
+func CompareDiffKVs(a, b *DiffKV) int {
+	for i := 0; i < len(a.Dir) && i < len(b.Dir); i++ {
+		if a.Dir[i] < b.Dir[i] {
+			return -1
+		}
+		if a.Dir[i] > b.Dir[i] {
+			return 1
+		}
+	}
+	if len(a.Dir) != len(b.Dir) {
+		if len(a.Dir) < len(b.Dir) {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a.Key, b.Key)
+}
+
+// MergeDiff reads both sides in key order and calls the given
+// function for each difference. If a key only exists on one side,
+// the other side's argument is nil. If the values differ, both
+// arguments are non-nil. Each side returns nil after its last
+// key-value. If a side isn't in key order, an error is returned.
+func MergeDiff(left, right func() (*DiffKV, error), f func(l, r *DiffKV) error) error {
+	var prevLeft, prevRight *DiffKV
+	next := func(side string, read func() (*DiffKV, error), prev **DiffKV) (*DiffKV, error) {
+		kv, err := read()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s side", side)
+		}
+		if kv != nil && *prev != nil && CompareDiffKVs(*prev, kv) >= 0 {
+			return nil, errors.Errorf("%s side isn't in key order", side)
+		}
+		*prev = kv
+		return kv, nil
+	}
+
+	l, err := next("left", left, &prevLeft)
+	if err != nil {
+		return err
+	}
+	r, err := next("right", right, &prevRight)
+	if err != nil {
+		return err
+	}
+
+	for l != nil || r != nil {
+		var cmp int
+		switch {
+		case l == nil:
+			cmp = 1
+		case r == nil:
+			cmp = -1
+		default:
+			cmp = CompareDiffKVs(l, r)
+		}
+
+		switch {
+		case cmp < 0:
+			err = f(l, nil)
+		case cmp > 0:
+			err = f(nil, r)
+		case !bytes.Equal(l.Value, r.Value):
+			err = f(l, r)
+		}
+		if err != nil {
+			return err
+		}
+
+		if cmp <= 0 {
+			if l, err = next("left", left, &prevLeft); err != nil {
+				return err
+			}
+		}
+		if cmp >= 0 {
+			if r, err = next("right", right, &prevRight); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
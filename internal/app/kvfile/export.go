@@ -0,0 +1,233 @@
+package kvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+// Entry is a single line of an export file. An entry either describes a
+// directory or a key-value within a directory. A directory's entry precedes
+// the entries of its key-values.
+type Entry struct {
+	// Dir is the path of the directory.
+	Dir []string
+
+	// IsDir is true if the entry describes the directory
+	// rather than a key-value within it.
+	IsDir bool
+
+	// Layer is the directory's layer. It's only
+	// set for directory entries, and may be nil.
+	Layer []byte
+
+	// Key is the key-value's tuple. When writing, RawKey
+	// is used instead if Key is nil or can't be encoded.
+	Key q.Tuple
+
+	// RawKey is the key-value's key with the directory
+	// prefix removed. When reading, it's only set if
+	// the entry doesn't contain a tuple.
+	RawKey []byte
+
+	// Value is the key-value's serialized value.
+	Value []byte
+}
+
+// exportEntry is the JSON object on each line of an export file.
+type exportEntry struct {
+	Dir    []string          `json:"dir"`
+	Layer  *string           `json:"layer,omitempty"`
+	Key    []json.RawMessage `json:"key,omitempty"`
+	RawKey *string           `json:"rawKey,omitempty"`
+	Value  *string           `json:"value,omitempty"`
+}
+
+// ExportWriter writes the entries of an export file. Each entry is written
+// as a JSON object on its own line. Directory entries have a "layer" field
+// holding the hex encoded layer. Key-value entries have a "value" field
+// holding the hex encoded value, and either a "key" field holding the tuple
+// as typed elements (see [NewNDJSONReader]) or a "rawKey" field holding the
+// hex encoded key.
+type ExportWriter struct {
+	enc *json.Encoder
+}
+
+// NewExportWriter creates an ExportWriter which writes to the given io.Writer.
+func NewExportWriter(w io.Writer) *ExportWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &ExportWriter{enc: enc}
+}
+
+func (x *ExportWriter) Write(entry Entry) error {
+	obj := exportEntry{Dir: entry.Dir}
+	if entry.IsDir {
+		layer := hex.EncodeToString(entry.Layer)
+		obj.Layer = &layer
+	} else {
+		if entry.Key != nil {
+			key, err := encodeTuple(entry.Key)
+			if err != nil && entry.RawKey == nil {
+				return errors.Wrap(err, "failed to encode key")
+			}
+			obj.Key = key
+		}
+		if obj.Key == nil {
+			rawKey := hex.EncodeToString(entry.RawKey)
+			obj.RawKey = &rawKey
+		}
+		value := hex.EncodeToString(entry.Value)
+		obj.Value = &value
+	}
+	return errors.Wrap(x.enc.Encode(obj), "failed to write entry")
+}
+
+// ExportReader reads the entries of an export
+// file written by an [ExportWriter].
+type ExportReader struct {
+	lines *bufio.Scanner
+	line  int
+}
+
+// NewExportReader creates an ExportReader which reads from the given io.Reader.
+func NewExportReader(r io.Reader) *ExportReader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLineSize)
+	return &ExportReader{lines: lines}
+}
+
+// Read returns the next entry. After the last
+// entry is read, io.EOF is returned.
+func (x *ExportReader) Read() (Entry, error) {
+	for x.lines.Scan() {
+		x.line++
+		line := bytes.TrimSpace(x.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, err := decodeEntry(line)
+		if err != nil {
+			return Entry{}, errors.Wrapf(err, "failed to decode line %d", x.line)
+		}
+		return entry, nil
+	}
+	if err := x.lines.Err(); err != nil {
+		return Entry{}, errors.Wrapf(err, "failed to read line %d", x.line+1)
+	}
+	return Entry{}, io.EOF
+}
+
+func decodeEntry(line []byte) (Entry, error) {
+	var obj exportEntry
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return Entry{}, errors.Wrap(err, "failed to decode JSON")
+	}
+	if len(obj.Dir) == 0 {
+		return Entry{}, errors.New("missing 'dir' field")
+	}
+
+	entry := Entry{Dir: obj.Dir}
+	if obj.Layer != nil {
+		if obj.Key != nil || obj.RawKey != nil || obj.Value != nil {
+			return Entry{}, errors.New("directory entry can't have 'key', 'rawKey', or 'value' fields")
+		}
+		layer, err := hex.DecodeString(*obj.Layer)
+		if err != nil {
+			return Entry{}, errors.Wrap(err, "failed to decode layer")
+		}
+		entry.IsDir = true
+		if len(layer) > 0 {
+			entry.Layer = layer
+		}
+		return entry, nil
+	}
+
+	if obj.Value == nil {
+		return Entry{}, errors.New("missing 'value' or 'layer' field")
+	}
+	value, err := hex.DecodeString(*obj.Value)
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "failed to decode value")
+	}
+	entry.Value = value
+
+	switch {
+	case obj.RawKey != nil && obj.Key != nil:
+		return Entry{}, errors.New("entry can't have both 'key' and 'rawKey' fields")
+
+	case obj.RawKey != nil:
+		rawKey, err := hex.DecodeString(*obj.RawKey)
+		if err != nil {
+			return Entry{}, errors.Wrap(err, "failed to decode raw key")
+		}
+		entry.RawKey = rawKey
+
+	default:
+		// An empty tuple is omitted when encoded.
+		key, err := decodeTuple(obj.Key)
+		if err != nil {
+			return Entry{}, errors.Wrap(err, "failed to decode key")
+		}
+		entry.Key = key
+	}
+	return entry, nil
+}
+
+func encodeTuple(tup q.Tuple) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, 0, len(tup))
+	for i, e := range tup {
+		raw, err := encodeElement(e)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode element %d", i)
+		}
+		out = append(out, raw)
+	}
+	return out, nil
+}
+
+// encodeElement encodes the given element as a
+// typed element. See [NewNDJSONReader].
+func encodeElement(e q.TupElement) (json.RawMessage, error) {
+	var (
+		typ string
+		val interface{}
+	)
+	switch e := e.(type) {
+	case q.Nil:
+		typ, val = "nil", nil
+	case q.Int:
+		typ, val = string(q.IntType), int64(e)
+	case q.Uint:
+		typ, val = string(q.UintType), uint64(e)
+	case q.Bool:
+		typ, val = string(q.BoolType), bool(e)
+	case q.Float:
+		typ, val = string(q.FloatType), float64(e)
+	case q.String:
+		typ, val = string(q.StringType), string(e)
+	case q.Bytes:
+		typ, val = string(q.BytesType), hex.EncodeToString(e)
+	case q.UUID:
+		typ, val = string(q.UUIDType), fmt.Sprintf("%x-%x-%x-%x-%x", e[:4], e[4:6], e[6:8], e[8:10], e[10:])
+	case q.Tuple:
+		tup, err := encodeTuple(e)
+		if err != nil {
+			return nil, err
+		}
+		typ, val = string(q.TupleType), tup
+	default:
+		return nil, errors.Errorf("unexpected element type %T", e)
+	}
+	return json.Marshal(map[string]interface{}{typ: val})
+}
@@ -0,0 +1,51 @@
+package kvfile
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/parser"
+	"github.com/janderland/fdbq/parser/scanner"
+)
+
+type fqlReader struct {
+	lines *bufio.Scanner
+	line  int
+}
+
+// NewFQLReader creates a Reader which parses each line of the
+// given io.Reader as a key-value query. Empty lines are skipped.
+func NewFQLReader(r io.Reader) Reader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLineSize)
+	return &fqlReader{lines: lines}
+}
+
+func (x *fqlReader) Read() (q.KeyValue, error) {
+	for x.lines.Scan() {
+		x.line++
+		str := strings.TrimSpace(x.lines.Text())
+		if str == "" {
+			continue
+		}
+
+		p := parser.New(scanner.New(strings.NewReader(str)))
+		query, err := p.Parse()
+		if err != nil {
+			return q.KeyValue{}, errors.Wrapf(err, "failed to parse line %d", x.line)
+		}
+		kv, ok := query.(q.KeyValue)
+		if !ok {
+			return q.KeyValue{}, errors.Errorf("line %d isn't a key-value", x.line)
+		}
+		return kv, nil
+	}
+	if err := x.lines.Err(); err != nil {
+		return q.KeyValue{}, errors.Wrapf(err, "failed to read line %d", x.line+1)
+	}
+	return q.KeyValue{}, io.EOF
+}
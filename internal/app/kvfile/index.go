@@ -0,0 +1,79 @@
+package kvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// IndexDef is a single line of an index file. It defines a secondary
+// index via a pair of queries written in the query language.
+type IndexDef struct {
+	// Name identifies the index.
+	Name string `json:"name"`
+
+	// Source is a range-read query. Each key-value
+	// it matches has an entry in the index.
+	Source string `json:"source"`
+
+	// Template is a set query which refers to the named
+	// variables of the source query. Each index entry is
+	// created by applying a key-value to the template.
+	Template string `json:"template"`
+}
+
+// ReadIndexDefs reads an index file. Each line of the file is a JSON
+// object with "name", "source", & "template" fields. Blank lines are
+// skipped. An error is returned if two indexes share the same name.
+func ReadIndexDefs(r io.Reader) ([]IndexDef, error) {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLineSize)
+
+	var (
+		out   []IndexDef
+		names = make(map[string]bool)
+		i     int
+	)
+	for lines.Scan() {
+		i++
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		def, err := decodeIndexDef(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode line %d", i)
+		}
+		if names[def.Name] {
+			return nil, errors.Errorf("index '%s' is defined more than once", def.Name)
+		}
+		names[def.Name] = true
+		out = append(out, def)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read line %d", i+1)
+	}
+	return out, nil
+}
+
+func decodeIndexDef(line []byte) (IndexDef, error) {
+	var def IndexDef
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return IndexDef{}, errors.Wrap(err, "failed to decode JSON")
+	}
+	switch {
+	case def.Name == "":
+		return IndexDef{}, errors.New("missing 'name' field")
+	case def.Source == "":
+		return IndexDef{}, errors.New("missing 'source' field")
+	case def.Template == "":
+		return IndexDef{}, errors.New("missing 'template' field")
+	}
+	return def, nil
+}
@@ -0,0 +1,128 @@
+package kvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JournalEntry is a single line of a journal file. It records the
+// value a key held before it was changed.
+type JournalEntry struct {
+	// Time is when the key was changed.
+	Time time.Time
+
+	// Dir is the path of the directory containing the key.
+	Dir []string
+
+	// Key is the key with the directory prefix removed.
+	Key []byte
+
+	// Value is the key's prior value. If the key
+	// didn't exist, Value is nil.
+	Value []byte
+}
+
+// journalEntry is the JSON object on each line of a journal file.
+type journalEntry struct {
+	Time  time.Time `json:"time"`
+	Dir   []string  `json:"dir"`
+	Key   string    `json:"key"`
+	Value *string   `json:"value"`
+}
+
+// JournalWriter writes the entries of a journal file. Each entry is
+// written as a JSON object on its own line. The "key" & "value" fields
+// hold hex encoded byte strings. If the key didn't exist, the "value"
+// field is null.
+type JournalWriter struct {
+	enc *json.Encoder
+}
+
+// NewJournalWriter creates a JournalWriter which writes to the given io.Writer.
+func NewJournalWriter(w io.Writer) *JournalWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JournalWriter{enc: enc}
+}
+
+func (x *JournalWriter) Write(entry JournalEntry) error {
+	obj := journalEntry{
+		Time: entry.Time,
+		Dir:  entry.Dir,
+		Key:  hex.EncodeToString(entry.Key),
+	}
+	if entry.Value != nil {
+		value := hex.EncodeToString(entry.Value)
+		obj.Value = &value
+	}
+	return errors.Wrap(x.enc.Encode(obj), "failed to write entry")
+}
+
+// JournalReader reads the entries of a journal
+// file written by a [JournalWriter].
+type JournalReader struct {
+	lines *bufio.Scanner
+	line  int
+}
+
+// NewJournalReader creates a JournalReader which reads from the given io.Reader.
+func NewJournalReader(r io.Reader) *JournalReader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLineSize)
+	return &JournalReader{lines: lines}
+}
+
+// Read returns the next entry. After the last
+// entry is read, io.EOF is returned.
+func (x *JournalReader) Read() (JournalEntry, error) {
+	for x.lines.Scan() {
+		x.line++
+		line := bytes.TrimSpace(x.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, err := decodeJournalEntry(line)
+		if err != nil {
+			return JournalEntry{}, errors.Wrapf(err, "failed to decode line %d", x.line)
+		}
+		return entry, nil
+	}
+	if err := x.lines.Err(); err != nil {
+		return JournalEntry{}, errors.Wrapf(err, "failed to read line %d", x.line+1)
+	}
+	return JournalEntry{}, io.EOF
+}
+
+func decodeJournalEntry(line []byte) (JournalEntry, error) {
+	var obj journalEntry
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return JournalEntry{}, errors.Wrap(err, "failed to decode JSON")
+	}
+	if len(obj.Dir) == 0 {
+		return JournalEntry{}, errors.New("missing 'dir' field")
+	}
+
+	key, err := hex.DecodeString(obj.Key)
+	if err != nil {
+		return JournalEntry{}, errors.Wrap(err, "failed to decode key")
+	}
+
+	entry := JournalEntry{Time: obj.Time, Dir: obj.Dir, Key: key}
+	if obj.Value != nil {
+		value, err := hex.DecodeString(*obj.Value)
+		if err != nil {
+			return JournalEntry{}, errors.Wrap(err, "failed to decode value")
+		}
+		entry.Value = value
+	}
+	return entry, nil
+}
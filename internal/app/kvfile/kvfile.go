@@ -0,0 +1,148 @@
+// Package kvfile reads & writes files of key-values.
+package kvfile
+
+import (
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+// maxLineSize is the max number of bytes in a single line of
+// an FQL or NDJSON file. FDB limits values to 100KB, which may
+// be twice as large once encoded as hex.
+const maxLineSize = 1 << 20
+
+// Format specifies how the key-values are encoded within a file.
+type Format string
+
+const (
+	// FQL files contain a key-value query on each
+	// line. Empty lines are ignored.
+	FQL Format = "fql"
+
+	// NDJSON files contain a JSON object on each line, with
+	// the fields "dir", "key" & "value". See [NewNDJSONReader].
+	NDJSON Format = "ndjson"
+
+	// CSV files contain a row for each key-value. The columns
+	// are mapped onto the variables of a schema. See [NewCSVReader].
+	CSV Format = "csv"
+)
+
+// AllFormats returns all valid values for Format.
+func AllFormats() []Format {
+	return []Format{FQL, NDJSON, CSV}
+}
+
+// ParseFormat converts the given string into a Format. If the string
+// is empty, the Format is inferred from the extension of the given
+// file path, defaulting to FQL.
+func ParseFormat(str string, path string) (Format, error) {
+	if str == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ndjson", ".jsonl":
+			return NDJSON, nil
+		case ".csv":
+			return CSV, nil
+		default:
+			return FQL, nil
+		}
+	}
+	for _, f := range AllFormats() {
+		if string(f) == str {
+			return f, nil
+		}
+	}
+	return "", errors.Errorf("unrecognized format '%s'", str)
+}
+
+// Reader reads key-values from a file. After the last
+// key-value is read, Read returns io.EOF.
+type Reader interface {
+	Read() (q.KeyValue, error)
+}
+
+// NewReader creates a Reader for the given Format. The schema
+// is only used by the CSV format and is ignored otherwise.
+func NewReader(format Format, r io.Reader, schema q.KeyValue, header bool) (Reader, error) {
+	switch format {
+	case FQL:
+		return NewFQLReader(r), nil
+	case NDJSON:
+		return NewNDJSONReader(r), nil
+	case CSV:
+		return NewCSVReader(r, schema, header)
+	default:
+		return nil, errors.Errorf("unrecognized format '%s'", format)
+	}
+}
+
+// parseElement parses the given string as the given type. Bytes
+// are expected to be hex encoded. Tuples aren't supported.
+func parseElement(typ q.ValueType, str string) (
+	interface {
+		q.TupElement
+		q.Value
+	},
+	error,
+) {
+	switch typ {
+	case q.IntType:
+		i, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse int")
+		}
+		return q.Int(i), nil
+
+	case q.UintType:
+		u, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse uint")
+		}
+		return q.Uint(u), nil
+
+	case q.BoolType:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse bool")
+		}
+		return q.Bool(b), nil
+
+	case q.FloatType:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse float")
+		}
+		return q.Float(f), nil
+
+	case q.StringType:
+		return q.String(str), nil
+
+	case q.BytesType:
+		b, err := hex.DecodeString(str)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse hex bytes")
+		}
+		return q.Bytes(b), nil
+
+	case q.UUIDType:
+		var uuid q.UUID
+		str = strings.ReplaceAll(str, "-", "")
+		if len(str) != 2*len(uuid) {
+			return nil, errors.Errorf("UUID must have %d hex digits", 2*len(uuid))
+		}
+		if _, err := hex.Decode(uuid[:], []byte(str)); err != nil {
+			return nil, errors.Wrap(err, "failed to parse UUID")
+		}
+		return uuid, nil
+
+	default:
+		return nil, errors.Errorf("can't parse type '%s'", typ)
+	}
+}
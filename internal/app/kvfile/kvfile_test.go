@@ -0,0 +1,526 @@
+package kvfile
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	q "github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/rewrite"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		str    string
+		path   string
+		format Format
+		err    bool
+	}{
+		{str: "", path: "data.fql", format: FQL},
+		{str: "", path: "data.txt", format: FQL},
+		{str: "", path: "data.NDJSON", format: NDJSON},
+		{str: "", path: "data.jsonl", format: NDJSON},
+		{str: "", path: "data.csv", format: CSV},
+		{str: "csv", path: "data.fql", format: CSV},
+		{str: "xml", path: "data.xml", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str+"|"+test.path, func(t *testing.T) {
+			format, err := ParseFormat(test.str, test.path)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.format, format)
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	schema := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("users"), q.Variable{}},
+			Tuple:     q.Tuple{q.Variable{q.IntType}, q.Tuple{q.Variable{q.BoolType}}, q.String("const")},
+		},
+		Value: q.Variable{q.FloatType},
+	}
+
+	tests := []struct {
+		name     string
+		format   Format
+		schema   q.KeyValue
+		header   bool
+		input    string
+		expected []q.KeyValue
+		err      bool
+	}{
+		{
+			name:   "fql",
+			format: FQL,
+			input:  "/a/b(1,\"hi\")=22\n\n  /c(0xff)=nil  \n",
+			expected: []q.KeyValue{
+				{Key: q.Key{Directory: q.Directory{q.String("a"), q.String("b")}, Tuple: q.Tuple{q.Int(1), q.String("hi")}}, Value: q.Int(22)},
+				{Key: q.Key{Directory: q.Directory{q.String("c")}, Tuple: q.Tuple{q.Bytes{0xff}}}, Value: q.Nil{}},
+			},
+		},
+		{
+			name:   "fql parse error",
+			format: FQL,
+			input:  "/a/b(1,\"hi\")=22\n/a(\n",
+			err:    true,
+		},
+		{
+			name:   "fql directory error",
+			format: FQL,
+			input:  "/a/b\n",
+			err:    true,
+		},
+		{
+			name:   "ndjson",
+			format: NDJSON,
+			input: `{"dir":["a"],"key":[{"int":-1},{"uint":2},{"tuple":[{"bool":true},{"nil":null}]}],"value":{"float":1.5}}
+
+{"dir":["b","c"],"key":[{"string":"x"},{"bytes":"a8f3"}],"value":{"uuid":"e3b0c442-98fc-1c14-9afb-f4c8996fb924"}}`,
+			expected: []q.KeyValue{
+				{
+					Key:   q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Int(-1), q.Uint(2), q.Tuple{q.Bool(true), q.Nil{}}}},
+					Value: q.Float(1.5),
+				},
+				{
+					Key:   q.Key{Directory: q.Directory{q.String("b"), q.String("c")}, Tuple: q.Tuple{q.String("x"), q.Bytes{0xa8, 0xf3}}},
+					Value: q.UUID{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24},
+				},
+			},
+		},
+		{
+			name:   "ndjson unknown type",
+			format: NDJSON,
+			input:  `{"dir":["a"],"key":[{"date":"2020"}],"value":{"nil":null}}`,
+			err:    true,
+		},
+		{
+			name:   "ndjson missing value",
+			format: NDJSON,
+			input:  `{"dir":["a"],"key":[]}`,
+			err:    true,
+		},
+		{
+			name:   "ndjson wrong type",
+			format: NDJSON,
+			input:  `{"dir":["a"],"key":[{"int":"1"}],"value":{"nil":null}}`,
+			err:    true,
+		},
+		{
+			name:   "csv",
+			format: CSV,
+			schema: schema,
+			header: true,
+			input:  "dir,id,flag,score\nbob,1,true,2.5\n\"a,b\",-7,false,0\n",
+			expected: []q.KeyValue{
+				{
+					Key:   q.Key{Directory: q.Directory{q.String("users"), q.String("bob")}, Tuple: q.Tuple{q.Int(1), q.Tuple{q.Bool(true)}, q.String("const")}},
+					Value: q.Float(2.5),
+				},
+				{
+					Key:   q.Key{Directory: q.Directory{q.String("users"), q.String("a,b")}, Tuple: q.Tuple{q.Int(-7), q.Tuple{q.Bool(false)}, q.String("const")}},
+					Value: q.Float(0),
+				},
+			},
+		},
+		{
+			name:   "csv value tuple",
+			format: CSV,
+			schema: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("users")}, Tuple: q.Tuple{q.Variable{q.IntType}}},
+				Value: q.Tuple{q.Variable{q.StringType}, q.Tuple{q.Variable{q.BoolType}}},
+			},
+			input: "1,bob,true\n",
+			expected: []q.KeyValue{
+				{
+					Key:   q.Key{Directory: q.Directory{q.String("users")}, Tuple: q.Tuple{q.Int(1)}},
+					Value: q.Tuple{q.String("bob"), q.Tuple{q.Bool(true)}},
+				},
+			},
+		},
+		{
+			name:   "csv column count",
+			format: CSV,
+			schema: schema,
+			input:  "bob,1,true\n",
+			err:    true,
+		},
+		{
+			name:   "csv parse error",
+			format: CSV,
+			schema: schema,
+			input:  "bob,one,true,2.5\n",
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewReader(test.format, strings.NewReader(test.input), test.schema, test.header)
+			require.NoError(t, err)
+
+			var kvs []q.KeyValue
+			for {
+				kv, err := r.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					require.True(t, test.err, "unexpected error: %v", err)
+					return
+				}
+				kvs = append(kvs, kv)
+			}
+			require.False(t, test.err, "expected an error")
+			require.Equal(t, test.expected, kvs)
+		})
+	}
+}
+
+func TestNewCSVReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema q.KeyValue
+	}{
+		{
+			name:   "no variables",
+			schema: q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Nil{}},
+		},
+		{
+			name:   "untyped variable",
+			schema: q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Variable{}}}, Value: q.Nil{}},
+		},
+		{
+			name:   "multiple types",
+			schema: q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Variable{q.IntType, q.StringType}},
+		},
+		{
+			name:   "value maybe more",
+			schema: q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Int(1)}}, Value: q.Tuple{q.Variable{q.IntType}, q.MaybeMore{}}},
+		},
+		{
+			name:   "maybe more",
+			schema: q.KeyValue{Key: q.Key{Directory: q.Directory{q.String("a")}, Tuple: q.Tuple{q.Variable{q.IntType}, q.MaybeMore{}}}, Value: q.Nil{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewCSVReader(strings.NewReader(""), test.schema, false)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := []Entry{
+		{Dir: []string{"a"}, IsDir: true},
+		{Dir: []string{"a"}, Key: q.Tuple{q.Int(-1), q.Uint(2), q.Tuple{q.Bool(true), q.Nil{}}}, Value: []byte{0x01, 0x02}},
+		{Dir: []string{"a"}, Key: q.Tuple{}, Value: []byte{}},
+		{Dir: []string{"a", "b"}, IsDir: true, Layer: []byte("layer")},
+		{Dir: []string{"a", "b"}, Key: q.Tuple{q.String("x"), q.Bytes{0xa8}, q.Float(1.5)}, Value: []byte("hi")},
+		{Dir: []string{"a", "b"}, Key: q.Tuple{q.UUID{0xe3, 0xb0, 0xc4, 0x42, 0x98, 0xfc, 0x1c, 0x14, 0x9a, 0xfb, 0xf4, 0xc8, 0x99, 0x6f, 0xb9, 0x24}}, Value: []byte{}},
+		{Dir: []string{"a", "b"}, RawKey: []byte{0xff, 0x00}, Value: []byte{0x00}},
+	}
+
+	var buf strings.Builder
+	w := NewExportWriter(&buf)
+	for _, entry := range entries {
+		require.NoError(t, w.Write(entry))
+	}
+
+	var actual []Entry
+	r := NewExportReader(strings.NewReader(buf.String()))
+	for {
+		entry, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		actual = append(actual, entry)
+	}
+	require.Equal(t, entries, actual)
+}
+
+func TestExportReader_Errors(t *testing.T) {
+	tests := []string{
+		`{"layer":""}`,
+		`{"dir":["a"]}`,
+		`{"dir":["a"],"layer":"","value":""}`,
+		`{"dir":["a"],"key":[],"rawKey":"00","value":""}`,
+		`{"dir":["a"],"rawKey":"zz","value":""}`,
+		`{"dir":["a"],"key":[{"int":1}],"value":"","extra":1}`,
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := NewExportReader(strings.NewReader(test)).Read()
+			require.Error(t, err)
+			require.NotEqual(t, io.EOF, err)
+		})
+	}
+}
+
+func TestJournal(t *testing.T) {
+	now := time.Date(2024, 3, 9, 14, 30, 0, 0, time.UTC)
+	entries := []JournalEntry{
+		{Time: now, Dir: []string{"a"}, Key: []byte{0x15, 0x01}, Value: []byte{0x01, 0x02}},
+		{Time: now, Dir: []string{"a", "b"}, Key: []byte{0x02, 0x78, 0x00}},
+		{Time: now.Add(time.Second), Dir: []string{"a"}, Key: []byte{0x15, 0x01}, Value: []byte{}},
+	}
+
+	var buf strings.Builder
+	w := NewJournalWriter(&buf)
+	for _, entry := range entries {
+		require.NoError(t, w.Write(entry))
+	}
+
+	var actual []JournalEntry
+	r := NewJournalReader(strings.NewReader(buf.String()))
+	for {
+		entry, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		actual = append(actual, entry)
+	}
+	require.Equal(t, entries, actual)
+}
+
+func TestJournalReader_Errors(t *testing.T) {
+	tests := []string{
+		`{"key":"00","value":null}`,
+		`{"dir":["a"],"key":"zz","value":null}`,
+		`{"dir":["a"],"key":"00","value":"zz"}`,
+		`{"dir":["a"],"key":"00","value":null,"extra":1}`,
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := NewJournalReader(strings.NewReader(test)).Read()
+			require.Error(t, err)
+			require.NotEqual(t, io.EOF, err)
+		})
+	}
+}
+
+func TestReadIndexDefs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []IndexDef
+		err      bool
+	}{
+		{
+			name: "valid",
+			input: `{"name":"by_last","source":"/people(<id:int>,<last:string>)=<>","template":"/index(:last,:id)=nil"}` + "\n\n" +
+				`{"name":"by_id","source":"/people(<id:int>,...)=<>","template":"/ids(:id)=nil"}`,
+			expected: []IndexDef{
+				{Name: "by_last", Source: "/people(<id:int>,<last:string>)=<>", Template: "/index(:last,:id)=nil"},
+				{Name: "by_id", Source: "/people(<id:int>,...)=<>", Template: "/ids(:id)=nil"},
+			},
+		},
+		{name: "empty", input: ""},
+		{name: "missing name", input: `{"source":"/a(<>)=<>","template":"/b()=nil"}`, err: true},
+		{name: "missing template", input: `{"name":"a","source":"/a(<>)=<>"}`, err: true},
+		{name: "unknown field", input: `{"name":"a","source":"/a(<>)=<>","template":"/b()=nil","extra":1}`, err: true},
+		{
+			name:  "duplicate name",
+			input: `{"name":"a","source":"/a(<>)=<>","template":"/b()=nil"}` + "\n" + `{"name":"a","source":"/c(<>)=<>","template":"/d()=nil"}`,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defs, err := ReadIndexDefs(strings.NewReader(test.input))
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, defs)
+		})
+	}
+}
+
+func TestSelectWriter(t *testing.T) {
+	bindings := []rewrite.Bindings{
+		{"id": q.Int(-1), "name": q.String("a\tb"), "tags": q.Tuple{q.Uint(2), q.Bool(true)}},
+		{"id": q.Int(7), "name": q.String("c"), "tags": q.Tuple{q.Bytes{0xa8}, q.Nil{}}},
+		{"id": q.Int(8), "name": q.String("d"), "tags": q.Tuple{q.Float(1.5), q.Float(math.Inf(1)), q.Float(math.NaN())}},
+	}
+
+	tests := []struct {
+		format SelectFormat
+		out    string
+	}{
+		{
+			format: TSV,
+			out:    "a\\tb\t-1\t(2,true)\nc\t7\t(a8,nil)\nd\t8\t(1.5,+Inf,NaN)\n",
+		},
+		{
+			format: JSON,
+			out:    "{\"name\":\"a\\tb\",\"id\":-1,\"tags\":[2,true]}\n{\"name\":\"c\",\"id\":7,\"tags\":[\"a8\",null]}\n{\"name\":\"d\",\"id\":8,\"tags\":[1.5,\"+Inf\",\"NaN\"]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var buf strings.Builder
+			w, err := NewSelectWriter(&buf, test.format, []string{"name", "id", "tags"})
+			require.NoError(t, err)
+			require.NoError(t, w.Check([]string{"", "id", "name", "tags"}))
+			for _, b := range bindings {
+				require.NoError(t, w.Write(b))
+			}
+			require.Equal(t, test.out, buf.String())
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := NewSelectWriter(io.Discard, "xml", []string{"id"})
+		require.Error(t, err)
+
+		_, err = NewSelectWriter(io.Discard, TSV, nil)
+		require.Error(t, err)
+
+		w, err := NewSelectWriter(io.Discard, TSV, []string{"id"})
+		require.NoError(t, err)
+		require.Error(t, w.Check([]string{"name", ""}))
+		require.Error(t, w.Write(rewrite.Bindings{"name": q.String("a")}))
+	})
+}
+
+func TestCompareDiffKVs(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     DiffKV
+		expected int
+	}{
+		{
+			name:     "equal",
+			a:        DiffKV{Dir: []string{"a"}, Key: []byte{1}},
+			b:        DiffKV{Dir: []string{"a"}, Key: []byte{1}},
+			expected: 0,
+		},
+		{
+			name:     "key",
+			a:        DiffKV{Dir: []string{"a"}, Key: []byte{1}},
+			b:        DiffKV{Dir: []string{"a"}, Key: []byte{1, 0}},
+			expected: -1,
+		},
+		{
+			name:     "dir before key",
+			a:        DiffKV{Dir: []string{"b"}, Key: []byte{1}},
+			b:        DiffKV{Dir: []string{"a"}, Key: []byte{2}},
+			expected: 1,
+		},
+		{
+			name:     "dir prefix",
+			a:        DiffKV{Dir: []string{"a"}, Key: []byte{2}},
+			b:        DiffKV{Dir: []string{"a", "b"}, Key: []byte{1}},
+			expected: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, CompareDiffKVs(&test.a, &test.b))
+			require.Equal(t, -test.expected, CompareDiffKVs(&test.b, &test.a))
+		})
+	}
+}
+
+func TestMergeDiff(t *testing.T) {
+	kv := func(dir string, key byte, value byte) *DiffKV {
+		return &DiffKV{Dir: []string{dir}, Key: []byte{key}, Value: []byte{value}}
+	}
+
+	tests := []struct {
+		name     string
+		left     []*DiffKV
+		right    []*DiffKV
+		expected [][2]*DiffKV
+		err      bool
+	}{
+		{
+			name:  "same",
+			left:  []*DiffKV{kv("a", 1, 0), kv("a", 2, 0)},
+			right: []*DiffKV{kv("a", 1, 0), kv("a", 2, 0)},
+		},
+		{
+			name:     "left only",
+			left:     []*DiffKV{kv("a", 1, 0), kv("a", 2, 0), kv("b", 1, 0)},
+			right:    []*DiffKV{kv("a", 2, 0)},
+			expected: [][2]*DiffKV{{kv("a", 1, 0), nil}, {kv("b", 1, 0), nil}},
+		},
+		{
+			name:     "right only",
+			left:     []*DiffKV{kv("a", 2, 0)},
+			right:    []*DiffKV{kv("a", 1, 0), kv("a", 2, 0), kv("b", 1, 0)},
+			expected: [][2]*DiffKV{{nil, kv("a", 1, 0)}, {nil, kv("b", 1, 0)}},
+		},
+		{
+			name:     "value differs",
+			left:     []*DiffKV{kv("a", 1, 0), kv("a", 2, 0)},
+			right:    []*DiffKV{kv("a", 1, 1), kv("a", 2, 0)},
+			expected: [][2]*DiffKV{{kv("a", 1, 0), kv("a", 1, 1)}},
+		},
+		{
+			name:     "empty side",
+			left:     []*DiffKV{kv("a", 1, 0)},
+			expected: [][2]*DiffKV{{kv("a", 1, 0), nil}},
+		},
+		{
+			name:  "left out of order",
+			left:  []*DiffKV{kv("b", 1, 0), kv("a", 1, 0)},
+			right: []*DiffKV{kv("a", 1, 0), kv("b", 1, 0)},
+			err:   true,
+		},
+		{
+			name:  "right duplicate",
+			left:  []*DiffKV{kv("a", 1, 0)},
+			right: []*DiffKV{kv("a", 1, 0), kv("a", 1, 0)},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read := func(kvs []*DiffKV) func() (*DiffKV, error) {
+				return func() (*DiffKV, error) {
+					if len(kvs) == 0 {
+						return nil, nil
+					}
+					kv := kvs[0]
+					kvs = kvs[1:]
+					return kv, nil
+				}
+			}
+
+			var diffs [][2]*DiffKV
+			err := MergeDiff(read(test.left), read(test.right), func(l, r *DiffKV) error {
+				diffs = append(diffs, [2]*DiffKV{l, r})
+				return nil
+			})
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, diffs)
+		})
+	}
+}
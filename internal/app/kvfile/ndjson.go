@@ -0,0 +1,184 @@
+package kvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+type ndjsonReader struct {
+	lines *bufio.Scanner
+	line  int
+}
+
+// ndjsonKV is the JSON object on each line of an NDJSON file.
+type ndjsonKV struct {
+	Dir   []string          `json:"dir"`
+	Key   []json.RawMessage `json:"key"`
+	Value json.RawMessage   `json:"value"`
+}
+
+// NewNDJSONReader creates a Reader which decodes each line of the given io.Reader as a JSON object.
+// Empty lines are skipped. The object's "dir" field is an array of strings specifying the directory.
+// The "key" field is an array of typed elements specifying the key's tuple, and the "value" field is
+// a typed element specifying the value. A typed element is an object with a single field. The field's
+// name is the element's type and the field's value is the element itself:
+//
+//	{"nil": null}
+//	{"int": -12}
+//	{"uint": 12}
+//	{"bool": true}
+//	{"float": 1.5}
+//	{"string": "hello"}
+//	{"bytes": "a8f3"}
+//	{"uuid": "e3b0c442-98fc-1c14-9afb-f4c8996fb924"}
+//	{"tuple": [{"int": 1}, {"string": "nested"}]}
+//
+// Bytes are encoded as hex strings.
+func NewNDJSONReader(r io.Reader) Reader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, maxLineSize)
+	return &ndjsonReader{lines: lines}
+}
+
+func (x *ndjsonReader) Read() (q.KeyValue, error) {
+	for x.lines.Scan() {
+		x.line++
+		line := bytes.TrimSpace(x.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		kv, err := decodeNDJSON(line)
+		if err != nil {
+			return q.KeyValue{}, errors.Wrapf(err, "failed to decode line %d", x.line)
+		}
+		return kv, nil
+	}
+	if err := x.lines.Err(); err != nil {
+		return q.KeyValue{}, errors.Wrapf(err, "failed to read line %d", x.line+1)
+	}
+	return q.KeyValue{}, io.EOF
+}
+
+func decodeNDJSON(line []byte) (q.KeyValue, error) {
+	var obj ndjsonKV
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return q.KeyValue{}, errors.Wrap(err, "failed to decode JSON")
+	}
+	if len(obj.Dir) == 0 {
+		return q.KeyValue{}, errors.New("missing 'dir' field")
+	}
+	if obj.Value == nil {
+		return q.KeyValue{}, errors.New("missing 'value' field")
+	}
+
+	var kv q.KeyValue
+	for _, part := range obj.Dir {
+		kv.Key.Directory = append(kv.Key.Directory, q.String(part))
+	}
+
+	tup, err := decodeTuple(obj.Key)
+	if err != nil {
+		return q.KeyValue{}, errors.Wrap(err, "failed to decode key")
+	}
+	kv.Key.Tuple = tup
+
+	kv.Value, err = decodeElement(obj.Value)
+	if err != nil {
+		return q.KeyValue{}, errors.Wrap(err, "failed to decode value")
+	}
+	return kv, nil
+}
+
+func decodeTuple(elements []json.RawMessage) (q.Tuple, error) {
+	tup := q.Tuple{}
+	for i, raw := range elements {
+		e, err := decodeElement(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode element %d", i)
+		}
+		tup = append(tup, e)
+	}
+	return tup, nil
+}
+
+// decodeElement decodes a typed element, which is
+// an object with a single field named after the
+// element's type.
+func decodeElement(raw json.RawMessage) (
+	interface {
+		q.TupElement
+		q.Value
+	},
+	error,
+) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, errors.Wrap(err, "typed element must be an object")
+	}
+	if len(obj) != 1 {
+		return nil, errors.Errorf("typed element must have a single field, has %d", len(obj))
+	}
+
+	var (
+		typ string
+		val json.RawMessage
+	)
+	for typ, val = range obj {
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(val))
+	dec.UseNumber()
+
+	switch typ {
+	case "nil":
+		if string(val) != "null" {
+			return nil, errors.New("nil element must be null")
+		}
+		return q.Nil{}, nil
+
+	case string(q.TupleType):
+		var elements []json.RawMessage
+		if err := dec.Decode(&elements); err != nil {
+			return nil, errors.Wrap(err, "tuple element must be an array")
+		}
+		return decodeTuple(elements)
+
+	case string(q.BoolType):
+		var b bool
+		if err := dec.Decode(&b); err != nil {
+			return nil, errors.Wrap(err, "bool element must be a boolean")
+		}
+		return q.Bool(b), nil
+
+	case string(q.IntType), string(q.UintType), string(q.FloatType):
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s element", typ)
+		}
+		num, ok := v.(json.Number)
+		if !ok {
+			return nil, errors.Errorf("%s element must be a number", typ)
+		}
+		return parseElement(q.ValueType(typ), num.String())
+
+	case string(q.StringType), string(q.BytesType), string(q.UUIDType):
+		var str string
+		if err := dec.Decode(&str); err != nil {
+			return nil, errors.Wrapf(err, "%s element must be a string", typ)
+		}
+		return parseElement(q.ValueType(typ), str)
+
+	default:
+		return nil, errors.Errorf("unrecognized type '%s'", typ)
+	}
+}
@@ -0,0 +1,212 @@
+package kvfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/rewrite"
+)
+
+// SelectFormat specifies how a [SelectWriter] encodes the selected data.
+type SelectFormat string
+
+const (
+	// TSV writes a line of tab-separated columns for each key-value.
+	// Strings are written as is, except for backslashes, tabs, and
+	// newlines, which are escaped with a backslash. Bytes are hex
+	// encoded and the elements of tuples are separated by commas
+	// within parentheses.
+	TSV SelectFormat = "tsv"
+
+	// JSON writes a JSON object for each key-value, mapping the
+	// selected names to their data. Bytes are hex encoded and
+	// tuples are written as arrays.
+	JSON SelectFormat = "json"
+)
+
+// AllSelectFormats returns all valid values for SelectFormat.
+func AllSelectFormats() []SelectFormat {
+	return []SelectFormat{TSV, JSON}
+}
+
+// ParseSelectFormat converts the given string into
+// a SelectFormat. If the string is empty, TSV is used.
+func ParseSelectFormat(str string) (SelectFormat, error) {
+	if str == "" {
+		return TSV, nil
+	}
+	for _, f := range AllSelectFormats() {
+		if string(f) == str {
+			return f, nil
+		}
+	}
+	return "", errors.Errorf("unrecognized select format '%s'", str)
+}
+
+// SelectWriter writes the data bound to the selected variables of each
+// key-value read by a query. The data is obtained via [rewrite.Bind].
+type SelectWriter struct {
+	w      io.Writer
+	format SelectFormat
+	names  []string
+}
+
+// NewSelectWriter creates a SelectWriter which writes the data bound to
+// the given names, in the given order, to the given io.Writer. If the
+// format is empty, TSV is used.
+func NewSelectWriter(w io.Writer, format SelectFormat, names []string) (*SelectWriter, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no names selected")
+	}
+	format, err := ParseSelectFormat(string(format))
+	if err != nil {
+		return nil, err
+	}
+	return &SelectWriter{w: w, format: format, names: names}, nil
+}
+
+// Check returns an error if any of the selected names isn't the
+// name of one of the query's variables, as returned by
+// parser.Parser.Names.
+func (x *SelectWriter) Check(names []string) error {
+	defined := make(map[string]bool)
+	for _, name := range names {
+		if name != "" {
+			defined[name] = true
+		}
+	}
+	for _, name := range x.names {
+		if !defined[name] {
+			return errors.Errorf("selected name '%s' isn't the name of a variable", name)
+		}
+	}
+	return nil
+}
+
+// Write writes the data bound to the selected names.
+func (x *SelectWriter) Write(bindings rewrite.Bindings) error {
+	var buf bytes.Buffer
+	for i, name := range x.names {
+		data, ok := bindings[name]
+		if !ok {
+			return errors.Errorf("selected name '%s' isn't bound", name)
+		}
+
+		switch x.format {
+		case JSON:
+			if i == 0 {
+				buf.WriteRune('{')
+			} else {
+				buf.WriteRune(',')
+			}
+			key, err := json.Marshal(name)
+			if err != nil {
+				return errors.Wrapf(err, "failed to encode name '%s'", name)
+			}
+			val, err := json.Marshal(jsonElement(data))
+			if err != nil {
+				return errors.Wrapf(err, "failed to encode data of '%s'", name)
+			}
+			buf.Write(key)
+			buf.WriteRune(':')
+			buf.Write(val)
+
+		default:
+			if i != 0 {
+				buf.WriteRune('\t')
+			}
+			buf.WriteString(tsvElement(data))
+		}
+	}
+	if x.format == JSON {
+		buf.WriteRune('}')
+	}
+	buf.WriteRune('\n')
+
+	_, err := x.w.Write(buf.Bytes())
+	return errors.Wrap(err, "failed to write selection")
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// tsvElement encodes the given element as a TSV column.
+func tsvElement(e q.TupElement) string {
+	switch e := e.(type) {
+	case q.String:
+		return tsvEscaper.Replace(string(e))
+	case q.Tuple:
+		var parts []string
+		for _, element := range e {
+			parts = append(parts, tsvElement(element))
+		}
+		return "(" + strings.Join(parts, ",") + ")"
+	default:
+		return tsvEscaper.Replace(plainElement(e))
+	}
+}
+
+// jsonElement converts the given element
+// into a value encodable as plain JSON.
+func jsonElement(e q.TupElement) interface{} {
+	switch e := e.(type) {
+	case q.Nil:
+		return nil
+	case q.Int:
+		return int64(e)
+	case q.Uint:
+		return uint64(e)
+	case q.Bool:
+		return bool(e)
+	case q.Float:
+		// JSON can't represent NaN or infinity,
+		// so they're encoded as strings instead.
+		if math.IsNaN(float64(e)) || math.IsInf(float64(e), 0) {
+			return plainElement(e)
+		}
+		return float64(e)
+	case q.String:
+		return string(e)
+	case q.Tuple:
+		out := make([]interface{}, 0, len(e))
+		for _, element := range e {
+			out = append(out, jsonElement(element))
+		}
+		return out
+	default:
+		return plainElement(e)
+	}
+}
+
+// plainElement encodes the given element as a string in the
+// same way parseElement expects. Tuples aren't supported.
+func plainElement(e q.TupElement) string {
+	switch e := e.(type) {
+	case q.Nil:
+		return "nil"
+	case q.Int:
+		return strconv.FormatInt(int64(e), 10)
+	case q.Uint:
+		return strconv.FormatUint(uint64(e), 10)
+	case q.Bool:
+		return strconv.FormatBool(bool(e))
+	case q.Float:
+		return strconv.FormatFloat(float64(e), 'g', -1, 64)
+	case q.String:
+		return string(e)
+	case q.Bytes:
+		return hex.EncodeToString(e)
+	case q.UUID:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", e[:4], e[4:6], e[6:8], e[8:10], e[10:])
+	default:
+		return fmt.Sprintf("%v", e)
+	}
+}
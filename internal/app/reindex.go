@@ -0,0 +1,71 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+)
+
+var reindexFlags struct {
+	clear    bool
+	longScan bool
+}
+
+func init() {
+	reindexCmd.Flags().BoolVar(&reindexFlags.clear, "clear", false, "clear the index's existing entries before writing")
+	reindexCmd.Flags().BoolVar(&reindexFlags.longScan, "long-scan", false, "allow the source range-read to span multiple transactions, giving up consistency")
+}
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex [flags] name",
+	Short: "write the entries of a secondary index for its existing key-values",
+	Long: "Write an index entry for every key-value matching the source query of the named index, which " +
+		"must be defined in the file given to the --indexes flag. Use this to backfill an index which was " +
+		"defined after its key-values were written. Without --clear, stale entries are left in place. The " +
+		"writes are performed in batches of transactions, so a failure may leave the index partially written.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write {
+			return errors.New("writing isn't enabled")
+		}
+
+		indexes, err := loadIndexes()
+		if err != nil {
+			return err
+		}
+		var index *engine.Index
+		for i := range indexes {
+			if indexes[i].Name() == args[0] {
+				index = &indexes[i]
+			}
+		}
+		if index == nil {
+			return errors.Errorf("index '%s' isn't defined", args[0])
+		}
+
+		if reindexFlags.longScan {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", engine.ResumeWarning)
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			if reindexFlags.clear {
+				if err := eg.ClearIndex(cmd.Context(), *index); err != nil {
+					return errors.Wrap(err, "failed to clear index")
+				}
+			}
+
+			rangeOpts := engine.RangeOpts{Resume: reindexFlags.longScan}
+			loadOpts := engine.LoadOpts{
+				Progress: func(p engine.LoadProgress) {
+					_, _ = fmt.Fprintf(os.Stderr, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+				},
+			}
+			return eg.Reindex(cmd.Context(), *index, rangeOpts, loadOpts)
+		})
+	},
+}
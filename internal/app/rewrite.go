@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
+	"github.com/janderland/fdbq/keyval/compare"
+	"github.com/janderland/fdbq/keyval/convert"
+	"github.com/janderland/fdbq/keyval/rewrite"
+	"github.com/janderland/fdbq/parser/format"
+)
+
+var rewriteFlags struct {
+	clear    bool
+	dryRun   bool
+	longScan bool
+}
+
+func init() {
+	rewriteCmd.Flags().BoolVar(&rewriteFlags.clear, "clear", false, "clear each source key-value after writing its target key-value")
+	rewriteCmd.Flags().BoolVar(&rewriteFlags.dryRun, "dry-run", false, "print the writes instead of performing them")
+	rewriteCmd.Flags().BoolVar(&rewriteFlags.longScan, "long-scan", false, "allow the source range-read to span multiple transactions, giving up consistency")
+}
+
+var rewriteCmd = &cobra.Command{
+	Use:   "rewrite [flags] source target",
+	Short: "write a target key-value for each key-value read by a source range-read",
+	Long: "For each key-value read by the source range-read query, write the target key-value. The target " +
+		"query is a template which refers to the source query's named variables. For instance, the source " +
+		"'/old(<a:int>,<b:string>)=<v:>' and the target '/new(:b,:a)=:v' swap the elements of each key while " +
+		"moving it to another directory. Key-values which don't match the source query are skipped. The " +
+		"writes are performed in batches of transactions, so a failure may leave the rewrite partially applied.",
+	Args: cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write && !rewriteFlags.dryRun {
+			return errors.New("writing isn't enabled")
+		}
+
+		source, names, err := parseNamedKeyValue(args[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid source")
+		}
+		if c := class.Classify(source); c != class.ReadRange {
+			return errors.Errorf("source query isn't a range-read, has class '%v'", c)
+		}
+
+		target, err := parseKeyValue(args[1])
+		if err != nil {
+			return errors.Wrap(err, "invalid target")
+		}
+		if err := rewrite.Check(target, names); err != nil {
+			return errors.Wrap(err, "invalid target")
+		}
+
+		if rewriteFlags.longScan {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", engine.ResumeWarning)
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			var (
+				f      = format.New(flags.FormatOpts()...)
+				loader = eg.NewLoader(engine.LoadOpts{
+					Progress: func(p engine.LoadProgress) {
+						_, _ = fmt.Fprintf(os.Stderr, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+					},
+				})
+			)
+
+			opts := engine.RangeOpts{Filter: true, Resume: rewriteFlags.longScan}
+			for msg := range eg.ReadRange(ctx, source, opts) {
+				if msg.Err != nil {
+					return msg.Err
+				}
+
+				out, err := rewriteKV(source, names, target, msg.KV)
+				if err != nil {
+					f.Reset()
+					f.KeyValue(msg.KV)
+					return errors.Wrapf(err, "failed to rewrite '%s'", f.String())
+				}
+
+				var writes []keyval.KeyValue
+				if rewriteFlags.clear {
+					writes = append(writes, keyval.KeyValue{Key: msg.KV.Key, Value: keyval.Clear{}})
+				}
+				writes = append(writes, out)
+
+				for _, kv := range writes {
+					if rewriteFlags.dryRun {
+						f.Reset()
+						f.KeyValue(kv)
+						if _, err := fmt.Println(f.String()); err != nil {
+							return errors.Wrap(err, "failed to print output")
+						}
+						continue
+					}
+
+					if class.Classify(kv) == class.Clear {
+						err = loader.Clear(kv)
+					} else {
+						err = loader.Set(kv)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			if rewriteFlags.dryRun {
+				return nil
+			}
+			return loader.Flush()
+		})
+	},
+}
+
+// rewriteKV applies the given key-value, read by the source query,
+// onto the target template. If the source key-values are cleared or
+// read across transactions, the target key-value must not match the
+// source query unless it's the same key. Otherwise, the rewrite could
+// clear or reread the key-values it has written.
+func rewriteKV(source keyval.KeyValue, names []string, target keyval.KeyValue, kv keyval.KeyValue) (keyval.KeyValue, error) {
+	bindings, err := rewrite.Bind(source, names, kv)
+	if err != nil {
+		return keyval.KeyValue{}, err
+	}
+
+	out, err := rewrite.Apply(target, bindings)
+	if err != nil {
+		return keyval.KeyValue{}, err
+	}
+	if c := class.Classify(out); c != class.Constant {
+		return keyval.KeyValue{}, errors.Errorf("target isn't a set query, has class '%v'", c)
+	}
+
+	if rewriteFlags.clear || rewriteFlags.longScan {
+		path, err := convert.ToStringArray(out.Key.Directory)
+		if err != nil {
+			return keyval.KeyValue{}, err
+		}
+		if compare.Directory(source.Key.Directory, path) && compare.Tuples(source.Key.Tuple, out.Key.Tuple) == nil && !out.Key.Eq(kv.Key) {
+			return keyval.KeyValue{}, errors.New("target key matches the source query")
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/janderland/fdbq/engine"
+	"github.com/janderland/fdbq/engine/facade"
+	"github.com/janderland/fdbq/internal/app/kvfile"
+)
+
+var undoFlags struct {
+	dryRun bool
+}
+
+func init() {
+	undoCmd.Flags().BoolVar(&undoFlags.dryRun, "dry-run", false, "print the writes instead of performing them")
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [flags] journal",
+	Short: "restore the keys recorded in a journal to their prior values",
+	Long: "Restore each key recorded in a journal file, created via the --journal flag, to the value it " +
+		"held before it was first changed. Keys which didn't exist are cleared. If the file is '-', the " +
+		"journal is read from stdin. Directories created by the journaled queries aren't removed. The " +
+		"writes are performed in batches of transactions, so a failure may leave the journal partially undone.",
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !flags.Write && !undoFlags.dryRun {
+			return errors.New("writing isn't enabled")
+		}
+
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return errors.Wrap(err, "failed to open file")
+			}
+			defer func() { _ = file.Close() }()
+			in = file
+		}
+
+		entries, err := firstEntries(kvfile.NewJournalReader(in))
+		if err != nil {
+			return err
+		}
+
+		return withEngine(func(eg engine.Engine) error {
+			opts := engine.LoadOpts{
+				Progress: func(p engine.LoadProgress) {
+					_, _ = fmt.Fprintf(os.Stderr, "wrote %d KVs (%d bytes) in %d transactions\n", p.Keys, p.Bytes, p.Batches)
+				},
+			}
+			if undoFlags.dryRun {
+				eg = eg.DryRun(func(w facade.Write) {
+					fmt.Println(w.String())
+				})
+				opts.Progress = nil
+			}
+
+			loader := eg.NewLoader(opts)
+			for _, entry := range entries {
+				if entry.Value == nil {
+					err = loader.ClearRaw(entry.Dir, entry.Key)
+				} else {
+					err = loader.SetRaw(entry.Dir, entry.Key, entry.Value)
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to undo entry for directory %v", entry.Dir)
+				}
+			}
+			return loader.Flush()
+		})
+	},
+}
+
+// firstEntries reads the entries of a journal and returns the first
+// entry of each key, in the order they appear. The first entry holds
+// the value the key had before the journal began.
+func firstEntries(r *kvfile.JournalReader) ([]kvfile.JournalEntry, error) {
+	var (
+		out  []kvfile.JournalEntry
+		seen = make(map[string]bool)
+	)
+	for {
+		entry, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var dir tuple.Tuple
+		for _, part := range entry.Dir {
+			dir = append(dir, part)
+		}
+		id := string(tuple.Tuple{dir, entry.Key}.Pack())
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, entry)
+	}
+}
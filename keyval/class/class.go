@@ -31,12 +31,35 @@ const (
 
 	// VariableClear specifies that the KeyValue has a
 	// Variable or MaybeMore in its Key and has a Clear for
-	// its value. This is an invalid class of KeyValue.
+	// its value. This kind of KeyValue can be used to clear
+	// every key-value matching the schema.
 	VariableClear Class = "variable clear"
 
+	// Atomic specifies that the KeyValue has no Variable or
+	// MaybeMore in its Key and has an Atomic Value. This
+	// kind of KeyValue can be used to perform an atomic
+	// mutation of a single key.
+	Atomic Class = "atomic"
+
+	// VariableAtomic specifies that the KeyValue has a
+	// Variable or MaybeMore in its Key and has an Atomic
+	// for its value. This is an invalid class of KeyValue.
+	VariableAtomic Class = "variable atomic"
+
 	// Nil specifies that the KeyValue contains a nil (not keyval.Nil).
 	// This is an invalid class of KeyValue.
 	Nil Class = "nil"
+
+	// VariableOperand specifies that the KeyValue has an Atomic
+	// Value whose operand contains a Variable or Reference. The
+	// operand is sent to FDB as is, so it must be constant. This
+	// is an invalid class of KeyValue.
+	VariableOperand Class = "variable operand"
+
+	// Reference specifies that the KeyValue contains a Reference.
+	// References must be replaced before the KeyValue is executed
+	// (see package rewrite). This is an invalid class of KeyValue.
+	Reference Class = "reference"
 )
 
 // subClass categorizes the Key, Directory,
@@ -55,10 +78,21 @@ const (
 	// clearSubClass specifies that the component contains a Clear.
 	clearSubClass
 
+	// atomicSubClass specifies that the component contains an Atomic.
+	atomicSubClass
+
 	// nilSubClass specifies that the component contains a nil, which
 	// isn't allowed in any part of the key-value. This shouldn't be
 	// confused with an instance of the Nil type.
 	nilSubClass
+
+	// variableOperandSubClass specifies that the component contains
+	// an Atomic whose operand isn't constant.
+	variableOperandSubClass
+
+	// referenceSubClass specifies that the component contains a
+	// Reference, which must be replaced before execution.
+	referenceSubClass
 )
 
 // Classify returns the Class of the given KeyValue.
@@ -72,6 +106,18 @@ func Classify(kv q.KeyValue) Class {
 		return Nil
 	}
 
+	// An Atomic's operand can't contain variables or
+	// references, regardless of the rest of the key-value.
+	if valClass == variableOperandSubClass {
+		return VariableOperand
+	}
+
+	// References are only allowed in templates, which
+	// can't be executed until the references are replaced.
+	if keyClass == referenceSubClass || valClass == referenceSubClass {
+		return Reference
+	}
+
 	// If the key is constant, then this query will only affect
 	// a single key and the value will dictate what kind of
 	// single-key query it will be.
@@ -79,6 +125,8 @@ func Classify(kv q.KeyValue) Class {
 		switch valClass {
 		case clearSubClass:
 			return Clear
+		case atomicSubClass:
+			return Atomic
 		case variableSubClass:
 			return ReadSingle
 		default:
@@ -87,12 +135,16 @@ func Classify(kv q.KeyValue) Class {
 	}
 
 	// If the key is not constant then the query should be a
-	// range read, unless it has a Clear instance for its
-	// value.
-	if valClass == clearSubClass {
+	// range read, unless it has a Clear or Atomic instance
+	// for its value.
+	switch valClass {
+	case clearSubClass:
 		return VariableClear
+	case atomicSubClass:
+		return VariableAtomic
+	default:
+		return ReadRange
 	}
-	return ReadRange
 }
 
 func classifyKey(key q.Key) subClass {
@@ -102,6 +154,9 @@ func classifyKey(key q.Key) subClass {
 	if dirClass == nilSubClass || tupClass == nilSubClass {
 		return nilSubClass
 	}
+	if dirClass == referenceSubClass || tupClass == referenceSubClass {
+		return referenceSubClass
+	}
 	if dirClass == variableSubClass || tupClass == variableSubClass {
 		return variableSubClass
 	}
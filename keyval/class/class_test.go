@@ -83,6 +83,86 @@ func TestClassify(t *testing.T) {
 				Value: q.Clear{},
 			},
 		},
+		{
+			kind: Atomic,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.String("hits")},
+				},
+				Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)},
+			},
+		},
+		{
+			kind: VariableAtomic,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.Variable{}},
+				},
+				Value: q.Atomic{Op: q.AddOp, Operand: q.Int(1)},
+			},
+		},
+		{
+			kind: ReadRange,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.Variable{}, q.Tuple{q.Int(1)}},
+				},
+				Value: q.Nil{},
+			},
+		},
+		{
+			kind: Reference,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.Reference("dir")},
+					Tuple:     q.Tuple{q.Int(123)},
+				},
+				Value: q.Nil{},
+			},
+		},
+		{
+			kind: Reference,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.Tuple{q.Reference("a")}, q.Variable{}},
+				},
+				Value: q.Variable{},
+			},
+		},
+		{
+			kind: Reference,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.Int(123)},
+				},
+				Value: q.Reference("v"),
+			},
+		},
+		{
+			kind: VariableOperand,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.String("dir")},
+					Tuple:     q.Tuple{q.Int(123)},
+				},
+				Value: q.Atomic{Op: q.AddOp, Operand: q.Variable{q.IntType}},
+			},
+		},
+		{
+			kind: VariableOperand,
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("my"), q.Variable{}},
+					Tuple:     q.Tuple{q.Int(123)},
+				},
+				Value: q.Atomic{Op: q.AddOp, Operand: q.Reference("n")},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -128,6 +208,16 @@ func TestClassifyNil(t *testing.T) {
 				Value: nil,
 			},
 		},
+		{
+			name: "atomic operand",
+			kv: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("hi"), q.String("you")},
+					Tuple:     q.Tuple{q.Int(34), q.String("wow")},
+				},
+				Value: q.Atomic{Op: q.MaxOp},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -13,21 +13,46 @@ type dirClassification struct{ out subClass }
 func (x *dirClassification) ForString(q.String) {}
 
 func (x *dirClassification) ForVariable(q.Variable) {
-	x.out = variableSubClass
+	if x.out < variableSubClass {
+		x.out = variableSubClass
+	}
+}
+
+func (x *dirClassification) ForReference(q.Reference) {
+	x.out = referenceSubClass
 }
 
 type tupClassification struct{ out subClass }
 
 func (x *tupClassification) ForTuple(e q.Tuple) {
-	x.out = classifyTuple(e)
+	// Only replace the current classification if the nested
+	// tuple's takes precedence. Otherwise, a constant nested
+	// tuple would hide the variables preceding it.
+	if class := classifyTuple(e); class > x.out {
+		x.out = class
+	}
 }
 
 func (x *tupClassification) ForVariable(q.Variable) {
-	x.out = variableSubClass
+	if x.out < variableSubClass {
+		x.out = variableSubClass
+	}
+}
+
+func (x *tupClassification) ForPredicate(q.Predicate) {
+	if x.out < variableSubClass {
+		x.out = variableSubClass
+	}
 }
 
 func (x *tupClassification) ForMaybeMore(q.MaybeMore) {
-	x.out = variableSubClass
+	if x.out < variableSubClass {
+		x.out = variableSubClass
+	}
+}
+
+func (x *tupClassification) ForReference(q.Reference) {
+	x.out = referenceSubClass
 }
 
 func (x *tupClassification) ForNil(q.Nil) {}
@@ -61,10 +86,33 @@ func (x *valClassification) ForVariable(q.Variable) {
 	x.out = variableSubClass
 }
 
+func (x *valClassification) ForPredicate(q.Predicate) {
+	x.out = variableSubClass
+}
+
+func (x *valClassification) ForReference(q.Reference) {
+	x.out = referenceSubClass
+}
+
 func (x *valClassification) ForClear(q.Clear) {
 	x.out = clearSubClass
 }
 
+func (x *valClassification) ForAtomic(e q.Atomic) {
+	// The operand is serialized as is, so it
+	// can't contain variables or references.
+	switch classifyValue(e.Operand) {
+	case constantSubClass:
+	case nilSubClass:
+		x.out = nilSubClass
+		return
+	default:
+		x.out = variableOperandSubClass
+		return
+	}
+	x.out = atomicSubClass
+}
+
 func (x *valClassification) ForNil(q.Nil) {}
 
 func (x *valClassification) ForInt(q.Int) {}
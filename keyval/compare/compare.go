@@ -59,3 +59,19 @@ func Tuples(schema q.Tuple, candidate q.Tuple) []int {
 	}
 	return nil
 }
+
+// Directory checks if the candidate path conforms to the given schema.
+// The path must have the same length as the schema. Each String element
+// of the schema must equal the corresponding element of the path, while
+// Variable elements match any element.
+func Directory(schema q.Directory, candidate []string) bool {
+	if len(schema) != len(candidate) {
+		return false
+	}
+	for i, element := range schema {
+		if str, ok := element.(q.String); ok && string(str) != candidate[i] {
+			return false
+		}
+	}
+	return true
+}
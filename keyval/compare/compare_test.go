@@ -140,4 +140,82 @@ func TestTuples(t *testing.T) {
 		mismatch := Tuples(pattern, candidate)
 		require.Empty(t, mismatch)
 	})
+	t.Run("predicate", func(t *testing.T) {
+		pattern := q.Tuple{
+			q.Predicate{Variable: q.Variable{q.IntType}, Op: q.GreaterEqualOp, Operands: q.Tuple{q.Int(18)}},
+			q.Predicate{Variable: q.Variable{q.StringType}, Op: q.InOp, Operands: q.Tuple{q.String("a"), q.String("b")}},
+		}
+
+		mismatch := Tuples(pattern, q.Tuple{q.Int(21), q.String("b")})
+		require.Empty(t, mismatch)
+
+		mismatch = Tuples(pattern, q.Tuple{q.Int(17), q.String("b")})
+		require.Equal(t, []int{0}, mismatch)
+
+		mismatch = Tuples(pattern, q.Tuple{q.Int(21), q.String("c")})
+		require.Equal(t, []int{1}, mismatch)
+
+		mismatch = Tuples(pattern, q.Tuple{q.Float(21), q.String("b")})
+		require.Equal(t, []int{0}, mismatch)
+	})
+}
+
+func TestDirectory(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    q.Directory
+		candidate []string
+		out       bool
+	}{
+		{name: "empty", schema: q.Directory{}, candidate: nil, out: true},
+		{name: "equal", schema: q.Directory{q.String("a"), q.String("b")}, candidate: []string{"a", "b"}, out: true},
+		{name: "variable", schema: q.Directory{q.String("a"), q.Variable{}}, candidate: []string{"a", "c"}, out: true},
+		{name: "not equal", schema: q.Directory{q.String("a"), q.String("b")}, candidate: []string{"a", "c"}, out: false},
+		{name: "shorter", schema: q.Directory{q.String("a"), q.Variable{}}, candidate: []string{"a"}, out: false},
+		{name: "longer", schema: q.Directory{q.String("a")}, candidate: []string{"a", "b"}, out: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.out, Directory(test.schema, test.candidate))
+		})
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	pred := func(op q.PredicateOp, operands ...q.TupElement) q.Predicate {
+		return q.Predicate{Op: op, Operands: operands}
+	}
+
+	tests := []struct {
+		name      string
+		pred      q.Predicate
+		candidate q.TupElement
+		out       bool
+	}{
+		{name: "equal", pred: pred(q.EqualOp, q.String("a")), candidate: q.String("a"), out: true},
+		{name: "equal numbers", pred: pred(q.EqualOp, q.Int(2)), candidate: q.Float(2), out: true},
+		{name: "equal mismatch", pred: pred(q.EqualOp, q.String("a")), candidate: q.Int(1), out: false},
+		{name: "not equal", pred: pred(q.NotEqualOp, q.Bool(true)), candidate: q.Bool(false), out: true},
+		{name: "not equal mismatch", pred: pred(q.NotEqualOp, q.Bool(true)), candidate: q.Bool(true), out: false},
+		{name: "less", pred: pred(q.LessOp, q.Int(5)), candidate: q.Uint(4), out: true},
+		{name: "less mismatch", pred: pred(q.LessOp, q.Int(5)), candidate: q.Int(5), out: false},
+		{name: "less equal", pred: pred(q.LessEqualOp, q.Int(5)), candidate: q.Int(5), out: true},
+		{name: "greater", pred: pred(q.GreaterOp, q.Float(0.5)), candidate: q.Int(1), out: true},
+		{name: "greater equal", pred: pred(q.GreaterEqualOp, q.String("b")), candidate: q.String("c"), out: true},
+		{name: "greater bytes", pred: pred(q.GreaterOp, q.Bytes{0x01}), candidate: q.Bytes{0x01, 0x00}, out: true},
+		{name: "greater large ints", pred: pred(q.GreaterOp, q.Int(1<<62)), candidate: q.Int(1<<62 + 1), out: true},
+		{name: "unordered", pred: pred(q.GreaterOp, q.Int(1)), candidate: q.String("2"), out: false},
+		{name: "match", pred: pred(q.MatchOp, q.String("^err")), candidate: q.String("error: oops"), out: true},
+		{name: "match mismatch", pred: pred(q.MatchOp, q.String("^err")), candidate: q.String("ok"), out: false},
+		{name: "match not string", pred: pred(q.MatchOp, q.String("1")), candidate: q.Int(1), out: false},
+		{name: "in", pred: pred(q.InOp, q.String("a"), q.Int(1)), candidate: q.Uint(1), out: true},
+		{name: "in mismatch", pred: pred(q.InOp, q.String("a"), q.Int(1)), candidate: q.String("b"), out: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.out, Satisfies(test.pred, test.candidate))
+		})
+	}
 }
@@ -164,6 +164,22 @@ loop:
 	}
 }
 
+func (x *comparison) ForPredicate(e q.Predicate) {
+	x.ForVariable(e.Variable)
+	if x.out != nil {
+		return
+	}
+	if !Satisfies(e, x.candidate) {
+		x.out = []int{x.i}
+	}
+}
+
+func (x *comparison) ForReference(_ q.Reference) {
+	// References must be replaced before a
+	// schema is used, so they never match.
+	x.out = []int{x.i}
+}
+
 func (x *comparison) ForMaybeMore(_ q.MaybeMore) {
 	// By the time the visitor is used, the Tuples function
 	// should have removed the trailing MaybeMore. So, any
@@ -0,0 +1,165 @@
+package compare
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+// regexps caches the compiled operands of MatchOp predicates,
+// as the same predicate is checked against many candidates.
+var regexps sync.Map
+
+// Satisfies checks if the candidate satisfies the condition of the given
+// Predicate. The types of the Predicate's Variable aren't checked. Numbers
+// are compared by value regardless of their type, so an Int may be compared
+// with a Float. Strings & Bytes are compared lexicographically. Candidates
+// which can't be ordered relative to the operand never satisfy an ordered
+// comparison. MatchOp only matches String candidates.
+func Satisfies(pred q.Predicate, candidate interface{}) bool {
+	switch pred.Op {
+	case q.EqualOp:
+		return len(pred.Operands) == 1 && equal(pred.Operands[0], candidate)
+
+	case q.NotEqualOp:
+		return len(pred.Operands) == 1 && !equal(pred.Operands[0], candidate)
+
+	case q.InOp:
+		for _, operand := range pred.Operands {
+			if equal(operand, candidate) {
+				return true
+			}
+		}
+		return false
+
+	case q.MatchOp:
+		if len(pred.Operands) != 1 {
+			return false
+		}
+		pattern, ok := pred.Operands[0].(q.String)
+		if !ok {
+			return false
+		}
+		str, ok := candidate.(q.String)
+		if !ok {
+			return false
+		}
+		re, err := compile(string(pattern))
+		if err != nil {
+			return false
+		}
+		return re.MatchString(string(str))
+
+	case q.LessOp, q.LessEqualOp, q.GreaterOp, q.GreaterEqualOp:
+		if len(pred.Operands) != 1 {
+			return false
+		}
+		cmp, ok := order(candidate, pred.Operands[0])
+		if !ok {
+			return false
+		}
+		switch pred.Op {
+		case q.LessOp:
+			return cmp < 0
+		case q.LessEqualOp:
+			return cmp <= 0
+		case q.GreaterOp:
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+
+	default:
+		return false
+	}
+}
+
+// equal returns true if the operand equals the candidate.
+// Numbers are compared by value regardless of their type.
+func equal(operand q.TupElement, candidate interface{}) bool {
+	if cmp, ok := order(candidate, operand); ok {
+		return cmp == 0
+	}
+	return operand.Eq(candidate)
+}
+
+// order compares a & b, returning -1, 0, or 1 if a is less than,
+// equal to, or greater than b. If a & b can't be ordered relative
+// to each other, false is returned.
+func order(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case q.String:
+		if b, ok := b.(q.String); ok {
+			return strings.Compare(string(a), string(b)), true
+		}
+		return 0, false
+
+	case q.Bytes:
+		if b, ok := b.(q.Bytes); ok {
+			return bytes.Compare(a, b), true
+		}
+		return 0, false
+	}
+
+	// Integers of the same type are compared directly
+	// so large values don't lose precision.
+	switch a := a.(type) {
+	case q.Int:
+		if b, ok := b.(q.Int); ok {
+			return orderNumbers(a, b), true
+		}
+	case q.Uint:
+		if b, ok := b.(q.Uint); ok {
+			return orderNumbers(a, b), true
+		}
+	}
+
+	x, ok := toFloat(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := toFloat(b)
+	if !ok {
+		return 0, false
+	}
+	return orderNumbers(x, y), true
+}
+
+func orderNumbers[T q.Int | q.Uint | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case q.Int:
+		return float64(v), true
+	case q.Uint:
+		return float64(v), true
+	case q.Float:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(pattern, re)
+	return re, nil
+}
@@ -59,6 +59,14 @@ func (x *conversion) ForVariable(q.Variable) {
 	x.err = errors.New("cannot convert variable")
 }
 
+func (x *conversion) ForPredicate(q.Predicate) {
+	x.err = errors.New("cannot convert predicate")
+}
+
 func (x *conversion) ForMaybeMore(q.MaybeMore) {
 	x.err = errors.New("cannot convert maybe-more")
 }
+
+func (x *conversion) ForReference(q.Reference) {
+	x.err = errors.New("cannot convert reference")
+}
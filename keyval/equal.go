@@ -123,7 +123,33 @@ func (x Clear) Eq(e interface{}) bool {
 	return ok
 }
 
+func (x Atomic) Eq(e interface{}) bool {
+	v, ok := e.(Atomic)
+	if !ok {
+		return false
+	}
+	if x.Op != v.Op {
+		return false
+	}
+	if x.Operand == nil || v.Operand == nil {
+		return x.Operand == nil && v.Operand == nil
+	}
+	return x.Operand.Eq(v.Operand)
+}
+
 func (x MaybeMore) Eq(e interface{}) bool {
 	_, ok := e.(MaybeMore)
 	return ok
 }
+
+func (x Reference) Eq(e interface{}) bool {
+	return x == e
+}
+
+func (x Predicate) Eq(e interface{}) bool {
+	v, ok := e.(Predicate)
+	if !ok {
+		return false
+	}
+	return x.Op == v.Op && x.Variable.Eq(v.Variable) && x.Operands.Eq(v.Operands)
+}
@@ -98,3 +98,27 @@ func TestClear_Eq(t *testing.T) {
 	assert.True(t, x.Eq(Clear{}))
 	assert.False(t, x.Eq(Bool(false)))
 }
+
+func TestAtomic_Eq(t *testing.T) {
+	x := Atomic{Op: AddOp, Operand: Int(1)}
+	assert.True(t, x.Eq(Atomic{Op: AddOp, Operand: Int(1)}))
+	assert.False(t, x.Eq(Atomic{Op: MaxOp, Operand: Int(1)}))
+	assert.False(t, x.Eq(Atomic{Op: AddOp, Operand: Int(2)}))
+	assert.False(t, x.Eq(Int(1)))
+}
+
+func TestReference_Eq(t *testing.T) {
+	x := Reference("a")
+	assert.True(t, x.Eq(Reference("a")))
+	assert.False(t, x.Eq(Reference("b")))
+	assert.False(t, x.Eq(String("a")))
+}
+
+func TestPredicate_Eq(t *testing.T) {
+	x := Predicate{Variable: Variable{IntType}, Op: GreaterEqualOp, Operands: Tuple{Int(18)}}
+	assert.True(t, x.Eq(Predicate{Variable: Variable{IntType}, Op: GreaterEqualOp, Operands: Tuple{Int(18)}}))
+	assert.False(t, x.Eq(Predicate{Variable: Variable{IntType}, Op: GreaterOp, Operands: Tuple{Int(18)}}))
+	assert.False(t, x.Eq(Predicate{Variable: Variable{UintType}, Op: GreaterEqualOp, Operands: Tuple{Int(18)}}))
+	assert.False(t, x.Eq(Predicate{Variable: Variable{IntType}, Op: GreaterEqualOp, Operands: Tuple{Int(19)}}))
+	assert.False(t, x.Eq(Variable{IntType}))
+}
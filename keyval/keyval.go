@@ -39,9 +39,9 @@ package keyval
 
 // TODO: Add BigInt to Tuple and Value.
 //go:generate go run ./operation -op-name Query     -param-name query      -types Directory,Key,KeyValue
-//go:generate go run ./operation -op-name Directory -param-name DirElement -types String,Variable
-//go:generate go run ./operation -op-name Tuple     -param-name TupElement -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,MaybeMore
-//go:generate go run ./operation -op-name Value     -param-name value      -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,Clear
+//go:generate go run ./operation -op-name Directory -param-name DirElement -types String,Variable,Reference
+//go:generate go run ./operation -op-name Tuple     -param-name TupElement -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,MaybeMore,Reference,Predicate
+//go:generate go run ./operation -op-name Value     -param-name value      -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,Clear,Atomic,Reference,Predicate
 
 type (
 	// Query is an interface implemented by the types which can
@@ -76,8 +76,8 @@ type (
 	// of the "primitive" types.
 	Tuple []TupElement
 
-	// Value may contain Tuple, Variable, Clear, or any
-	// of the "primitive" types.
+	// Value may contain Tuple, Variable, Clear, Atomic, or
+	// any of the "primitive" types.
 	Value = value
 
 	// Variable is a placeholder which implements the DirElement,
@@ -86,6 +86,25 @@ type (
 	// (or directories) matching the schema are returned.
 	Variable []ValueType
 
+	// Predicate is a Variable which only matches the data satisfying
+	// a condition, such as being greater than a number or matching a
+	// regular expression. It implements the TupElement & Value
+	// interfaces. The condition is checked by the client after the
+	// data is read, so it doesn't reduce the amount of data read.
+	Predicate struct {
+		Variable Variable
+		Op       PredicateOp
+		Operands Tuple
+	}
+
+	// Reference is a placeholder which implements the DirElement,
+	// TupElement, & Value interfaces. It refers to a named Variable
+	// of another query. A Query containing a Reference can't be
+	// executed. Instead, it's used as a template whose references
+	// are replaced by the data matched by the named variables (see
+	// package rewrite).
+	Reference string
+
 	// MaybeMore is a special kind of TupElement. It may only
 	// appear as the last element of the Tuple. A Query containing
 	// a MaybeMore defines a schema which allows all keys prefixed
@@ -98,6 +117,16 @@ type (
 	// provided key is cleared from the DB. Clear may
 	// not be used in a query containing Variable.
 	Clear struct{}
+
+	// Atomic is a special kind of Value which designates a
+	// KeyValue as an atomic mutation. When executed, the Op
+	// is applied by the FDB server to the key's current value
+	// using the serialized Operand. The Operand may only be a
+	// Tuple or one of the "primitive" types.
+	Atomic struct {
+		Op      AtomicOp
+		Operand Value
+	}
 )
 
 // These are the "primitive" types.
@@ -211,3 +240,110 @@ func AllTypes() []ValueType {
 		TupleType,
 	}
 }
+
+// AtomicOp defines the mutation performed by an Atomic.
+type AtomicOp string
+
+const (
+	// AddOp adds the Operand to the existing value. Both are
+	// interpreted as little-endian integers.
+	AddOp AtomicOp = "add"
+
+	// BitAndOp performs a bitwise AND of the Operand and the
+	// existing value.
+	BitAndOp AtomicOp = "bit_and"
+
+	// BitOrOp performs a bitwise OR of the Operand and the
+	// existing value.
+	BitOrOp AtomicOp = "bit_or"
+
+	// BitXorOp performs a bitwise XOR of the Operand and the
+	// existing value.
+	BitXorOp AtomicOp = "bit_xor"
+
+	// MinOp stores the lesser of the Operand and the existing
+	// value. Both are interpreted as little-endian integers.
+	MinOp AtomicOp = "min"
+
+	// MaxOp stores the greater of the Operand and the existing
+	// value. Both are interpreted as little-endian integers.
+	MaxOp AtomicOp = "max"
+
+	// ByteMinOp stores the lexicographically lesser of the
+	// Operand and the existing value.
+	ByteMinOp AtomicOp = "byte_min"
+
+	// ByteMaxOp stores the lexicographically greater of the
+	// Operand and the existing value.
+	ByteMaxOp AtomicOp = "byte_max"
+
+	// CompareAndClearOp clears the key if the existing value
+	// is equal to the Operand.
+	CompareAndClearOp AtomicOp = "compare_and_clear"
+
+	// AppendIfFitsOp appends the Operand to the existing value
+	// if the result doesn't exceed the maximum value size.
+	AppendIfFitsOp AtomicOp = "append_if_fits"
+)
+
+// AllAtomicOps returns all valid values for AtomicOp.
+func AllAtomicOps() []AtomicOp {
+	return []AtomicOp{
+		AddOp,
+		BitAndOp,
+		BitOrOp,
+		BitXorOp,
+		MinOp,
+		MaxOp,
+		ByteMinOp,
+		ByteMaxOp,
+		CompareAndClearOp,
+		AppendIfFitsOp,
+	}
+}
+
+// PredicateOp defines the condition checked by a Predicate.
+type PredicateOp string
+
+const (
+	// EqualOp matches data equal to the single Operand.
+	EqualOp PredicateOp = "="
+
+	// NotEqualOp matches data not equal to the single Operand.
+	NotEqualOp PredicateOp = "!="
+
+	// LessOp matches data less than the single Operand.
+	LessOp PredicateOp = "<"
+
+	// LessEqualOp matches data less than or
+	// equal to the single Operand.
+	LessEqualOp PredicateOp = "<="
+
+	// GreaterOp matches data greater than the single Operand.
+	GreaterOp PredicateOp = ">"
+
+	// GreaterEqualOp matches data greater than
+	// or equal to the single Operand.
+	GreaterEqualOp PredicateOp = ">="
+
+	// MatchOp matches strings containing a match of the regular
+	// expression held by the single Operand, which is a String.
+	MatchOp PredicateOp = "~"
+
+	// InOp matches data equal to any of the Operands.
+	InOp PredicateOp = "in"
+)
+
+// AllPredicateOps returns all valid values for PredicateOp.
+func AllPredicateOps() []PredicateOp {
+	return []PredicateOp{
+		EqualOp,
+		NotEqualOp,
+		LessOp,
+		LessEqualOp,
+		GreaterOp,
+		GreaterEqualOp,
+		MatchOp,
+		InOp,
+	}
+}
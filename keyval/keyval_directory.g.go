@@ -1,4 +1,4 @@
-// Code generated by: operation -op-name Directory -param-name DirElement -types String,Variable. DO NOT EDIT.
+// Code generated by: operation -op-name Directory -param-name DirElement -types String,Variable,Reference. DO NOT EDIT.
 
 package keyval
 
@@ -8,6 +8,8 @@ type (
 		ForString(String)
 		// ForVariable performs the DirectoryOperation if the given DirElement is of type Variable.
 		ForVariable(Variable)
+		// ForReference performs the DirectoryOperation if the given DirElement is of type Reference.
+		ForReference(Reference)
 	}
 
 	DirElement interface {
@@ -21,11 +23,13 @@ type (
 
 func _() {
 	var (
-		String   String
-		Variable Variable
+		String    String
+		Variable  Variable
+		Reference Reference
 
 		_ DirElement = &String
 		_ DirElement = &Variable
+		_ DirElement = &Reference
 	)
 }
 
@@ -37,3 +41,7 @@ func (x Variable) DirElement(op DirectoryOperation) {
 	op.ForVariable(x)
 }
 
+func (x Reference) DirElement(op DirectoryOperation) {
+	op.ForReference(x)
+}
+
@@ -1,4 +1,4 @@
-// Code generated by: operation -op-name Tuple -param-name TupElement -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,MaybeMore. DO NOT EDIT.
+// Code generated by: operation -op-name Tuple -param-name TupElement -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,MaybeMore,Reference,Predicate. DO NOT EDIT.
 
 package keyval
 
@@ -26,6 +26,10 @@ type (
 		ForVariable(Variable)
 		// ForMaybeMore performs the TupleOperation if the given TupElement is of type MaybeMore.
 		ForMaybeMore(MaybeMore)
+		// ForReference performs the TupleOperation if the given TupElement is of type Reference.
+		ForReference(Reference)
+		// ForPredicate performs the TupleOperation if the given TupElement is of type Predicate.
+		ForPredicate(Predicate)
 	}
 
 	TupElement interface {
@@ -50,6 +54,8 @@ func _() {
 		Bytes     Bytes
 		Variable  Variable
 		MaybeMore MaybeMore
+		Reference Reference
+		Predicate Predicate
 
 		_ TupElement = &Tuple
 		_ TupElement = &Nil
@@ -62,6 +68,8 @@ func _() {
 		_ TupElement = &Bytes
 		_ TupElement = &Variable
 		_ TupElement = &MaybeMore
+		_ TupElement = &Reference
+		_ TupElement = &Predicate
 	)
 }
 
@@ -109,3 +117,11 @@ func (x MaybeMore) TupElement(op TupleOperation) {
 	op.ForMaybeMore(x)
 }
 
+func (x Reference) TupElement(op TupleOperation) {
+	op.ForReference(x)
+}
+
+func (x Predicate) TupElement(op TupleOperation) {
+	op.ForPredicate(x)
+}
+
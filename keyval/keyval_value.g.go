@@ -1,4 +1,4 @@
-// Code generated by: operation -op-name Value -param-name value -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,Clear. DO NOT EDIT.
+// Code generated by: operation -op-name Value -param-name value -types Tuple,Nil,Int,Uint,Bool,Float,String,UUID,Bytes,Variable,Clear,Atomic,Reference,Predicate. DO NOT EDIT.
 
 package keyval
 
@@ -26,6 +26,12 @@ type (
 		ForVariable(Variable)
 		// ForClear performs the ValueOperation if the given value is of type Clear.
 		ForClear(Clear)
+		// ForAtomic performs the ValueOperation if the given value is of type Atomic.
+		ForAtomic(Atomic)
+		// ForReference performs the ValueOperation if the given value is of type Reference.
+		ForReference(Reference)
+		// ForPredicate performs the ValueOperation if the given value is of type Predicate.
+		ForPredicate(Predicate)
 	}
 
 	value interface {
@@ -39,17 +45,20 @@ type (
 
 func _() {
 	var (
-		Tuple    Tuple
-		Nil      Nil
-		Int      Int
-		Uint     Uint
-		Bool     Bool
-		Float    Float
-		String   String
-		UUID     UUID
-		Bytes    Bytes
-		Variable Variable
-		Clear    Clear
+		Tuple     Tuple
+		Nil       Nil
+		Int       Int
+		Uint      Uint
+		Bool      Bool
+		Float     Float
+		String    String
+		UUID      UUID
+		Bytes     Bytes
+		Variable  Variable
+		Clear     Clear
+		Atomic    Atomic
+		Reference Reference
+		Predicate Predicate
 
 		_ value = &Tuple
 		_ value = &Nil
@@ -62,6 +71,9 @@ func _() {
 		_ value = &Bytes
 		_ value = &Variable
 		_ value = &Clear
+		_ value = &Atomic
+		_ value = &Reference
+		_ value = &Predicate
 	)
 }
 
@@ -109,3 +121,15 @@ func (x Clear) Value(op ValueOperation) {
 	op.ForClear(x)
 }
 
+func (x Atomic) Value(op ValueOperation) {
+	op.ForAtomic(x)
+}
+
+func (x Reference) Value(op ValueOperation) {
+	op.ForReference(x)
+}
+
+func (x Predicate) Value(op ValueOperation) {
+	op.ForPredicate(x)
+}
+
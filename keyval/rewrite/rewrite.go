@@ -0,0 +1,419 @@
+// Package rewrite maps the key-values read by one query onto the template of another.
+package rewrite
+
+import (
+	"github.com/pkg/errors"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+// Bindings maps the names of variables to the data they matched.
+// Data matched by a directory variable is always a [q.String].
+type Bindings map[string]q.TupElement
+
+// Bind returns the data within the key-value which was matched by the named
+// variables of the query. The key-value must conform to the query's schema.
+// The names hold the name of each of the query's variables in the order they
+// appear, as returned by parser.Parser.Names. Unnamed variables have an
+// empty name and aren't included in the returned Bindings.
+func Bind(query q.KeyValue, names []string, kv q.KeyValue) (Bindings, error) {
+	b := binder{names: names, out: make(Bindings)}
+
+	if len(query.Key.Directory) != len(kv.Key.Directory) {
+		return nil, errors.Errorf("directory length %d doesn't match the query's length %d", len(kv.Key.Directory), len(query.Key.Directory))
+	}
+	for i, element := range query.Key.Directory {
+		if _, ok := element.(q.Variable); !ok {
+			continue
+		}
+		str, ok := kv.Key.Directory[i].(q.String)
+		if !ok {
+			return nil, errors.Errorf("directory element %d is a %T, not a string", i, kv.Key.Directory[i])
+		}
+		if err := b.bind(str); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.bindTuple(query.Key.Tuple, kv.Key.Tuple); err != nil {
+		return nil, errors.Wrap(err, "failed to bind key")
+	}
+
+	switch val := query.Value.(type) {
+	case q.Variable, q.Predicate:
+		data, ok := kv.Value.(q.TupElement)
+		if !ok {
+			return nil, errors.Errorf("value is a %T, not data", kv.Value)
+		}
+		if err := b.bind(data); err != nil {
+			return nil, err
+		}
+
+	case q.Tuple:
+		tup, ok := kv.Value.(q.Tuple)
+		if !ok {
+			return nil, errors.Errorf("value is a %T, not a tuple", kv.Value)
+		}
+		if err := b.bindTuple(val, tup); err != nil {
+			return nil, errors.Wrap(err, "failed to bind value")
+		}
+	}
+
+	if b.i != len(names) {
+		return nil, errors.Errorf("query has %d variables but %d names were given", b.i, len(names))
+	}
+	return b.out, nil
+}
+
+// Check returns an error if the template contains a Reference which
+// doesn't refer to any of the given names.
+func Check(template q.KeyValue, names []string) error {
+	defined := make(map[string]bool)
+	for _, name := range names {
+		if name != "" {
+			defined[name] = true
+		}
+	}
+	for _, ref := range references(template) {
+		if !defined[string(ref)] {
+			return errors.Errorf("reference ':%s' doesn't refer to a named variable", ref)
+		}
+	}
+	return nil
+}
+
+// Apply returns a copy of the template with each Reference replaced
+// by the bound data. The template isn't modified. A Reference within
+// the directory must be bound to a [q.String].
+func Apply(template q.KeyValue, bindings Bindings) (q.KeyValue, error) {
+	var out q.KeyValue
+
+	for i, element := range template.Key.Directory {
+		ref, ok := element.(q.Reference)
+		if !ok {
+			out.Key.Directory = append(out.Key.Directory, element)
+			continue
+		}
+		data, err := bindings.get(ref)
+		if err != nil {
+			return q.KeyValue{}, err
+		}
+		str, ok := data.(q.String)
+		if !ok {
+			return q.KeyValue{}, errors.Errorf("directory element %d references ':%s' which is a %T, not a string", i, ref, data)
+		}
+		out.Key.Directory = append(out.Key.Directory, str)
+	}
+
+	tup, err := bindings.applyTuple(template.Key.Tuple)
+	if err != nil {
+		return q.KeyValue{}, errors.Wrap(err, "failed to apply key")
+	}
+	out.Key.Tuple = tup
+
+	switch val := template.Value.(type) {
+	case q.Reference:
+		data, err := bindings.get(val)
+		if err != nil {
+			return q.KeyValue{}, err
+		}
+		value, ok := data.(q.Value)
+		if !ok {
+			return q.KeyValue{}, errors.Errorf("value references ':%s' which is a %T, not a value", val, data)
+		}
+		out.Value = value
+
+	case q.Tuple:
+		tup, err := bindings.applyTuple(val)
+		if err != nil {
+			return q.KeyValue{}, errors.Wrap(err, "failed to apply value")
+		}
+		out.Value = tup
+
+	default:
+		out.Value = val
+	}
+
+	return out, nil
+}
+
+// Schema returns a copy of the template with each Reference replaced
+// by an empty Variable. The returned query matches every key-value
+// which the template could produce. The template isn't modified.
+func Schema(template q.KeyValue) q.KeyValue {
+	// Without bindings, Partial can't fail.
+	out, _ := Partial(template, nil)
+	return out
+}
+
+// Partial returns a copy of the template with each bound Reference
+// replaced by its data and each unbound Reference replaced by an
+// empty Variable. The returned query matches every key-value which
+// the template could produce given the bindings. The template isn't
+// modified. A Reference within the directory must be bound to a
+// [q.String].
+func Partial(template q.KeyValue, bindings Bindings) (q.KeyValue, error) {
+	var out q.KeyValue
+	for i, element := range template.Key.Directory {
+		if ref, ok := element.(q.Reference); ok {
+			element = q.Variable{}
+			if data, ok := bindings[string(ref)]; ok {
+				str, ok := data.(q.String)
+				if !ok {
+					return q.KeyValue{}, errors.Errorf("directory element %d references ':%s' which is a %T, not a string", i, ref, data)
+				}
+				element = str
+			}
+		}
+		out.Key.Directory = append(out.Key.Directory, element)
+	}
+
+	out.Key.Tuple = bindings.partialTuple(template.Key.Tuple)
+
+	switch val := template.Value.(type) {
+	case q.Reference:
+		out.Value = q.Variable{}
+		if data, ok := bindings[string(val)]; ok {
+			if value, ok := data.(q.Value); ok {
+				out.Value = value
+			}
+		}
+	case q.Tuple:
+		out.Value = bindings.partialTuple(val)
+	default:
+		out.Value = val
+	}
+	return out, nil
+}
+
+// Invert returns a query matching the key-values produced by the template,
+// along with the names of the query's variables as expected by [Bind]. When
+// a key-value produced by the template is bound using the returned query,
+// the data of each Reference within the template's key is recovered. The
+// data referenced by the template's value isn't recovered.
+func Invert(template q.KeyValue) (q.KeyValue, []string) {
+	key := q.KeyValue{Key: template.Key}
+
+	var names []string
+	for _, ref := range references(key) {
+		names = append(names, string(ref))
+	}
+
+	query := Schema(key)
+	query.Value = q.Variable{}
+	return query, append(names, "")
+}
+
+// Template returns a copy of the query with each named variable
+// replaced by a Reference to its name. Unnamed variables are left
+// in place. The names hold the name of each of the query's variables
+// in the order they appear, as returned by parser.Parser.Names.
+func Template(query q.KeyValue, names []string) (q.KeyValue, error) {
+	t := templater{names: names}
+
+	var out q.KeyValue
+	for _, element := range query.Key.Directory {
+		if _, ok := element.(q.Variable); ok {
+			if ref, ok := t.next(); ok {
+				element = ref
+			}
+		}
+		out.Key.Directory = append(out.Key.Directory, element)
+	}
+
+	out.Key.Tuple = t.tuple(query.Key.Tuple)
+
+	switch val := query.Value.(type) {
+	case q.Variable, q.Predicate:
+		out.Value = val
+		if ref, ok := t.next(); ok {
+			out.Value = ref
+		}
+	case q.Tuple:
+		out.Value = t.tuple(val)
+	default:
+		out.Value = val
+	}
+
+	if t.i != len(names) {
+		return q.KeyValue{}, errors.Errorf("query has %d variables but %d names were given", t.i, len(names))
+	}
+	return out, nil
+}
+
+func (x Bindings) partialTuple(tup q.Tuple) q.Tuple {
+	if tup == nil {
+		return nil
+	}
+	out := make(q.Tuple, 0, len(tup))
+	for _, element := range tup {
+		switch element := element.(type) {
+		case q.Reference:
+			if data, ok := x[string(element)]; ok {
+				out = append(out, data)
+			} else {
+				out = append(out, q.Variable{})
+			}
+		case q.Tuple:
+			out = append(out, x.partialTuple(element))
+		default:
+			out = append(out, element)
+		}
+	}
+	return out
+}
+
+// templater replaces the named variables of a query with
+// references. Like binder, the variables are visited in the
+// same order as parser.Parser names them.
+type templater struct {
+	names []string
+	i     int
+}
+
+// next returns a Reference to the name of the next variable.
+// If the variable is unnamed, false is returned.
+func (x *templater) next() (q.Reference, bool) {
+	var name string
+	if x.i < len(x.names) {
+		name = x.names[x.i]
+	}
+	x.i++
+	return q.Reference(name), name != ""
+}
+
+func (x *templater) tuple(tup q.Tuple) q.Tuple {
+	if tup == nil {
+		return nil
+	}
+	out := make(q.Tuple, 0, len(tup))
+	for _, element := range tup {
+		switch element := element.(type) {
+		case q.Variable, q.Predicate:
+			if ref, ok := x.next(); ok {
+				out = append(out, ref)
+			} else {
+				out = append(out, element)
+			}
+		case q.Tuple:
+			out = append(out, x.tuple(element))
+		default:
+			out = append(out, element)
+		}
+	}
+	return out
+}
+
+// binder accumulates the Bindings of a key-value. The variables
+// are visited in the same order as parser.Parser names them.
+type binder struct {
+	names []string
+	i     int
+	out   Bindings
+}
+
+func (x *binder) bind(data q.TupElement) error {
+	if x.i >= len(x.names) {
+		return errors.Errorf("query has more than the %d variables named", len(x.names))
+	}
+	if name := x.names[x.i]; name != "" {
+		x.out[name] = data
+	}
+	x.i++
+	return nil
+}
+
+func (x *binder) bindTuple(schema q.Tuple, tup q.Tuple) error {
+	for i, element := range schema {
+		switch element := element.(type) {
+		case q.Variable, q.Predicate:
+			if i >= len(tup) {
+				return errors.Errorf("tuple is missing element %d", i)
+			}
+			if err := x.bind(tup[i]); err != nil {
+				return err
+			}
+
+		case q.Tuple:
+			if i >= len(tup) {
+				return errors.Errorf("tuple is missing element %d", i)
+			}
+			sub, ok := tup[i].(q.Tuple)
+			if !ok {
+				return errors.Errorf("element %d is a %T, not a tuple", i, tup[i])
+			}
+			if err := x.bindTuple(element, sub); err != nil {
+				return errors.Wrapf(err, "failed to bind element %d", i)
+			}
+		}
+	}
+	return nil
+}
+
+func (x Bindings) get(ref q.Reference) (q.TupElement, error) {
+	data, ok := x[string(ref)]
+	if !ok {
+		return nil, errors.Errorf("reference ':%s' isn't bound", ref)
+	}
+	return data, nil
+}
+
+func (x Bindings) applyTuple(tup q.Tuple) (q.Tuple, error) {
+	if tup == nil {
+		return nil, nil
+	}
+	out := make(q.Tuple, 0, len(tup))
+	for i, element := range tup {
+		switch element := element.(type) {
+		case q.Reference:
+			data, err := x.get(element)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data)
+
+		case q.Tuple:
+			sub, err := x.applyTuple(element)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to apply element %d", i)
+			}
+			out = append(out, sub)
+
+		default:
+			out = append(out, element)
+		}
+	}
+	return out, nil
+}
+
+// references returns every Reference within the
+// template in the order they appear.
+func references(template q.KeyValue) []q.Reference {
+	var out []q.Reference
+	for _, element := range template.Key.Directory {
+		if ref, ok := element.(q.Reference); ok {
+			out = append(out, ref)
+		}
+	}
+
+	var fromTuple func(q.Tuple)
+	fromTuple = func(tup q.Tuple) {
+		for _, element := range tup {
+			switch element := element.(type) {
+			case q.Reference:
+				out = append(out, element)
+			case q.Tuple:
+				fromTuple(element)
+			}
+		}
+	}
+	fromTuple(template.Key.Tuple)
+
+	switch val := template.Value.(type) {
+	case q.Reference:
+		out = append(out, val)
+	case q.Tuple:
+		fromTuple(val)
+	}
+	return out
+}
@@ -0,0 +1,257 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	q "github.com/janderland/fdbq/keyval"
+)
+
+func TestRewrite(t *testing.T) {
+	query := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("old"), q.Variable{}},
+			Tuple:     q.Tuple{q.Variable{q.IntType}, q.Tuple{q.Variable{q.StringType}, q.Variable{}}, q.MaybeMore{}},
+		},
+		Value: q.Variable{},
+	}
+	names := []string{"t", "a", "b", "", "v"}
+
+	kv := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("old"), q.String("acme")},
+			Tuple:     q.Tuple{q.Int(1), q.Tuple{q.String("x"), q.Nil{}}, q.Float(2.5)},
+		},
+		Value: q.Bytes{0xff},
+	}
+
+	bindings, err := Bind(query, names, kv)
+	require.NoError(t, err)
+	require.Equal(t, Bindings{
+		"t": q.String("acme"),
+		"a": q.Int(1),
+		"b": q.String("x"),
+		"v": q.Bytes{0xff},
+	}, bindings)
+
+	tests := []struct {
+		name     string
+		template q.KeyValue
+		expected q.KeyValue
+		err      bool
+	}{
+		{
+			name: "swap",
+			template: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("new"), q.Reference("t")},
+					Tuple:     q.Tuple{q.Reference("b"), q.Tuple{q.Reference("a")}},
+				},
+				Value: q.Reference("v"),
+			},
+			expected: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("new"), q.String("acme")},
+					Tuple:     q.Tuple{q.String("x"), q.Tuple{q.Int(1)}},
+				},
+				Value: q.Bytes{0xff},
+			},
+		},
+		{
+			name: "value tuple",
+			template: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("new")},
+					Tuple:     q.Tuple{q.Reference("b")},
+				},
+				Value: q.Tuple{q.Reference("a"), q.Reference("t")},
+			},
+			expected: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("new")},
+					Tuple:     q.Tuple{q.String("x")},
+				},
+				Value: q.Tuple{q.Int(1), q.String("acme")},
+			},
+		},
+		{
+			name: "directory not string",
+			template: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.Reference("a")}, Tuple: q.Tuple{}},
+				Value: q.Nil{},
+			},
+			err: true,
+		},
+		{
+			name: "unbound",
+			template: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("new")}, Tuple: q.Tuple{q.Reference("c")}},
+				Value: q.Nil{},
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Apply(test.template, bindings)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestBind_Errors(t *testing.T) {
+	query := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("old")},
+			Tuple:     q.Tuple{q.Variable{}, q.Tuple{q.Variable{}}},
+		},
+		Value: q.Variable{},
+	}
+	kv := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("old")},
+			Tuple:     q.Tuple{q.Int(1), q.Tuple{q.Int(2)}},
+		},
+		Value: q.Nil{},
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		kv    q.KeyValue
+	}{
+		{name: "too few names", names: []string{"a", "b"}, kv: kv},
+		{name: "too many names", names: []string{"a", "b", "c", "d"}, kv: kv},
+		{
+			name:  "not a tuple",
+			names: []string{"a", "b", "c"},
+			kv: q.KeyValue{
+				Key:   q.Key{Directory: kv.Key.Directory, Tuple: q.Tuple{q.Int(1), q.Int(2)}},
+				Value: kv.Value,
+			},
+		},
+		{
+			name:  "directory length",
+			names: []string{"a", "b", "c"},
+			kv: q.KeyValue{
+				Key:   q.Key{Directory: q.Directory{q.String("old"), q.String("x")}, Tuple: kv.Key.Tuple},
+				Value: kv.Value,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Bind(query, test.names, test.kv)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	template := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("new"), q.Reference("t")},
+			Tuple:     q.Tuple{q.Tuple{q.Reference("a")}},
+		},
+		Value: q.Tuple{q.Reference("v")},
+	}
+
+	require.NoError(t, Check(template, []string{"t", "", "a", "v"}))
+	require.Error(t, Check(template, []string{"t", "a"}))
+	require.Error(t, Check(template, []string{"a", "v"}))
+}
+
+func TestSchema(t *testing.T) {
+	template := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("index"), q.Reference("t")},
+			Tuple:     q.Tuple{q.Reference("a"), q.Tuple{q.Reference("b"), q.Int(1)}},
+		},
+		Value: q.Reference("v"),
+	}
+	require.Equal(t, q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("index"), q.Variable{}},
+			Tuple:     q.Tuple{q.Variable{}, q.Tuple{q.Variable{}, q.Int(1)}},
+		},
+		Value: q.Variable{},
+	}, Schema(template))
+
+	template.Value = q.Nil{}
+	require.Equal(t, q.Nil{}, Schema(template).Value)
+}
+
+func TestPartial(t *testing.T) {
+	template := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("index"), q.Reference("t")},
+			Tuple:     q.Tuple{q.Reference("a"), q.Tuple{q.Reference("b")}},
+		},
+		Value: q.Reference("v"),
+	}
+
+	out, err := Partial(template, Bindings{"t": q.String("x"), "b": q.Int(2)})
+	require.NoError(t, err)
+	require.Equal(t, q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("index"), q.String("x")},
+			Tuple:     q.Tuple{q.Variable{}, q.Tuple{q.Int(2)}},
+		},
+		Value: q.Variable{},
+	}, out)
+
+	_, err = Partial(template, Bindings{"t": q.Int(1)})
+	require.Error(t, err)
+}
+
+func TestInvert(t *testing.T) {
+	template := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("index"), q.Reference("t")},
+			Tuple:     q.Tuple{q.Reference("a"), q.Tuple{q.Reference("b")}, q.Int(1)},
+		},
+		Value: q.Reference("v"),
+	}
+	bindings := Bindings{"t": q.String("x"), "a": q.Int(2), "b": q.String("y"), "v": q.Float(3)}
+
+	kv, err := Apply(template, bindings)
+	require.NoError(t, err)
+
+	query, names := Invert(template)
+	actual, err := Bind(query, names, kv)
+	require.NoError(t, err)
+
+	delete(bindings, "v")
+	require.Equal(t, bindings, actual)
+}
+
+func TestTemplate(t *testing.T) {
+	query := q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("people"), q.Variable{}},
+			Tuple:     q.Tuple{q.Variable{q.IntType}, q.Tuple{q.Variable{}}, q.MaybeMore{}},
+		},
+		Value: q.Variable{},
+	}
+
+	out, err := Template(query, []string{"dir", "", "sub", "val"})
+	require.NoError(t, err)
+	require.Equal(t, q.KeyValue{
+		Key: q.Key{
+			Directory: q.Directory{q.String("people"), q.Reference("dir")},
+			Tuple:     q.Tuple{q.Variable{q.IntType}, q.Tuple{q.Reference("sub")}, q.MaybeMore{}},
+		},
+		Value: q.Reference("val"),
+	}, out)
+
+	_, err = Template(query, []string{"dir"})
+	require.Error(t, err)
+}
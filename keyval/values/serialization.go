@@ -67,6 +67,18 @@ func (x *serialization) ForVariable(_ q.Variable) {
 	x.err = errors.New("cannot serialize a variable")
 }
 
+func (x *serialization) ForPredicate(_ q.Predicate) {
+	x.err = errors.New("cannot serialize a predicate")
+}
+
 func (x *serialization) ForClear(_ q.Clear) {
 	x.err = errors.New("cannot serialize a clear")
 }
+
+func (x *serialization) ForAtomic(_ q.Atomic) {
+	x.err = errors.New("cannot serialize an atomic")
+}
+
+func (x *serialization) ForReference(_ q.Reference) {
+	x.err = errors.New("cannot serialize a reference")
+}
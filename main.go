@@ -4,20 +4,65 @@ fdbq is a query language for Foundation DB
 Usage:
 
 	fdbq [flags] query ...
+	fdbq [flags] dir [command]
+
+Commands:
+
+	dir create [--layer string] directory    create a directory
+	dir move old-directory new-directory     move a directory and its subdirectories
+	dir remove directory                     remove a directory, its subdirectories, and all their contents
+	dir list directory                       list the directories matching a directory query
+	import [--format string] [--schema string] [--header] [--dry-run] file
+	                                         write the key-values read from a file
+	export [-o file] [--layers] [--raw-keys] [--long-scan] directory
+	                                         write the key-values of a directory subtree to a file
+	restore file                             write the directories and key-values of an export file
+	diff [--file string] [--long-scan] query [query]
+	                                         print the differences between the key-values of two range-reads
+	rewrite [--clear] [--dry-run] [--long-scan] source target
+	                                         write a target key-value for each key-value read by a source range-read
+	undo [--dry-run] journal                 restore the keys recorded in a journal to their prior values
+	reindex [--clear] [--long-scan] name     write the entries of a secondary index for its existing key-values
 
 Flags:
 
-	-b, --bytes               print full byte strings instead of just their length
-	-c, --cluster string      path to cluster file
-	-h, --help                help for fdbq
-	    --limit int           limit the number of KVs read in range-reads
-	-l, --little              encode/decode values as little endian instead of big endian
-	    --log                 enable debug logging
-	    --log-file string     logging file when in fullscreen (default "log.txt")
-	-q, --query stringArray   execute query non-interactively
-	-r, --reverse             query range-reads in reverse order
-	-s, --strict              throw an error if a KV is read which doesn't match the schema
-	-w, --write               allow write queries
+	    --audit                      print the KVs which don't match the schema of range-reads & why when non-interactive
+	    --batch-size int             number of KVs requested at a time by range-reads
+	    --bulk                       execute set queries in batched transactions instead of a single transaction
+	-b, --bytes                      print full byte strings instead of just their length
+	-c, --cluster string             path to cluster file
+	    --count                      print the number of KVs matched by range-reads instead of the KVs when non-interactive
+	    --cursor string              continue a paginated range-read after the KV identified by the given cursor when non-interactive
+	    --distinct int               only read the first KV of each group of keys sharing their first N tuple elements in range-reads
+	    --dry-run                    print the writes of write queries instead of committing them
+	    --explain                    print how each query would be executed instead of executing it when non-interactive
+	    --group-by int               print the number of KVs & value bytes of each group of keys sharing their first N tuple elements in range-reads
+	-h, --help                       help for fdbq
+	    --indexes string             file defining the secondary indexes maintained by write queries
+	    --journal string             append the prior value of each key changed by set & clear queries to the given file
+	    --limit int                  limit the number of KVs read from each directory in range-reads
+	-l, --little                     encode/decode values as little endian instead of big endian
+	    --log                        enable debug logging
+	    --log-file string            logging file when in fullscreen (default "log.txt")
+	    --long-scan                  allow range-reads to span multiple transactions, giving up consistency
+	    --max-retry-delay duration   max backoff between transaction retries
+	    --paginate                   limit the total number of KVs read by a range-read & print a cursor to the next page when non-interactive
+	    --priority string            transaction priority, either 'batch' or 'system'
+	-q, --query stringArray          execute query non-interactively
+	    --range-clear                allow clear queries containing variables when non-interactive
+	    --read-version int           perform reads at the given version instead of the latest version
+	    --retry-limit int            max number of retries for each transaction
+	-r, --reverse                    query range-reads in reverse order
+	    --select strings             print the data bound to the given named variables instead of the KVs when non-interactive
+	    --select-format string       format of the data printed by --select: tsv or json (default "tsv")
+	    --show-version               print the read & commit versions when non-interactive
+	    --snapshot                   perform snapshot reads which don't cause transaction conflicts
+	    --size-limit int             max number of bytes each transaction may write
+	    --streaming-mode string      streaming mode of range-reads: want_all, iterator, exact, small, medium, large, or serial (default "iterator")
+	-s, --strict                     throw an error if a KV is read which doesn't match the schema
+	    --timeout duration           max duration of each transaction, including retries
+	    --watch                      watch single-read queries and print their key-value each time it changes
+	-w, --write                      allow write queries
 */
 package main
 
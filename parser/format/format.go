@@ -114,6 +114,28 @@ func (x *Format) Variable(in keyval.Variable) {
 	x.builder.WriteRune(internal.VarEnd)
 }
 
+// Predicate formats the given keyval.Predicate
+// and appends it to the internal buffer.
+func (x *Format) Predicate(in keyval.Predicate) {
+	x.builder.WriteRune(internal.VarStart)
+	for i, vType := range in.Variable {
+		if i != 0 {
+			x.builder.WriteRune(internal.VarSep)
+		}
+		x.builder.WriteString(string(vType))
+	}
+	x.builder.WriteRune(internal.VarRef)
+	x.builder.WriteString(string(in.Op))
+	if in.Op == keyval.InOp {
+		x.Tuple(in.Operands)
+	} else {
+		for _, operand := range in.Operands {
+			operand.TupElement(&formatData{x})
+		}
+	}
+	x.builder.WriteRune(internal.VarEnd)
+}
+
 // Bytes formats the given keyval.Bytes
 // and appends it to the internal buffer.
 func (x *Format) Bytes(in keyval.Bytes) {
@@ -188,12 +210,28 @@ func (x *Format) Clear(_ keyval.Clear) {
 	x.builder.WriteString(internal.Clear)
 }
 
+// Atomic formats the given keyval.Atomic
+// and appends it to the internal buffer.
+func (x *Format) Atomic(in keyval.Atomic) {
+	x.builder.WriteString(string(in.Op))
+	x.builder.WriteRune(internal.TupStart)
+	x.Value(in.Operand)
+	x.builder.WriteRune(internal.TupEnd)
+}
+
 // MaybeMore formats the given keyval.MaybeMore
 // and appends it to the internal buffer.
 func (x *Format) MaybeMore(_ keyval.MaybeMore) {
 	x.builder.WriteString(internal.MaybeMore)
 }
 
+// Reference formats the given keyval.Reference
+// and appends it to the internal buffer.
+func (x *Format) Reference(in keyval.Reference) {
+	x.builder.WriteRune(internal.VarRef)
+	x.builder.WriteString(string(in))
+}
+
 func escapeString(in string) string {
 	out := strings.ReplaceAll(in, "\\", "\\\\")
 	out = strings.ReplaceAll(out, "\"", "\\\"")
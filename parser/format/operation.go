@@ -39,6 +39,10 @@ func (x *formatDirElement) ForVariable(in q.Variable) {
 	x.format.Variable(in)
 }
 
+func (x *formatDirElement) ForReference(in q.Reference) {
+	x.format.Reference(in)
+}
+
 // formatQuery is a keyval.QueryOperation which calls the
 // appropriate Format method for the given keyval.Query.
 type formatQuery struct {
@@ -75,6 +79,10 @@ func (x *formatData) ForVariable(in q.Variable) {
 	x.format.Variable(in)
 }
 
+func (x *formatData) ForPredicate(in q.Predicate) {
+	x.format.Predicate(in)
+}
+
 func (x *formatData) ForString(in q.String) {
 	x.format.Str(in)
 }
@@ -87,6 +95,10 @@ func (x *formatData) ForMaybeMore(in q.MaybeMore) {
 	x.format.MaybeMore(in)
 }
 
+func (x *formatData) ForReference(in q.Reference) {
+	x.format.Reference(in)
+}
+
 func (x *formatData) ForTuple(in q.Tuple) {
 	x.format.Tuple(in)
 }
@@ -118,3 +130,7 @@ func (x *formatData) ForBytes(in q.Bytes) {
 func (x *formatData) ForClear(in q.Clear) {
 	x.format.Clear(in)
 }
+
+func (x *formatData) ForAtomic(in q.Atomic) {
+	x.format.Atomic(in)
+}
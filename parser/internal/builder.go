@@ -24,6 +24,11 @@ func (x *KeyValBuilder) AppendVarToDirectory() {
 	x.kv.Key.Directory = append(x.kv.Key.Directory, keyval.Variable{})
 }
 
+// AppendRefToDirectory appends a keyval.Reference to the end of the directory.
+func (x *KeyValBuilder) AppendRefToDirectory(name string) {
+	x.kv.Key.Directory = append(x.kv.Key.Directory, keyval.Reference(name))
+}
+
 // AppendPartToDirectory appends a keyval.String to the end of the directory.
 func (x *KeyValBuilder) AppendPartToDirectory(token string) {
 	x.kv.Key.Directory = append(x.kv.Key.Directory, keyval.String(token))
@@ -54,6 +59,18 @@ func (x *KeyValBuilder) AppendToValueVar(typ keyval.ValueType) error {
 	return nil
 }
 
+// SetValuePred replaces the keyval.Variable assigned as the value with a
+// keyval.Predicate which constrains the variable using the given operator
+// and operands. If the value is not a keyval.Variable, an error is returned.
+func (x *KeyValBuilder) SetValuePred(op keyval.PredicateOp, operands keyval.Tuple) error {
+	val, ok := x.kv.Value.(keyval.Variable)
+	if !ok {
+		return errors.Errorf("expected value to be variable, actually is %T", x.kv.Value)
+	}
+	x.kv.Value = keyval.Predicate{Variable: val, Op: op, Operands: operands}
+	return nil
+}
+
 // AppendToValueStr appends the given string to the keyval.String assigned
 // as the value. If the value is not a keyval.String then this method panics.
 func (x *KeyValBuilder) AppendToValueStr(token string) error {
@@ -75,6 +92,21 @@ func (x *KeyValBuilder) SetValue(val keyval.Value) {
 	x.kv.Value = val
 }
 
+// SetAtomicValue sets the value portion of the keyval.KeyValue to a
+// keyval.Atomic. The given tuple contains the parsed operand and must
+// have exactly one element which is also a keyval.Value.
+func (x *KeyValBuilder) SetAtomicValue(op keyval.AtomicOp, operand keyval.Tuple) error {
+	if len(operand) != 1 {
+		return errors.Errorf("expected 1 operand, actually have %d", len(operand))
+	}
+	val, ok := operand[0].(keyval.Value)
+	if !ok {
+		return errors.Errorf("expected operand to be a value, actually is %T", operand[0])
+	}
+	x.kv.Value = keyval.Atomic{Op: op, Operand: val}
+	return nil
+}
+
 // TupBuilder is used by parser.Parser to construct tuples.
 // parser.Parser doesn't interact with keyval.Tuple directly,
 // so these methods outline all the key-value state changes
@@ -149,6 +181,22 @@ func (x *TupBuilder) AppendToLastElemVar(typ keyval.ValueType) error {
 	})
 }
 
+// SetLastElemPred replaces the keyval.Variable assigned as the last element
+// of the currently constructed tuple with a keyval.Predicate which constrains
+// the variable using the given operator and operands. If the last element is
+// not a keyval.Variable, an error is returned.
+func (x *TupBuilder) SetLastElemPred(op keyval.PredicateOp, operands keyval.Tuple) error {
+	return x.mutateTuple(func(tup keyval.Tuple) (keyval.Tuple, error) {
+		i := len(tup) - 1
+		v, ok := tup[i].(keyval.Variable)
+		if !ok {
+			return nil, errors.Errorf("expected element %d to be variable, actually is %T", i, tup[i])
+		}
+		tup[i] = keyval.Predicate{Variable: v, Op: op, Operands: operands}
+		return tup, nil
+	})
+}
+
 // TODO: Don't assign tuple into parent until EndTuple is called.
 func (x *TupBuilder) mutateTuple(f func(keyval.Tuple) (keyval.Tuple, error)) error {
 	tuples := []keyval.Tuple{x.root}
@@ -22,6 +22,7 @@ const (
 	VarStart  = '<'
 	VarSep    = '|'
 	VarEnd    = '>'
+	VarRef    = ':'
 	StrMark   = '"'
 
 	// While the following aren't currently used by
@@ -37,7 +38,6 @@ const (
 	CurlyEnd    = '}'
 	Star        = '*'
 	Plus        = '+'
-	Colon       = ':'
 	Semicolon   = ';'
 	Question    = '?'
 	At          = '@'
@@ -58,6 +58,7 @@ func AllSingleRuneTokens() string {
 		VarStart,
 		VarSep,
 		VarEnd,
+		VarRef,
 		StrMark,
 	})
 }
@@ -83,4 +84,8 @@ const (
 
 	// MaybeMore token string.
 	MaybeMore = "..."
+
+	// In token string, the set membership
+	// operator of a predicate.
+	In = "in"
 )
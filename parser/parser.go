@@ -4,12 +4,14 @@ package parser
 import (
 	"encoding/hex"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/janderland/fdbq/keyval"
+	"github.com/janderland/fdbq/keyval/class"
 	"github.com/janderland/fdbq/parser/internal"
 	"github.com/janderland/fdbq/parser/scanner"
 )
@@ -21,13 +23,20 @@ const (
 	stateDirHead
 	stateDirTail
 	stateDirVarEnd
+	stateDirVarName
 	stateTupleHead
 	stateTupleTail
 	stateSeparator
 	stateValue
+	stateAtomic
 	stateString
 	stateVarHead
 	stateVarTail
+	stateVarNameEnd
+	statePredHead
+	statePredOp
+	statePredBody
+	stateReference
 	stateFinished
 )
 
@@ -39,6 +48,14 @@ const (
 	stringStateVal
 )
 
+type refState int
+
+const (
+	refStateDir refState = iota
+	refStateTup
+	refStateVal
+)
+
 func stateName(state state) string {
 	switch state {
 	case stateInitial:
@@ -49,6 +66,8 @@ func stateName(state state) string {
 		return "DirTail"
 	case stateDirVarEnd:
 		return "DirVarEnd"
+	case stateDirVarName:
+		return "DirVarName"
 	case stateTupleHead:
 		return "TupleHead"
 	case stateTupleTail:
@@ -57,12 +76,24 @@ func stateName(state state) string {
 		return "Separator"
 	case stateValue:
 		return "Value"
+	case stateAtomic:
+		return "Atomic"
 	case stateString:
 		return "String"
 	case stateVarHead:
 		return "VarHead"
 	case stateVarTail:
 		return "VarTail"
+	case stateVarNameEnd:
+		return "VarNameEnd"
+	case statePredHead:
+		return "PredHead"
+	case statePredOp:
+		return "PredOp"
+	case statePredBody:
+		return "PredBody"
+	case stateReference:
+		return "Reference"
 	case stateFinished:
 		return "Finished"
 	default:
@@ -90,6 +121,8 @@ func tokenKindName(kind scanner.TokenKind) string {
 		return "VarEnd"
 	case scanner.TokenKindVarSep:
 		return "VarSep"
+	case scanner.TokenKindVarRef:
+		return "VarRef"
 	case scanner.TokenKindStrMark:
 		return "StrMark"
 	case scanner.TokenKindWhitespace:
@@ -155,6 +188,7 @@ type Parser struct {
 	scanner scanner.Scanner
 	tokens  []Token
 	state   state
+	names   []string
 }
 
 func New(s scanner.Scanner) Parser {
@@ -186,23 +220,74 @@ func (x *Parser) Parse() (keyval.Query, error) {
 		// If == 0 then the string is in a tuple.
 		// If > 0 then the string is for a value.
 		stringState stringState
+
+		// TODO: Work into the state machine?
+		// If non-empty, the value tuple being parsed
+		// is the operand of an atomic mutation.
+		atomicOp keyval.AtomicOp
+
+		// TODO: Work into the state machine?
+		// Holds the token most recently read by stateVarHead.
+		// If followed by a TokenKindVarRef, the token is the
+		// variable's name. Otherwise, it's a value type.
+		varToken string
+
+		// TODO: Work into the state machine?
+		// If true, the variable being parsed hasn't been
+		// given a name or a type, so it may be named.
+		varNameable bool
+
+		// TODO: Work into the state machine?
+		// Specifies whether the reference being parsed
+		// is a directory element, tuple element, or value.
+		refState refState
+
+		// TODO: Work into the state machine?
+		// Holds the token most recently used to name a
+		// variable. If the variable is followed by a
+		// predicate, the token is a value type instead.
+		varName string
+
+		// TODO: Work into the state machine?
+		// Hold the operator & the raw operands of the
+		// predicate being parsed. The operands are parsed
+		// once the end of the predicate is found.
+		predOp   string
+		predBody strings.Builder
+
+		// TODO: Work into the state machine?
+		// If true, predBody currently ends within a string.
+		predStr bool
+
+		// If true, the current token is handled again
+		// by the next state instead of scanning a new
+		// token. This allows a state to look ahead.
+		replay bool
+
+		kind  scanner.TokenKind
+		token string
 	)
 
 	for {
-		kind, err := x.scanner.Scan()
-		if err != nil {
-			return nil, err
-		}
+		if replay {
+			replay = false
+		} else {
+			var err error
+			kind, err = x.scanner.Scan()
+			if err != nil {
+				return nil, err
+			}
 
-		// We make sure to add the token to our running
-		// list before handling it below. The withTokens
-		// method assumes the last token added is the
-		// problematic one.
-		token := x.scanner.Token()
-		x.tokens = append(x.tokens, Token{
-			Kind:  kind,
-			Token: token,
-		})
+			// We make sure to add the token to our running
+			// list before handling it below. The withTokens
+			// method assumes the last token added is the
+			// problematic one.
+			token = x.scanner.Token()
+			x.tokens = append(x.tokens, Token{
+				Kind:  kind,
+				Token: token,
+			})
+		}
 
 		switch x.state {
 		// The Parser should be at stateInitial when it begins
@@ -226,6 +311,11 @@ func (x *Parser) Parse() (keyval.Query, error) {
 			case scanner.TokenKindVarStart:
 				x.state = stateDirVarEnd
 				kv.AppendVarToDirectory()
+				x.names = append(x.names, "")
+
+			case scanner.TokenKindVarRef:
+				x.state = stateReference
+				refState = refStateDir
 
 			case scanner.TokenKindStrMark:
 				x.state = stateString
@@ -262,12 +352,34 @@ func (x *Parser) Parse() (keyval.Query, error) {
 
 		// stateDirVarEnd ensures that a TokenKindVarEnd
 		// follows a TokenKindVarStart which was read
-		// during the previous stateDirHead.
+		// during the previous stateDirHead. Directory
+		// variables don't have types, but they may
+		// be named.
 		case stateDirVarEnd:
 			switch kind {
 			case scanner.TokenKindVarEnd:
 				x.state = stateDirTail
 
+			case scanner.TokenKindOther:
+				if x.names[len(x.names)-1] != "" {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+				x.state = stateDirVarName
+				if err := x.setName(token); err != nil {
+					return nil, x.withTokens(err)
+				}
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
+		// stateDirVarName ensures that a TokenKindVarRef
+		// follows the name of a directory variable.
+		case stateDirVarName:
+			switch kind {
+			case scanner.TokenKindVarRef:
+				x.state = stateDirVarEnd
+
 			default:
 				return nil, x.withTokens(x.tokenErr(kind))
 			}
@@ -287,7 +399,9 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				if tup.EndTuple() {
 					if valTup {
 						x.state = stateFinished
-						kv.SetValue(tup.Get())
+						if err := x.setValueTuple(&kv, atomicOp, tup.Get()); err != nil {
+							return nil, x.withTokens(err)
+						}
 						break
 					}
 					x.state = stateSeparator
@@ -297,7 +411,13 @@ func (x *Parser) Parse() (keyval.Query, error) {
 			case scanner.TokenKindVarStart:
 				x.state = stateVarHead
 				valVar = false
+				varNameable = true
 				tup.Append(keyval.Variable{})
+				x.names = append(x.names, "")
+
+			case scanner.TokenKindVarRef:
+				x.state = stateReference
+				refState = refStateTup
 
 			case scanner.TokenKindStrMark:
 				x.state = stateString
@@ -334,7 +454,9 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				if tup.EndTuple() {
 					if valTup {
 						x.state = stateFinished
-						kv.SetValue(tup.Get())
+						if err := x.setValueTuple(&kv, atomicOp, tup.Get()); err != nil {
+							return nil, x.withTokens(err)
+						}
 					} else {
 						x.state = stateSeparator
 						kv.SetKeyTuple(tup.Get())
@@ -379,7 +501,13 @@ func (x *Parser) Parse() (keyval.Query, error) {
 			case scanner.TokenKindVarStart:
 				x.state = stateVarHead
 				valVar = true
+				varNameable = true
 				kv.SetValue(keyval.Variable{})
+				x.names = append(x.names, "")
+
+			case scanner.TokenKindVarRef:
+				x.state = stateReference
+				refState = refStateVal
 
 			case scanner.TokenKindStrMark:
 				x.state = stateString
@@ -387,6 +515,11 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				kv.SetValue(keyval.String(""))
 
 			case scanner.TokenKindOther:
+				if op, ok := parseAtomicOp(token); ok {
+					x.state = stateAtomic
+					atomicOp = op
+					break
+				}
 				x.state = stateFinished
 				if token == internal.Clear {
 					kv.SetValue(keyval.Clear{})
@@ -402,6 +535,20 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				return nil, x.withTokens(x.tokenErr(kind))
 			}
 
+		// stateAtomic ensures that the name of an atomic
+		// mutation is followed by a tuple containing the
+		// mutation's operand.
+		case stateAtomic:
+			switch kind {
+			case scanner.TokenKindTupStart:
+				x.state = stateTupleHead
+				valTup = true
+				tup = internal.TupBuilder{}
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
 		// During stateString, tokens are appended to the
 		// string currently being constructed. The string
 		// being constructed may be a directory element,
@@ -461,53 +608,227 @@ func (x *Parser) Parse() (keyval.Query, error) {
 				}
 			}
 
-		// During stateVarHead, the Parser adds a value type
-		// to the current keyval.Variable which may be in a
-		// tuple or the value.
+		// During stateVarHead, the Parser reads the name or
+		// a value type of the current keyval.Variable which
+		// may be in a tuple or the value. Whether the token
+		// is a name or a value type isn't known until the
+		// following token is read during stateVarTail.
+		//
+		// If the variable was just named, the name may
+		// instead be a value type followed by a predicate,
+		// as in '<int:>=18>'. In this case, the name is
+		// converted into a value type.
 		case stateVarHead:
 			switch kind {
 			case scanner.TokenKindVarEnd:
-				if valVar {
-					x.state = stateFinished
-				} else {
-					x.state = stateTupleTail
+				if varName != "" {
+					x.state = stateVarNameEnd
+					break
 				}
+				x.state = x.varEndState(valVar)
 
-			case scanner.TokenKindOther:
-				x.state = stateVarTail
-				v, err := parseValueType(token)
-				if err != nil {
+			case scanner.TokenKindVarRef:
+				if !varNameable && varName == "" {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+				x.state = statePredHead
+				varNameable = false
+				varName = ""
+
+			case scanner.TokenKindVarStart, scanner.TokenKindKeyValSep, scanner.TokenKindReserved:
+				if varName == "" {
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+				if err := x.unsetName(&kv, &tup, valVar, varName); err != nil {
 					return nil, x.withTokens(err)
 				}
+				x.state = statePredHead
+				varName = ""
+				replay = true
 
-				if valVar {
-					if err := kv.AppendToValueVar(v); err != nil {
-						return nil, x.withTokens(errors.Wrap(err, "failed to append to value variable"))
-					}
-				} else {
-					if err := tup.AppendToLastElemVar(v); err != nil {
-						return nil, x.withTokens(errors.Wrap(err, "failed to append to last tuple element"))
+			case scanner.TokenKindOther:
+				if varName != "" && token == internal.In {
+					if err := x.unsetName(&kv, &tup, valVar, varName); err != nil {
+						return nil, x.withTokens(err)
 					}
+					x.state = statePredHead
+					varName = ""
+					replay = true
+					break
 				}
+				x.state = stateVarTail
+				varToken = token
+				varName = ""
 
 			default:
 				return nil, x.withTokens(x.tokenErr(kind))
 			}
 
-		// During stateVarTail, the Parser either begins
-		// parsing another value type or finishes the
-		// current keyval.Variable.
+		// During stateVarTail, the Parser either names the
+		// current keyval.Variable, begins parsing another
+		// value type, or finishes the current variable.
 		case stateVarTail:
 			switch kind {
+			case scanner.TokenKindVarRef:
+				if !varNameable {
+					x.state = statePredHead
+					if err := x.appendVarType(&kv, &tup, valVar, varToken); err != nil {
+						return nil, x.withTokens(err)
+					}
+					break
+				}
+				x.state = stateVarHead
+				varNameable = false
+				varName = varToken
+				if err := x.setName(varToken); err != nil {
+					return nil, x.withTokens(err)
+				}
+
 			case scanner.TokenKindVarEnd:
-				if valVar {
-					x.state = stateFinished
-				} else {
-					x.state = stateTupleTail
+				x.state = x.varEndState(valVar)
+				if err := x.appendVarType(&kv, &tup, valVar, varToken); err != nil {
+					return nil, x.withTokens(err)
 				}
 
 			case scanner.TokenKindVarSep:
 				x.state = stateVarHead
+				varNameable = false
+				if err := x.appendVarType(&kv, &tup, valVar, varToken); err != nil {
+					return nil, x.withTokens(err)
+				}
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
+		// stateVarNameEnd follows a variable which was named
+		// but given no value types, as in '<x:>'. If the next
+		// token continues a '>' or '>=' predicate, the name is
+		// converted into a value type. Otherwise, the variable
+		// is finished and the token is handled by the next state.
+		case stateVarNameEnd:
+			switch kind {
+			case scanner.TokenKindKeyValSep, scanner.TokenKindOther, scanner.TokenKindStrMark:
+				if err := x.unsetName(&kv, &tup, valVar, varName); err != nil {
+					return nil, x.withTokens(err)
+				}
+				x.state = statePredOp
+				predOp = string(internal.VarEnd)
+				replay = true
+
+			default:
+				x.state = x.varEndState(valVar)
+				replay = true
+			}
+			varName = ""
+
+		// During statePredHead, the Parser reads the operator
+		// of the predicate constraining the current variable.
+		// Operators which may be followed by '=' transition
+		// to statePredOp.
+		case statePredHead:
+			switch kind {
+			case scanner.TokenKindWhitespace:
+				break
+
+			case scanner.TokenKindVarStart, scanner.TokenKindVarEnd:
+				x.state = statePredOp
+				predOp = token
+
+			case scanner.TokenKindKeyValSep:
+				x.state = statePredBody
+				predOp = token
+
+			case scanner.TokenKindReserved:
+				switch token {
+				case string(internal.Exclamation):
+					x.state = statePredOp
+					predOp = token
+
+				case string(internal.Tilde):
+					x.state = statePredBody
+					predOp = token
+
+				default:
+					return nil, x.withTokens(x.tokenErr(kind))
+				}
+
+			case scanner.TokenKindOther:
+				if token != internal.In {
+					return nil, x.withTokens(errors.Errorf("unrecognized predicate operator '%s'", token))
+				}
+				x.state = statePredBody
+				predOp = token
+
+			default:
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+
+		// statePredOp completes operators which may be
+		// followed by a '=', such as '<=' or '!='.
+		case statePredOp:
+			x.state = statePredBody
+			if kind == scanner.TokenKindKeyValSep {
+				predOp += token
+				break
+			}
+			if predOp == string(internal.Exclamation) {
+				return nil, x.withTokens(x.tokenErr(kind))
+			}
+			replay = true
+
+		// During statePredBody, the Parser collects the
+		// operands of the current predicate until the end
+		// of the variable is found. Strings within the
+		// operands may contain any token.
+		case statePredBody:
+			switch {
+			case kind == scanner.TokenKindEnd:
+				return nil, x.withTokens(x.tokenErr(kind))
+
+			case predStr:
+				if kind == scanner.TokenKindStrMark {
+					predStr = false
+				}
+				predBody.WriteString(token)
+
+			case kind == scanner.TokenKindStrMark:
+				predStr = true
+				predBody.WriteString(token)
+
+			case kind == scanner.TokenKindVarEnd:
+				x.state = x.varEndState(valVar)
+				if err := x.setPredicate(&kv, &tup, valVar, predOp, predBody.String()); err != nil {
+					return nil, x.withTokens(err)
+				}
+				predBody.Reset()
+
+			default:
+				predBody.WriteString(token)
+			}
+
+		// During stateReference, the Parser reads the name
+		// of a keyval.Reference which may be a directory
+		// element, tuple element, or the value.
+		case stateReference:
+			switch kind {
+			case scanner.TokenKindOther:
+				switch refState {
+				case refStateDir:
+					x.state = stateDirTail
+					kv.AppendRefToDirectory(token)
+
+				case refStateTup:
+					x.state = stateTupleTail
+					tup.Append(keyval.Reference(token))
+
+				case refStateVal:
+					x.state = stateFinished
+					kv.SetValue(keyval.Reference(token))
+
+				default:
+					return nil, errors.Errorf("unexpected reference state '%v'", refState)
+				}
 
 			default:
 				return nil, x.withTokens(x.tokenErr(kind))
@@ -534,6 +855,68 @@ func (x *Parser) Parse() (keyval.Query, error) {
 	}
 }
 
+// Names returns the name of each variable in the query parsed by
+// Parse, in the order the variables appear. Unnamed variables have
+// an empty name. Another query may refer to a named variable using
+// a keyval.Reference (see package rewrite).
+func (x *Parser) Names() []string {
+	return x.names
+}
+
+// setName names the most recently parsed variable.
+// Each name may only be used once per query.
+func (x *Parser) setName(name string) error {
+	for _, n := range x.names {
+		if n == name {
+			return errors.Errorf("variable name '%s' is used more than once", name)
+		}
+	}
+	x.names[len(x.names)-1] = name
+	return nil
+}
+
+// unsetName removes the name most recently given to the variable being
+// parsed. The name is instead added to the variable as a value type.
+func (x *Parser) unsetName(kv *internal.KeyValBuilder, tup *internal.TupBuilder, valVar bool, name string) error {
+	x.names[len(x.names)-1] = ""
+	return x.appendVarType(kv, tup, valVar, name)
+}
+
+// varEndState returns the state following the end of a variable.
+func (x *Parser) varEndState(valVar bool) state {
+	if valVar {
+		return stateFinished
+	}
+	return stateTupleTail
+}
+
+// setPredicate parses the given operator & operands and replaces the
+// variable currently being parsed with the resulting keyval.Predicate.
+func (x *Parser) setPredicate(kv *internal.KeyValBuilder, tup *internal.TupBuilder, valVar bool, op string, body string) error {
+	pred, err := parsePredicate(op, body)
+	if err != nil {
+		return err
+	}
+	if valVar {
+		return errors.Wrap(kv.SetValuePred(pred.Op, pred.Operands), "failed to set value predicate")
+	}
+	return errors.Wrap(tup.SetLastElemPred(pred.Op, pred.Operands), "failed to set last tuple element predicate")
+}
+
+// appendVarType adds the value type to the variable currently being
+// parsed, which is the value if valVar is true. Otherwise, it's the
+// last element of the tuple.
+func (x *Parser) appendVarType(kv *internal.KeyValBuilder, tup *internal.TupBuilder, valVar bool, token string) error {
+	v, err := parseValueType(token)
+	if err != nil {
+		return err
+	}
+	if valVar {
+		return errors.Wrap(kv.AppendToValueVar(v), "failed to append to value variable")
+	}
+	return errors.Wrap(tup.AppendToLastElemVar(v), "failed to append to last tuple element")
+}
+
 // withTokens wraps the given generic error with an Error.
 func (x *Parser) withTokens(err error) error {
 	out := Error{
@@ -567,13 +950,86 @@ func (x *Parser) tokenErr(kind scanner.TokenKind) error {
 	return errors.Errorf("unexpected '%v' token at parser state '%v'", tokenKindName(kind), stateName(x.state))
 }
 
+// setValueTuple assigns the completed value tuple to the query. If an
+// atomic mutation is being parsed, the tuple holds the mutation's
+// operand. Otherwise, the tuple is used as the value itself.
+func (x *Parser) setValueTuple(kv *internal.KeyValBuilder, op keyval.AtomicOp, tup keyval.Tuple) error {
+	if op == "" {
+		kv.SetValue(tup)
+		return nil
+	}
+	return errors.Wrap(kv.SetAtomicValue(op, tup), "failed to set atomic value")
+}
+
+func parseAtomicOp(token string) (keyval.AtomicOp, bool) {
+	for _, op := range keyval.AllAtomicOps() {
+		if string(op) == token {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// parsePredicate parses the operator & operands of a predicate. The
+// operands of InOp are written as a tuple. Every other operator has
+// a single operand. The operands may not contain variables.
+func parsePredicate(token string, body string) (keyval.Predicate, error) {
+	var op keyval.PredicateOp
+	for _, o := range keyval.AllPredicateOps() {
+		if string(o) == token {
+			op = o
+		}
+	}
+	if op == "" {
+		return keyval.Predicate{}, errors.Errorf("unrecognized predicate operator '%s'", token)
+	}
+
+	body = strings.TrimSpace(body)
+	if op != keyval.InOp {
+		body = string(internal.TupStart) + body + string(internal.TupEnd)
+	}
+
+	// The operands are parsed as the tuple of a key so
+	// they follow the same rules as any other tuple.
+	p := New(scanner.New(strings.NewReader(string(internal.DirSep) + "p" + body)))
+	query, err := p.Parse()
+	if err != nil {
+		return keyval.Predicate{}, errors.Wrapf(err, "failed to parse operands of predicate '%s'", op)
+	}
+	key, ok := query.(keyval.Key)
+	if !ok {
+		return keyval.Predicate{}, errors.Errorf("invalid operands of predicate '%s'", op)
+	}
+	operands := key.Tuple
+
+	if op != keyval.InOp && len(operands) != 1 {
+		return keyval.Predicate{}, errors.Errorf("predicate '%s' expects 1 operand, has %d", op, len(operands))
+	}
+	if len(operands) == 0 {
+		return keyval.Predicate{}, errors.Errorf("predicate '%s' expects at least 1 operand", op)
+	}
+	if c := class.Classify(keyval.KeyValue{Key: key, Value: keyval.Nil{}}); c != class.Constant {
+		return keyval.Predicate{}, errors.Errorf("operands of predicate '%s' aren't constant, have class '%v'", op, c)
+	}
+	if op == keyval.MatchOp {
+		str, ok := operands[0].(keyval.String)
+		if !ok {
+			return keyval.Predicate{}, errors.Errorf("predicate '%s' expects a string operand, has %T", op, operands[0])
+		}
+		if _, err := regexp.Compile(string(str)); err != nil {
+			return keyval.Predicate{}, errors.Wrap(err, "invalid regular expression")
+		}
+	}
+	return keyval.Predicate{Op: op, Operands: operands}, nil
+}
+
 func parseValueType(token string) (keyval.ValueType, error) {
 	for _, v := range keyval.AllTypes() {
 		if string(v) == token {
 			return v, nil
 		}
 	}
-	return keyval.AnyType, errors.Errorf("unrecognized value type")
+	return keyval.AnyType, errors.Errorf("unrecognized value type '%s'", token)
 }
 
 func parseData(token string) (
@@ -158,6 +158,9 @@ func TestValue(t *testing.T) {
 		{name: "tuple", str: "(-16,13.2,\"hi\")", ast: q.Tuple{q.Int(-16), q.Float(13.2), q.String("hi")}},
 		{name: "raw", str: "-16", ast: q.Int(-16)},
 		{name: "string", str: "\"he said \\\"wowee\\\"\"", ast: q.String("he said \"wowee\"")},
+		{name: "atomic", str: "add(1)", ast: q.Atomic{Op: q.AddOp, Operand: q.Int(1)}},
+		{name: "atomic string", str: "append_if_fits(\"hi\")", ast: q.Atomic{Op: q.AppendIfFitsOp, Operand: q.String("hi")}},
+		{name: "atomic tuple", str: "byte_max((1,2))", ast: q.Atomic{Op: q.ByteMaxOp, Operand: q.Tuple{q.Int(1), q.Int(2)}}},
 	}
 
 	t.Run("round trip", func(t *testing.T) {
@@ -182,6 +185,10 @@ func TestValue(t *testing.T) {
 		str  string
 	}{
 		{name: "empty", str: ""},
+		{name: "atomic no operand", str: "add()"},
+		{name: "atomic many operands", str: "add(1,2)"},
+		{name: "atomic maybe more", str: "add(...)"},
+		{name: "atomic no tuple", str: "add"},
 	}
 
 	t.Run("value parse failures", func(t *testing.T) {
@@ -301,6 +308,183 @@ func TestVariable(t *testing.T) {
 	})
 }
 
+func TestPredicate(t *testing.T) {
+	roundTrips := []struct {
+		name string
+		str  string
+		ast  q.Predicate
+	}{
+		{name: "greater equal", str: "<int:>=18>", ast: q.Predicate{Variable: q.Variable{q.IntType}, Op: q.GreaterEqualOp, Operands: q.Tuple{q.Int(18)}}},
+		{name: "greater", str: "<int:>-3>", ast: q.Predicate{Variable: q.Variable{q.IntType}, Op: q.GreaterOp, Operands: q.Tuple{q.Int(-3)}}},
+		{name: "less", str: "<float|int:<2.5>", ast: q.Predicate{Variable: q.Variable{q.FloatType, q.IntType}, Op: q.LessOp, Operands: q.Tuple{q.Float(2.5)}}},
+		{name: "less equal", str: "<uint:<=7>", ast: q.Predicate{Variable: q.Variable{q.UintType}, Op: q.LessEqualOp, Operands: q.Tuple{q.Int(7)}}},
+		{name: "equal", str: "<string:=\"a\">", ast: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.EqualOp, Operands: q.Tuple{q.String("a")}}},
+		{name: "not equal", str: "<bool:!=true>", ast: q.Predicate{Variable: q.Variable{q.BoolType}, Op: q.NotEqualOp, Operands: q.Tuple{q.Bool(true)}}},
+		{name: "match", str: "<string:~\"^err>|<\">", ast: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.MatchOp, Operands: q.Tuple{q.String("^err>|<")}}},
+		{name: "in", str: "<string:in(\"a\",\"b\")>", ast: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.InOp, Operands: q.Tuple{q.String("a"), q.String("b")}}},
+		{name: "any type", str: "<:>5>", ast: q.Predicate{Variable: q.Variable{}, Op: q.GreaterOp, Operands: q.Tuple{q.Int(5)}}},
+	}
+
+	t.Run("value round trip", func(t *testing.T) {
+		for _, test := range roundTrips {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+				p.state = stateValue
+
+				ast, err := p.Parse()
+				require.NoError(t, err)
+				require.Equal(t, test.ast, ast.(q.KeyValue).Value)
+
+				f := newFormat()
+				f.Value(test.ast)
+				require.Equal(t, test.str, f.String())
+			})
+		}
+	})
+
+	t.Run("key round trip", func(t *testing.T) {
+		for _, test := range roundTrips {
+			t.Run(test.name, func(t *testing.T) {
+				str := "(" + test.str + "," + test.str + ")"
+				p := New(scanner.New(strings.NewReader(str)))
+				p.state = stateDirTail
+
+				ast, err := p.Parse()
+				require.NoError(t, err)
+				require.Equal(t, q.Tuple{test.ast, test.ast}, ast.(q.Key).Tuple)
+
+				f := newFormat()
+				f.Tuple(q.Tuple{test.ast, test.ast})
+				require.Equal(t, str, f.String())
+			})
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		p := New(scanner.New(strings.NewReader("/a(<id:int:>=18>,<int:>, <x:>)=<v:string:in (\"a\")>")))
+
+		ast, err := p.Parse()
+		require.NoError(t, err)
+		require.Equal(t, q.KeyValue{
+			Key: q.Key{
+				Directory: q.Directory{q.String("a")},
+				Tuple: q.Tuple{
+					q.Predicate{Variable: q.Variable{q.IntType}, Op: q.GreaterEqualOp, Operands: q.Tuple{q.Int(18)}},
+					q.Variable{},
+					q.Variable{},
+				},
+			},
+			Value: q.Predicate{Variable: q.Variable{q.StringType}, Op: q.InOp, Operands: q.Tuple{q.String("a")}},
+		}, ast)
+		require.Equal(t, []string{"id", "int", "x", "v"}, p.Names())
+	})
+
+	parseFailures := []struct {
+		name string
+		str  string
+	}{
+		{name: "no operator", str: "<int|string:>"},
+		{name: "bad operator", str: "<int|string:is 5>"},
+		{name: "lone exclamation", str: "<int:!5>"},
+		{name: "no operand", str: "<int:>=>"},
+		{name: "many operands", str: "<int:=1,2>"},
+		{name: "empty in", str: "<int:in()>"},
+		{name: "variable operand", str: "<int:=<int>>"},
+		{name: "match not string", str: "<string:~5>"},
+		{name: "invalid regex", str: "<string:~\"(\">"},
+		{name: "unclosed", str: "<int:>=5"},
+		{name: "bad type", str: "<foo:>=5>"},
+	}
+
+	t.Run("value parse failures", func(t *testing.T) {
+		for _, test := range parseFailures {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+				p.state = stateValue
+
+				ast, err := p.Parse()
+				require.Error(t, err)
+				require.Nil(t, ast)
+			})
+		}
+	})
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		str   string
+		ast   q.KeyValue
+		names []string
+	}{
+		{
+			name: "named",
+			str:  "/old/<t:>/<>(<a:int>,(<b:string|bytes>,<int>))=<v:>",
+			ast: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("old"), q.Variable{}, q.Variable{}},
+					Tuple:     q.Tuple{q.Variable{q.IntType}, q.Tuple{q.Variable{q.StringType, q.BytesType}, q.Variable{q.IntType}}},
+				},
+				Value: q.Variable{},
+			},
+			names: []string{"t", "", "a", "b", "", "v"},
+		},
+		{
+			name: "references",
+			str:  "/new/:t(:b,(:a,1))=:v",
+			ast: q.KeyValue{
+				Key: q.Key{
+					Directory: q.Directory{q.String("new"), q.Reference("t")},
+					Tuple:     q.Tuple{q.Reference("b"), q.Tuple{q.Reference("a"), q.Int(1)}},
+				},
+				Value: q.Reference("v"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := New(scanner.New(strings.NewReader(test.str)))
+
+			ast, err := p.Parse()
+			require.NoError(t, err)
+			require.Equal(t, test.ast, ast)
+			require.Equal(t, test.names, p.Names())
+		})
+	}
+
+	t.Run("format reference", func(t *testing.T) {
+		f := newFormat()
+		f.KeyValue(tests[1].ast)
+		require.Equal(t, tests[1].str, f.String())
+	})
+
+	parseFailures := []struct {
+		name string
+		str  string
+	}{
+		{name: "duplicate", str: "/a(<x:int>,<x:int>)"},
+		{name: "duplicate dir", str: "/<x:>(<x:int>)"},
+		{name: "name after type", str: "/a(<int|x:int>)"},
+		{name: "two names", str: "/a(<x:y:int>)"},
+		{name: "dir type", str: "/<x:int>(1)"},
+		{name: "dir missing sep", str: "/<x>(1)"},
+		{name: "empty reference", str: "/a(:)"},
+		{name: "reference type", str: "/a(:<int>)"},
+	}
+
+	t.Run("parse failures", func(t *testing.T) {
+		for _, test := range parseFailures {
+			t.Run(test.name, func(t *testing.T) {
+				p := New(scanner.New(strings.NewReader(test.str)))
+				ast, err := p.Parse()
+				require.Error(t, err)
+				require.Nil(t, ast)
+			})
+		}
+	})
+}
+
 func TestData(t *testing.T) {
 	roundTrips := []struct {
 		name string
@@ -72,6 +72,9 @@ const (
 	// TokenKindStrMark identifies a token equal to StrMark.
 	TokenKindStrMark
 
+	// TokenKindVarRef identifies a token equal to VarRef.
+	TokenKindVarRef
+
 	// TokenKindReserved identifies a single-rune token which
 	// isn't currently used by the language but reserved for
 	// later use.
@@ -134,6 +137,8 @@ func singleRuneKind(r rune) TokenKind {
 		return TokenKindVarEnd
 	case internal.VarSep:
 		return TokenKindVarSep
+	case internal.VarRef:
+		return TokenKindVarRef
 	case internal.StrMark:
 		return TokenKindStrMark
 
@@ -158,8 +163,6 @@ func singleRuneKind(r rune) TokenKind {
 		return TokenKindReserved
 	case internal.Plus:
 		return TokenKindReserved
-	case internal.Colon:
-		return TokenKindReserved
 	case internal.Semicolon:
 		return TokenKindReserved
 	case internal.Question: